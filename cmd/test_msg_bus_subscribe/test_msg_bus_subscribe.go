@@ -21,7 +21,7 @@ var msgBus *messagebus.MessageBus
 func init() {
 	logger.InitLogger()
 	msgBus = messagebus.GetMessageBus("test", uuid.New(), "test", &messagebus.Config{})
-	msgBus.Register("bookTicker", msgHandler)
+	msgBus.Register("quote", msgHandler)
 	msgBus.Register("trade", msgHandler)
 }
 
@@ -2,35 +2,36 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
-	"tradebot_go/tradebot/exchange/binance"
+	"github.com/shopspring/decimal"
+	"tradebot_go/tradebot/base"
 	"tradebot_go/tradebot/core/messagebus"
 )
 
 func main() {
 
-	trade := binance.Trade{
-		EventType:  "trade",
-		EventTime:  1709616000000, // 2024-03-05 12:00:00 UTC
-		Symbol:     "BTCUSDT",
-		TradeID:    12345678,
-		Price:      "67241.50",
-		Quantity:   "0.15623",
-		TradeTime:  1709616000000,
-		IsMaker:    false,
-		Ignore:     false,
-		MarketType: "SPOT",
+	instrument := base.InstrumentID{Exchange: "binance", Symbol: "BTCUSDT", Market: base.MarketTypeSpot}
+	trade := base.TradeTick{
+		Instrument:    instrument,
+		TradeID:       "12345678",
+		Price:         decimal.RequireFromString("67241.50"),
+		Quantity:      decimal.RequireFromString("0.15623"),
+		AggressorSide: base.OrderSideBuy,
+		ExchangeTime:  time.UnixMilli(1709616000000), // 2024-03-05 12:00:00 UTC
+		LocalTime:     time.Now(),
 	}
 
-	// 创建一个 BookTicker 示例
-	bookTicker := binance.BookTicker{
-		UpdateID: 400900217,
-		Symbol:   "BTCUSDT",
-		BidPrice: "67240.50",
-		BidQty:   "1.25000",
-		AskPrice: "67241.50",
-		AskQty:   "0.84320",
+	// 创建一个 QuoteTick 示例
+	quote := base.QuoteTick{
+		Instrument: instrument,
+		BidPrice:   decimal.RequireFromString("67240.50"),
+		BidSize:    decimal.RequireFromString("1.25000"),
+		AskPrice:   decimal.RequireFromString("67241.50"),
+		AskSize:    decimal.RequireFromString("0.84320"),
+		UpdateID:   400900217,
+		LocalTime:  time.Now(),
 	}
 
 	mb := messagebus.NewMessageBus(
@@ -43,14 +44,14 @@ func main() {
 	)
 
 	// 注册端点处理器
-	mb.Register("bookTicker", func(msg interface{}) {
-		bookTicker := msg.(binance.BookTicker)
-		fmt.Printf("chase Received bookTicker: %v\n", bookTicker)
+	mb.Register("quote", func(msg interface{}) {
+		quote := msg.(base.QuoteTick)
+		fmt.Printf("chase Received quote: %v\n", quote)
 	})
 
 	// 订阅主题
 	mb.Register("trades.*", func(msg interface{}) {
-		trade := msg.(binance.Trade)
+		trade := msg.(base.TradeTick)
 		fmt.Printf("chase Received trade: %v\n", trade)
 	})
 
@@ -58,5 +59,5 @@ func main() {
 	mb.Send("trades.*", trade)
 
 	// 发送消息到端点
-	mb.Send("bookTicker", bookTicker)
+	mb.Send("quote", quote)
 }
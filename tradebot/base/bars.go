@@ -0,0 +1,313 @@
+package base
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 本地 K 线：由逐笔成交聚合
+//   - 时间 bar: 按成交时间切分固定周期，支持交易所没有的秒级周期，没有成交的周期不产生 bar
+//   - 成交量 bar: 累计成交量达到阈值时收盘
+//   - 成交额 bar: 累计成交额 (price * qty) 达到阈值时收盘
+// 触发收盘的那笔成交整体计入当前 bar，不拆分
+
+type BarType int
+
+const (
+	BarTypeTime BarType = iota
+	BarTypeVolume
+	BarTypeDollar
+)
+
+// BarSpec describes how trades are grouped into bars
+type BarSpec struct {
+	Type BarType
+	// Interval 时间 bar 的周期
+	Interval time.Duration
+	// Threshold 成交量 / 成交额 bar 的收盘阈值
+	Threshold decimal.Decimal
+}
+
+// TimeBars closes a bar every interval
+func TimeBars(interval time.Duration) BarSpec {
+	return BarSpec{Type: BarTypeTime, Interval: interval}
+}
+
+// VolumeBars closes a bar once its volume reaches threshold
+func VolumeBars(threshold decimal.Decimal) BarSpec {
+	return BarSpec{Type: BarTypeVolume, Threshold: threshold}
+}
+
+// DollarBars closes a bar once its quote volume reaches threshold
+func DollarBars(threshold decimal.Decimal) BarSpec {
+	return BarSpec{Type: BarTypeDollar, Threshold: threshold}
+}
+
+func (s BarSpec) String() string {
+	switch s.Type {
+	case BarTypeTime:
+		return "time:" + s.Interval.String()
+	case BarTypeVolume:
+		return "volume:" + s.Threshold.String()
+	case BarTypeDollar:
+		return "dollar:" + s.Threshold.String()
+	}
+	return fmt.Sprintf("unknown(%d)", s.Type)
+}
+
+func (s BarSpec) validate() error {
+	switch s.Type {
+	case BarTypeTime:
+		if s.Interval < time.Millisecond {
+			return fmt.Errorf("invalid bar interval %v", s.Interval)
+		}
+	case BarTypeVolume, BarTypeDollar:
+		if s.Threshold.Sign() <= 0 {
+			return fmt.Errorf("invalid bar threshold %s", s.Threshold)
+		}
+	default:
+		return fmt.Errorf("invalid bar type %d", s.Type)
+	}
+	return nil
+}
+
+// Bar is an OHLCV bar built from trades, times are in milliseconds
+type Bar struct {
+	Instrument InstrumentID
+	Spec       BarSpec
+	// OpenTime 时间 bar 为周期起点，其它为第一笔成交时间
+	OpenTime int64
+	// CloseTime 时间 bar 为周期终点 (不含)，其它为最后一笔成交时间
+	CloseTime   int64
+	Open        decimal.Decimal
+	High        decimal.Decimal
+	Low         decimal.Decimal
+	Close       decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+	Trades      int64
+	// Partial 交易所 K 线当前周期的实时更新，收盘前还会变化；本地聚合的 bar 收盘后才发布
+	Partial bool
+}
+
+// BarBuilder aggregates the trades of one symbol into bars of one spec, it is not
+// safe for concurrent use
+type BarBuilder struct {
+	Instrument InstrumentID
+	Spec       BarSpec
+
+	bar   Bar
+	open  bool
+	next  int64 // 上一个时间 bar 的终点，迟到的成交计入之后的 bar
+	onBar func(bar *Bar)
+}
+
+// NewBarBuilder creates a builder, onBar is called with every closed bar and must
+// copy it if it keeps it beyond the callback
+func NewBarBuilder(instrument InstrumentID, spec BarSpec, onBar func(bar *Bar)) (*BarBuilder, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	return &BarBuilder{Instrument: instrument, Spec: spec, onBar: onBar}, nil
+}
+
+// Add adds a trade, tradeTime is in milliseconds
+func (b *BarBuilder) Add(price, quantity decimal.Decimal, tradeTime int64) {
+	if b.Spec.Type == BarTypeTime {
+		interval := b.Spec.Interval.Milliseconds()
+		start := max(tradeTime-tradeTime%interval, b.next)
+		if b.open && start >= b.bar.CloseTime {
+			b.emit()
+		}
+		if !b.open {
+			b.start(price, start)
+			b.bar.CloseTime = start + interval
+		}
+	} else if !b.open {
+		b.start(price, tradeTime)
+	}
+
+	bar := &b.bar
+	if price.GreaterThan(bar.High) {
+		bar.High = price
+	}
+	if price.LessThan(bar.Low) {
+		bar.Low = price
+	}
+	bar.Close = price
+	bar.Volume = bar.Volume.Add(quantity)
+	bar.QuoteVolume = bar.QuoteVolume.Add(price.Mul(quantity))
+	bar.Trades++
+
+	switch b.Spec.Type {
+	case BarTypeVolume:
+		bar.CloseTime = tradeTime
+		if bar.Volume.GreaterThanOrEqual(b.Spec.Threshold) {
+			b.emit()
+		}
+	case BarTypeDollar:
+		bar.CloseTime = tradeTime
+		if bar.QuoteVolume.GreaterThanOrEqual(b.Spec.Threshold) {
+			b.emit()
+		}
+	}
+}
+
+// Flush closes the current time bar if its interval ended before now (milliseconds),
+// so that a bar is published without waiting for the next trade
+func (b *BarBuilder) Flush(now int64) {
+	if b.open && b.Spec.Type == BarTypeTime && now >= b.bar.CloseTime {
+		b.emit()
+	}
+}
+
+func (b *BarBuilder) start(price decimal.Decimal, openTime int64) {
+	b.bar = Bar{
+		Instrument: b.Instrument,
+		Spec:       b.Spec,
+		OpenTime:   openTime,
+		Open:       price,
+		High:       price,
+		Low:        price,
+	}
+	b.open = true
+}
+
+func (b *BarBuilder) emit() {
+	b.open = false
+	if b.Spec.Type == BarTypeTime {
+		b.next = b.bar.CloseTime
+	}
+	if b.onBar != nil {
+		b.onBar(&b.bar)
+	}
+}
+
+// barKey identifies a builder within a BarAggregator
+type barKey struct {
+	instrument InstrumentID
+	spec       string
+}
+
+// BarAggregator routes trades to the bar builders of their instrument and flushes time
+// bars periodically. It is safe for concurrent use, onBar callbacks run with its
+// lock held and must not call back into it.
+type BarAggregator struct {
+	mu       sync.Mutex
+	builders map[InstrumentID][]*BarBuilder
+	keys     map[barKey]*BarBuilder
+
+	running   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewBarAggregator() *BarAggregator {
+	return &BarAggregator{
+		builders: make(map[InstrumentID][]*BarBuilder),
+		keys:     make(map[barKey]*BarBuilder),
+		done:     make(chan struct{}),
+	}
+}
+
+// Add registers a builder for instrument, adding the same instrument and spec twice is a no-op
+func (a *BarAggregator) Add(instrument InstrumentID, spec BarSpec, onBar func(bar *Bar)) error {
+	builder, err := NewBarBuilder(instrument, spec, onBar)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := barKey{instrument: instrument, spec: spec.String()}
+	if _, ok := a.keys[key]; ok {
+		return nil
+	}
+	a.keys[key] = builder
+	a.builders[instrument] = append(a.builders[instrument], builder)
+	return nil
+}
+
+// Remove drops the builder of instrument and spec, its open bar is discarded
+func (a *BarAggregator) Remove(instrument InstrumentID, spec BarSpec) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := barKey{instrument: instrument, spec: spec.String()}
+	builder, ok := a.keys[key]
+	if !ok {
+		return
+	}
+	delete(a.keys, key)
+
+	builders := a.builders[instrument]
+	for i, b := range builders {
+		if b == builder {
+			builders = append(builders[:i], builders[i+1:]...)
+			break
+		}
+	}
+	if len(builders) == 0 {
+		delete(a.builders, instrument)
+	} else {
+		a.builders[instrument] = builders
+	}
+}
+
+// Tracks reports whether any builder aggregates instrument, callers use it to skip
+// parsing trades nobody needs
+func (a *BarAggregator) Tracks(instrument InstrumentID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.builders[instrument]) > 0
+}
+
+// Trade adds a trade of instrument to all its builders, tradeTime is in milliseconds
+func (a *BarAggregator) Trade(instrument InstrumentID, price, quantity decimal.Decimal, tradeTime int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, builder := range a.builders[instrument] {
+		builder.Add(price, quantity, tradeTime)
+	}
+}
+
+// Flush closes every time bar whose interval ended before now
+func (a *BarAggregator) Flush(now time.Time) {
+	ms := now.UnixMilli()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, builders := range a.builders {
+		for _, builder := range builders {
+			builder.Flush(ms)
+		}
+	}
+}
+
+// Start flushes time bars every interval until Stop
+func (a *BarAggregator) Start(interval time.Duration) {
+	if interval <= 0 || !a.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				a.Flush(now)
+			case <-a.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic flushes
+func (a *BarAggregator) Stop() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+	})
+}
@@ -0,0 +1,68 @@
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var btcusdt = InstrumentID{Exchange: "binance", Symbol: "BTCUSDT", Market: MarketTypeLinear}
+
+func TestTimeBars(t *testing.T) {
+	var bars []Bar
+	builder, err := NewBarBuilder(btcusdt, TimeBars(time.Second), func(bar *Bar) {
+		bars = append(bars, *bar)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price := decimal.RequireFromString
+	builder.Add(price("100"), price("1"), 10_100)
+	builder.Add(price("101"), price("2"), 10_900)
+	builder.Add(price("99"), price("1"), 11_200) // 开始下一个周期，上一个 bar 收盘
+	builder.Flush(11_999)
+	if len(bars) != 1 {
+		t.Fatalf("got %d bars before the interval ended", len(bars))
+	}
+	builder.Flush(12_000)
+	// 迟到的成交计入之后的 bar，不会重复产生已经收盘的周期
+	builder.Add(price("98"), price("1"), 11_500)
+	builder.Flush(13_000)
+
+	if len(bars) != 3 {
+		t.Fatalf("got %d bars", len(bars))
+	}
+	first := bars[0]
+	if first.OpenTime != 10_000 || first.CloseTime != 11_000 || first.Trades != 2 ||
+		!first.Open.Equal(price("100")) || !first.Close.Equal(price("101")) ||
+		!first.Volume.Equal(price("3")) || !first.QuoteVolume.Equal(price("302")) {
+		t.Fatalf("unexpected first bar %+v", first)
+	}
+	if bars[1].OpenTime != 11_000 || bars[2].OpenTime != 12_000 || !bars[2].Close.Equal(price("98")) {
+		t.Fatalf("unexpected bars %+v", bars[1:])
+	}
+}
+
+func TestDollarBars(t *testing.T) {
+	var bars []Bar
+	builder, err := NewBarBuilder(btcusdt, DollarBars(decimal.NewFromInt(1000)), func(bar *Bar) {
+		bars = append(bars, *bar)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price := decimal.RequireFromString
+	builder.Add(price("100"), price("4"), 1)
+	builder.Add(price("100"), price("7"), 2) // 成交额 1100，整笔计入当前 bar
+	builder.Add(price("100"), price("1"), 3)
+	if len(bars) != 1 || bars[0].Trades != 2 || bars[0].CloseTime != 2 || !bars[0].QuoteVolume.Equal(price("1100")) {
+		t.Fatalf("unexpected bars %+v", bars)
+	}
+
+	if _, err := NewBarBuilder(btcusdt, VolumeBars(decimal.Zero), nil); err == nil {
+		t.Fatal("expected an error for a zero threshold")
+	}
+}
@@ -3,6 +3,7 @@ package base
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/BitofferHub/pkg/middlewares/log"
 	"github.com/spf13/viper"
@@ -26,6 +27,53 @@ type RedisConfig struct {
 	Password string `mapstructure:"password"`
 }
 
+// WSConfig websocket 行情连接配置
+type WSConfig struct {
+	// URL 覆盖按账户类型选择的默认端点
+	URL string `mapstructure:"url"`
+	// CombinedStream 为 true 时使用组合流端点 (/stream)，消息以 {"stream":...,"data":...} 包裹
+	CombinedStream bool `mapstructure:"combined_stream"`
+	// MaxStreamsPerConn 单个连接的最大订阅数，满了以后自动新建连接，0 表示使用交易所默认值
+	MaxStreamsPerConn int `mapstructure:"max_streams_per_conn"`
+	// MaxMessagesPerSecond 单个连接每秒最多发送的控制消息数，0 表示使用交易所默认值
+	MaxMessagesPerSecond int `mapstructure:"max_messages_per_second"`
+	// 断线重连策略：指数退避加随机扰动，ReconnectMaxRetries 为 0 表示无限重连
+	ReconnectBaseDelay  time.Duration `mapstructure:"reconnect_base_delay"`
+	ReconnectMaxDelay   time.Duration `mapstructure:"reconnect_max_delay"`
+	ReconnectMaxRetries int           `mapstructure:"reconnect_max_retries"`
+	// AckTimeout 订阅等控制消息等待回执的超时，0 表示默认 10s
+	AckTimeout time.Duration `mapstructure:"ack_timeout"`
+	// StaleThresholds 按 stream 类型 (trade, bookTicker, ...) 配置的静默阈值，超过后告警并重新订阅，
+	// "default" 作用于其它类型，0 表示不检测
+	StaleThresholds map[string]time.Duration `mapstructure:"stale_thresholds"`
+	// RotateAfter 连接存活多久后主动切换到新连接，0 表示使用交易所默认值，负数表示不切换
+	RotateAfter time.Duration `mapstructure:"rotate_after"`
+	// RotationOverlap 切换连接时新旧连接同时接收数据的时长，0 表示默认 3s
+	RotationOverlap time.Duration `mapstructure:"rotation_overlap"`
+	// FeedLegs 冗余行情的连接组数，>1 时每组独立订阅同样的 stream，事件只投递最先到达的一份
+	FeedLegs int `mapstructure:"feed_legs"`
+	// FeedLegURLs 第 i 组连接使用的端点，留空使用默认端点
+	FeedLegURLs []string `mapstructure:"feed_leg_urls"`
+	// RedundantSymbols 只有这些 symbol 在所有连接组上订阅，为空表示全部
+	RedundantSymbols []string `mapstructure:"redundant_symbols"`
+	// LatencyReportInterval 行情延迟统计的日志输出周期，0 表示默认 1 分钟，负数表示不输出
+	LatencyReportInterval time.Duration `mapstructure:"latency_report_interval"`
+	// RecordDir 非空时把收到的原始帧录制到该目录，用于离线回放
+	RecordDir string `mapstructure:"record_dir"`
+	// RecordRotateBytes 单个录制文件的未压缩大小上限，0 表示默认 256MB
+	RecordRotateBytes int64 `mapstructure:"record_rotate_bytes"`
+}
+
+// RESTConfig REST 接口配置
+type RESTConfig struct {
+	// RecvWindow 签名请求默认的 recvWindow，0 表示使用交易所默认值 (5s)
+	RecvWindow time.Duration `mapstructure:"recv_window"`
+	// TimeSyncInterval 与服务器对时的周期，0 表示不对时、直接使用本地时间
+	TimeSyncInterval time.Duration `mapstructure:"time_sync_interval"`
+	// MaxClockDrift 本地时钟与服务器的偏差超过该值时告警，0 表示默认 1s
+	MaxClockDrift time.Duration `mapstructure:"max_clock_drift"`
+}
+
 // Config 总配置结构
 type Config struct {
 	BinanceFutureTestnet ExchangeConfig `mapstructure:"binance_future_testnet"`
@@ -33,6 +81,12 @@ type Config struct {
 	Bybit                ExchangeConfig `mapstructure:"bybit"`
 	BybitTestnet2        ExchangeConfig `mapstructure:"bybit_testnet_2"`
 	RedisConfig          RedisConfig    `mapstructure:"redis_config"`
+	WS                   WSConfig       `mapstructure:"ws"`
+	REST                 RESTConfig     `mapstructure:"rest"`
+
+	// Binance 按账户类型 (spot, margin, usd_m_future, ...) 配置的 API key，不区分大小写，
+	// BinanceFutureTestnet 只用于没有单独配置的 U 本位合约测试网
+	Binance map[string]ExchangeConfig `mapstructure:"binance"`
 }
 
 // LoadConfig loads the configuration using viper
@@ -1,5 +1,9 @@
 package base
 
+import "github.com/shopspring/decimal"
+
+// Order is an order of any exchange, prices, quantities and amounts are decimals so
+// that fills and fees accumulate without rounding error
 type Order struct {
 	Exchange        string
 	Symbol          string
@@ -10,17 +14,17 @@ type Order struct {
 	Type            OrderType
 	Side            OrderSide
 	TimeInForce     TimeInForce
-	Price           float64
-	Average         float64
-	LastFilledPrice float64
-	Amount          float64
-	Filled          float64
-	LastFilled      float64
-	Remaining       float64
-	Fee             float64
+	Price           decimal.Decimal
+	Average         decimal.Decimal
+	LastFilledPrice decimal.Decimal
+	Amount          decimal.Decimal
+	Filled          decimal.Decimal
+	LastFilled      decimal.Decimal
+	Remaining       decimal.Decimal
+	Fee             decimal.Decimal
 	FeeCurrency     string
-	Cost            float64
-	CumCost         float64
+	Cost            decimal.Decimal
+	CumCost         decimal.Decimal
 	ReduceOnly      bool
 	PositionSide    PositionSide
 	Success         bool
@@ -66,6 +70,8 @@ const (
 	TimeInForceGTC TimeInForce = "GTC"
 	TimeInForceIOC TimeInForce = "IOC"
 	TimeInForceFOK TimeInForce = "FOK"
+	// TimeInForceGTX post only，会立即成交时拒绝
+	TimeInForceGTX TimeInForce = "GTX"
 )
 
 type PositionSide string
@@ -74,6 +80,8 @@ const (
 	PositionSideLong  PositionSide = "LONG"
 	PositionSideShort PositionSide = "SHORT"
 	PositionSideFlat  PositionSide = "FLAT"
+	// PositionSideBoth 单向持仓模式下的订单
+	PositionSideBoth PositionSide = "BOTH"
 )
 
 type BinanceAccountType string
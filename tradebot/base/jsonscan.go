@@ -0,0 +1,362 @@
+package base
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shopspring/decimal"
+)
+
+// 行情热路径上的 JSON 扫描工具，扫描只切片不拷贝，不分配内存。
+// 交易所推送的 key 与字符串值不包含转义字符，因此字符串按原样返回。
+// 数值直接从字节解析，但 decimal 基于 big.Int，ParseDecimal 每个值仍分配两次。
+
+var (
+	ErrNotObject    = errors.New("json: not an object")
+	ErrNotArray     = errors.New("json: not an array")
+	ErrInvalidJSON  = errors.New("json: invalid syntax")
+	ErrInvalidValue = errors.New("json: invalid value")
+)
+
+// ObjectEach calls fn for every top-level key of a JSON object. String values are
+// passed without their quotes, other values as their raw bytes. fn returns false to
+// stop early.
+func ObjectEach(data []byte, fn func(key, value []byte) bool) error {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return ErrNotObject
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return nil
+	}
+
+	for i < len(data) {
+		if data[i] != '"' {
+			return ErrInvalidJSON
+		}
+		keyEnd, err := skipString(data, i)
+		if err != nil {
+			return err
+		}
+		key := data[i+1 : keyEnd-1]
+
+		i = skipSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return ErrInvalidJSON
+		}
+		i = skipSpace(data, i+1)
+
+		valueEnd, err := skipValue(data, i)
+		if err != nil {
+			return err
+		}
+		value := data[i:valueEnd]
+		if len(value) > 0 && value[0] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !fn(key, value) {
+			return nil
+		}
+
+		i = skipSpace(data, valueEnd)
+		if i >= len(data) {
+			break
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case '}':
+			return nil
+		default:
+			return ErrInvalidJSON
+		}
+	}
+	return ErrInvalidJSON
+}
+
+// ArrayEach calls fn with the raw bytes of every element of a JSON array, string
+// elements are passed without their quotes
+func ArrayEach(data []byte, fn func(value []byte) error) error {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '[' {
+		return ErrNotArray
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return nil
+	}
+
+	for i < len(data) {
+		end, err := skipValue(data, i)
+		if err != nil {
+			return err
+		}
+		value := data[i:end]
+		if len(value) > 0 && value[0] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+
+		i = skipSpace(data, end)
+		if i >= len(data) {
+			break
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case ']':
+			return nil
+		default:
+			return ErrInvalidJSON
+		}
+	}
+	return ErrInvalidJSON
+}
+
+// PeekField returns the value of a top-level key, see ObjectEach for the value format
+func PeekField(data []byte, key string) ([]byte, bool) {
+	var found []byte
+	var ok bool
+	ObjectEach(data, func(k, v []byte) bool {
+		if string(k) == key {
+			found, ok = v, true
+			return false
+		}
+		return true
+	})
+	return found, ok
+}
+
+// errStopScan ends an ArrayEach early
+var errStopScan = errors.New("json: stop")
+
+// FirstElement returns the first element of a JSON array, see ArrayEach for the value format
+func FirstElement(data []byte) ([]byte, bool) {
+	var first []byte
+	var ok bool
+	ArrayEach(data, func(value []byte) error {
+		first, ok = value, true
+		return errStopScan
+	})
+	return first, ok
+}
+
+// IsArray reports whether data holds a JSON array
+func IsArray(data []byte) bool {
+	i := skipSpace(data, 0)
+	return i < len(data) && data[i] == '['
+}
+
+// ParseInt parses a JSON integer without allocating, values outside int64 are rejected
+func ParseInt(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 0, ErrInvalidValue
+	}
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, ErrInvalidValue
+		}
+	}
+	// 超过 19 位必然溢出，19 位时逐位检查
+	if len(b) > 19 {
+		return 0, ErrInvalidValue
+	}
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidValue
+		}
+		d := uint64(c - '0')
+		if n > (limit-d)/10 {
+			return 0, ErrInvalidValue
+		}
+		n = n*10 + d
+	}
+	if neg {
+		return -int64(n), nil
+	}
+	return int64(n), nil
+}
+
+// ParseDecimal parses a plain decimal such as "-123.45" from b without converting it
+// to a string, values that don't fit an int64 coefficient or use an exponent fall back
+// to decimal.NewFromString
+func ParseDecimal(b []byte) (decimal.Decimal, error) {
+	s := b
+	neg := len(s) > 0 && s[0] == '-'
+	if neg {
+		s = s[1:]
+	}
+	var n int64
+	var exp int32
+	digits, dot := false, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			if n > (math.MaxInt64-9)/10 {
+				return decimal.NewFromString(string(b))
+			}
+			n = n*10 + int64(c-'0')
+			digits = true
+			if dot {
+				exp--
+			}
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return decimal.NewFromString(string(b))
+		}
+	}
+	if !digits {
+		return decimal.Decimal{}, ErrInvalidValue
+	}
+	if neg {
+		n = -n
+	}
+	return decimal.New(n, exp), nil
+}
+
+// ParseBool parses a JSON boolean
+func ParseBool(b []byte) (bool, error) {
+	switch string(b) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, ErrInvalidValue
+}
+
+// SetString assigns b to *dst, reusing the existing string when it is unchanged
+// so that pooled objects don't allocate for repeated values such as the symbol
+func SetString(dst *string, b []byte) {
+	if *dst != string(b) {
+		*dst = string(b)
+	}
+}
+
+// internTable holds interned strings, copied on write so that lookups take no lock
+var (
+	internTable atomic.Pointer[map[string]string]
+	internMu    sync.Mutex
+)
+
+// maxInterned bounds the intern table, further values are converted normally
+const maxInterned = 1024
+
+// Intern returns a shared string for b, so that a small set of recurring values such
+// as event types does not allocate on every message
+func Intern(b []byte) string {
+	if table := internTable.Load(); table != nil {
+		if s, ok := (*table)[string(b)]; ok {
+			return s
+		}
+	}
+
+	internMu.Lock()
+	defer internMu.Unlock()
+
+	old := internTable.Load()
+	if old != nil {
+		if s, ok := (*old)[string(b)]; ok {
+			return s
+		}
+		if len(*old) >= maxInterned {
+			return string(b)
+		}
+	}
+	table := make(map[string]string)
+	if old != nil {
+		for k, v := range *old {
+			table[k] = v
+		}
+	}
+	s := string(b)
+	table[s] = s
+	internTable.Store(&table)
+	return s
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipString returns the index after the closing quote of the string starting at i
+func skipString(data []byte, i int) (int, error) {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+	return 0, ErrInvalidJSON
+}
+
+// skipValue returns the index after the value starting at i
+func skipValue(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, ErrInvalidJSON
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(data); j++ {
+			switch data[j] {
+			case '"':
+				end, err := skipString(data, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, ErrInvalidJSON
+	default:
+		// number, true, false, null
+		j := i
+		for j < len(data) {
+			switch data[j] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				if j == i {
+					return 0, ErrInvalidJSON
+				}
+				return j, nil
+			}
+			j++
+		}
+		if j == i {
+			return 0, ErrInvalidJSON
+		}
+		return j, nil
+	}
+}
@@ -0,0 +1,48 @@
+package base
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseIntOverflow(t *testing.T) {
+	for _, s := range []string{"9223372036854775807", "-9223372036854775808", "0", "-1", "0000000000000000001"} {
+		want, _ := strconv.ParseInt(s, 10, 64)
+		if got, err := ParseInt([]byte(s)); got != want || err != nil {
+			t.Fatalf("ParseInt(%q) = %d, %v", s, got, err)
+		}
+	}
+	// 超过 19 位的输入即使有前导零也拒绝
+	for _, s := range []string{"00000000000000000001", "9223372036854775808", "-9223372036854775809", "99999999999999999999", "18446744073709551616"} {
+		if n, err := ParseInt([]byte(s)); err == nil {
+			t.Fatalf("ParseInt(%q) = %d, expected overflow", s, n)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, s := range []string{"0", "-0.0", "1.50", "0.00012345", "67123.45000000", "-3.1", ".5", "1.",
+		"922337203685477580.7", "123456789012345678901234.5", "1e-8"} {
+		want := decimal.RequireFromString(s)
+		got, err := ParseDecimal([]byte(s))
+		if err != nil {
+			t.Fatalf("ParseDecimal(%q): %v", s, err)
+		}
+		if !got.Equal(want) || got.Exponent() != want.Exponent() {
+			t.Fatalf("ParseDecimal(%q) = %s (exp %d), want %s (exp %d)", s, got, got.Exponent(), want, want.Exponent())
+		}
+	}
+	for _, s := range []string{"", "-", ".", "1.2.3", "abc"} {
+		if d, err := ParseDecimal([]byte(s)); err == nil {
+			t.Fatalf("ParseDecimal(%q) = %s, expected an error", s, d)
+		}
+	}
+
+	// big.Int 的结构体和 nat 各一次分配，没有字符串转换
+	b := []byte("67123.45000000")
+	if allocs := testing.AllocsPerRun(100, func() { ParseDecimal(b) }); allocs > 2 {
+		t.Fatalf("ParseDecimal allocates %v times", allocs)
+	}
+}
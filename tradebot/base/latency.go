@@ -0,0 +1,330 @@
+package base
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// 行情链路延迟统计：按 stream 记录四段延迟的直方图
+//   - ExchangeToWire:    交易所事件时间 (E) 到本地 socket 读到该帧，包含网络与时钟偏差
+//   - WireToDecode:      读到帧到解码完成，包含路由、去重与解码
+//   - DecodeToDispatch:  解码完成到交给消息总线，包含转换为 base 类型
+//   - DispatchToHandler: 交给消息总线到 handler 全部返回，即我们自己的 handler 的耗时
+// 周期日志只覆盖上一个周期，累计值另外保存
+
+const (
+	// 每个 2 的幂区间再分 8 个桶，相对误差不超过 12.5%
+	latencySubBucketBits = 3
+	latencySubBuckets    = 1 << latencySubBucketBits
+	// 以微秒计，最大可区分约 2^27us (134s)，更大的值落入最后一个桶
+	latencyMaxExponent = 27
+	latencyBuckets     = latencySubBuckets + (latencyMaxExponent-latencySubBucketBits)*latencySubBuckets
+)
+
+// LatencyHistogram is a lock-free log-linear histogram of durations with microsecond resolution
+type LatencyHistogram struct {
+	counts   [latencyBuckets]atomic.Int64
+	count    atomic.Int64
+	sum      atomic.Int64 // microseconds
+	max      atomic.Int64 // microseconds
+	negative atomic.Int64
+}
+
+// Record adds one observation, negative durations (clock skew) are counted but not recorded
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		h.negative.Add(1)
+		return
+	}
+	us := d.Microseconds()
+	h.counts[latencyBucket(us)].Add(1)
+	h.count.Add(1)
+	h.sum.Add(us)
+	for {
+		old := h.max.Load()
+		if us <= old || h.max.CompareAndSwap(old, us) {
+			break
+		}
+	}
+}
+
+// LatencySummary is a point-in-time view of a LatencyHistogram
+type LatencySummary struct {
+	Count int64
+	// Negative 本地时间早于交易所时间的次数，说明本地时钟偏慢
+	Negative int64
+	Mean     time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	P999     time.Duration
+	Max      time.Duration
+}
+
+func (s LatencySummary) String() string {
+	if s.Count == 0 {
+		return "n=0"
+	}
+	str := fmt.Sprintf("n=%d mean=%v p50=%v p90=%v p99=%v p99.9=%v max=%v",
+		s.Count, s.Mean, s.P50, s.P90, s.P99, s.P999, s.Max)
+	if s.Negative > 0 {
+		str += fmt.Sprintf(" negative=%d", s.Negative)
+	}
+	return str
+}
+
+// Summary computes the count, mean and percentiles recorded so far
+func (h *LatencyHistogram) Summary() LatencySummary {
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range counts {
+		counts[i] = h.counts[i].Load()
+		total += counts[i]
+	}
+
+	summary := LatencySummary{
+		Count:    total,
+		Negative: h.negative.Load(),
+		Max:      time.Duration(h.max.Load()) * time.Microsecond,
+	}
+	if total == 0 {
+		return summary
+	}
+	if n := h.count.Load(); n > 0 {
+		summary.Mean = time.Duration(h.sum.Load()/n) * time.Microsecond
+	}
+
+	percentile := func(p float64) time.Duration {
+		rank := int64(p * float64(total))
+		var seen int64
+		for i, c := range counts {
+			seen += c
+			if seen > rank {
+				return min(latencyBucketValue(i), summary.Max)
+			}
+		}
+		return summary.Max
+	}
+	summary.P50 = percentile(0.5)
+	summary.P90 = percentile(0.9)
+	summary.P99 = percentile(0.99)
+	summary.P999 = percentile(0.999)
+	return summary
+}
+
+// Reset clears the histogram
+func (h *LatencyHistogram) Reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.count.Store(0)
+	h.sum.Store(0)
+	h.max.Store(0)
+	h.negative.Store(0)
+}
+
+// latencyBucket maps microseconds to a bucket: values below latencySubBuckets are
+// exact, larger ones use latencySubBuckets buckets per power of two
+func latencyBucket(us int64) int {
+	if us < latencySubBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(uint64(us)) - 1
+	if exp >= latencyMaxExponent {
+		return latencyBuckets - 1
+	}
+	sub := int(us>>(exp-latencySubBucketBits)) & (latencySubBuckets - 1)
+	return latencySubBuckets + (exp-latencySubBucketBits)*latencySubBuckets + sub
+}
+
+// latencyBucketValue returns the midpoint of a bucket
+func latencyBucketValue(i int) time.Duration {
+	if i < latencySubBuckets {
+		return time.Duration(i) * time.Microsecond
+	}
+	exp := (i-latencySubBuckets)/latencySubBuckets + latencySubBucketBits
+	sub := int64((i - latencySubBuckets) % latencySubBuckets)
+	width := int64(1) << (exp - latencySubBucketBits)
+	low := (latencySubBuckets + sub) * width
+	return time.Duration(low+width/2) * time.Microsecond
+}
+
+// StreamLatency holds the latency histograms of one stream, the exported ones cover the
+// current reporting interval
+type StreamLatency struct {
+	ExchangeToWire    LatencyHistogram
+	WireToDecode      LatencyHistogram
+	DecodeToDispatch  LatencyHistogram
+	DispatchToHandler LatencyHistogram
+
+	// 自开始统计以来的累计值，不随周期日志重置
+	totalExchangeToWire    LatencyHistogram
+	totalWireToDecode      LatencyHistogram
+	totalDecodeToDispatch  LatencyHistogram
+	totalDispatchToHandler LatencyHistogram
+}
+
+// Observe records the timestamps of one event, eventTime is the exchange event
+// time in milliseconds (0 if the event has none)
+func (s *StreamLatency) Observe(eventTime int64, receivedAt, decodedAt, dispatchedAt, handledAt time.Time) {
+	if eventTime > 0 {
+		d := receivedAt.Sub(time.UnixMilli(eventTime))
+		s.ExchangeToWire.Record(d)
+		s.totalExchangeToWire.Record(d)
+	}
+	decode, dispatch, handler := decodedAt.Sub(receivedAt), dispatchedAt.Sub(decodedAt), handledAt.Sub(dispatchedAt)
+	s.WireToDecode.Record(decode)
+	s.totalWireToDecode.Record(decode)
+	s.DecodeToDispatch.Record(dispatch)
+	s.totalDecodeToDispatch.Record(dispatch)
+	s.DispatchToHandler.Record(handler)
+	s.totalDispatchToHandler.Record(handler)
+}
+
+// StreamLatencySummary summarises the four stages of a stream
+type StreamLatencySummary struct {
+	ExchangeToWire    LatencySummary
+	WireToDecode      LatencySummary
+	DecodeToDispatch  LatencySummary
+	DispatchToHandler LatencySummary
+}
+
+// LatencyMonitor keeps the latency histograms of every stream and logs them periodically
+type LatencyMonitor struct {
+	mu      sync.RWMutex
+	streams map[string]*StreamLatency
+
+	running   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewLatencyMonitor() *LatencyMonitor {
+	return &LatencyMonitor{
+		streams: make(map[string]*StreamLatency),
+		done:    make(chan struct{}),
+	}
+}
+
+// Stream returns the histograms of a stream, creating them on first use. The key
+// may be a reused buffer, looking up an existing stream does not allocate.
+func (m *LatencyMonitor) Stream(key []byte) *StreamLatency {
+	m.mu.RLock()
+	s, ok := m.streams[string(key)]
+	m.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.streams[string(key)]; ok {
+		return s
+	}
+	s = &StreamLatency{}
+	m.streams[string(key)] = s
+	return s
+}
+
+// Summary returns the latency summary of every stream since the last Reset
+func (m *LatencyMonitor) Summary() map[string]StreamLatencySummary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summary := make(map[string]StreamLatencySummary, len(m.streams))
+	for name, s := range m.streams {
+		summary[name] = StreamLatencySummary{
+			ExchangeToWire:    s.ExchangeToWire.Summary(),
+			WireToDecode:      s.WireToDecode.Summary(),
+			DecodeToDispatch:  s.DecodeToDispatch.Summary(),
+			DispatchToHandler: s.DispatchToHandler.Summary(),
+		}
+	}
+	return summary
+}
+
+// CumulativeSummary returns the latency summary of every stream since it was first
+// observed, Reset and the periodic summaries don't affect it
+func (m *LatencyMonitor) CumulativeSummary() map[string]StreamLatencySummary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summary := make(map[string]StreamLatencySummary, len(m.streams))
+	for name, s := range m.streams {
+		summary[name] = StreamLatencySummary{
+			ExchangeToWire:    s.totalExchangeToWire.Summary(),
+			WireToDecode:      s.totalWireToDecode.Summary(),
+			DecodeToDispatch:  s.totalDecodeToDispatch.Summary(),
+			DispatchToHandler: s.totalDispatchToHandler.Summary(),
+		}
+	}
+	return summary
+}
+
+// Reset clears the interval histograms of every stream, the cumulative ones are kept
+func (m *LatencyMonitor) Reset() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.streams {
+		s.ExchangeToWire.Reset()
+		s.WireToDecode.Reset()
+		s.DecodeToDispatch.Reset()
+		s.DispatchToHandler.Reset()
+	}
+}
+
+// Start logs a summary of every stream each interval, the histograms are reset after
+// each summary so that every log line covers one interval
+func (m *LatencyMonitor) Start(interval time.Duration) {
+	if interval <= 0 || !m.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.report()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic summaries
+func (m *LatencyMonitor) Stop() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+func (m *LatencyMonitor) report() {
+	summary := m.Summary()
+	names := make([]string, 0, len(summary))
+	for name, s := range summary {
+		if s.WireToDecode.Count > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		s := summary[name]
+		fmt.Fprintf(&b, "\n  %s exchange->wire[%v] wire->decode[%v] decode->dispatch[%v] dispatch->handler[%v]",
+			name, s.ExchangeToWire, s.WireToDecode, s.DecodeToDispatch, s.DispatchToHandler)
+	}
+	if b.Len() > 0 {
+		log.Infof("Feed latency:%s", b.String())
+	}
+	m.Reset()
+}
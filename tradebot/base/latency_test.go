@@ -0,0 +1,23 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyCumulativeSurvivesReset(t *testing.T) {
+	monitor := NewLatencyMonitor()
+	now := time.Now()
+	stream := monitor.Stream([]byte("btcusdt@trade"))
+	stream.Observe(0, now, now.Add(time.Millisecond), now.Add(2*time.Millisecond), now.Add(5*time.Millisecond))
+	monitor.Reset()
+	stream.Observe(0, now, now.Add(time.Millisecond), now.Add(2*time.Millisecond), now.Add(5*time.Millisecond))
+
+	if n := monitor.Summary()["btcusdt@trade"].WireToDecode.Count; n != 1 {
+		t.Fatalf("interval count = %d", n)
+	}
+	total := monitor.CumulativeSummary()["btcusdt@trade"]
+	if total.WireToDecode.Count != 2 || total.DecodeToDispatch.Max != time.Millisecond || total.DispatchToHandler.Max != 3*time.Millisecond {
+		t.Fatalf("cumulative summary %+v", total)
+	}
+}
@@ -0,0 +1,242 @@
+package base
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 与交易所无关的行情类型：各交易所 connector 把推送转换为这些类型后再发布到消息总线，
+// 策略只依赖 base 包。价格与数量用 decimal，时间同时保留交易所时间与本地收到时间。
+
+// MarketType is the kind of market an instrument trades on
+type MarketType string
+
+const (
+	MarketTypeSpot   MarketType = "SPOT"
+	MarketTypeMargin MarketType = "MARGIN"
+	// MarketTypeLinear U 本位合约 (USDⓈ-M)
+	MarketTypeLinear MarketType = "LINEAR"
+	// MarketTypeInverse 币本位合约 (COIN-M)
+	MarketTypeInverse MarketType = "INVERSE"
+)
+
+// InstrumentID identifies an instrument across exchanges
+type InstrumentID struct {
+	Exchange string
+	Symbol   string
+	Market   MarketType
+}
+
+func (id InstrumentID) String() string {
+	return id.Exchange + ":" + string(id.Market) + ":" + id.Symbol
+}
+
+// TradeTick is a public trade
+type TradeTick struct {
+	Instrument InstrumentID
+	TradeID    string
+	Price      decimal.Decimal
+	Quantity   decimal.Decimal
+	// AggressorSide 主动成交方，交易所未提供时为空
+	AggressorSide OrderSide
+	// ExchangeTime 交易所成交时间，LocalTime 本地收到的时间
+	ExchangeTime time.Time
+	LocalTime    time.Time
+}
+
+// QuoteTick is a top of book update
+type QuoteTick struct {
+	Instrument InstrumentID
+	BidPrice   decimal.Decimal
+	BidSize    decimal.Decimal
+	AskPrice   decimal.Decimal
+	AskSize    decimal.Decimal
+	// UpdateID 交易所的订单簿更新 ID，没有时为 0
+	UpdateID     int64
+	ExchangeTime time.Time
+	LocalTime    time.Time
+}
+
+// OrderBookDelta is a batch of level changes of an order book, a level with zero
+// quantity is removed. With Snapshot set the levels replace the whole book.
+type OrderBookDelta struct {
+	Instrument InstrumentID
+	Snapshot   bool
+	// FirstUpdateID 与 FinalUpdateID 为该批变化覆盖的交易所更新 ID 范围
+	FirstUpdateID int64
+	FinalUpdateID int64
+	Bids          []PriceLevel
+	Asks          []PriceLevel
+	ExchangeTime  time.Time
+	LocalTime     time.Time
+}
+
+// MarkPriceUpdate is the mark price, index price and funding rate of a perpetual or
+// delivery contract
+type MarkPriceUpdate struct {
+	Instrument           InstrumentID
+	MarkPrice            decimal.Decimal
+	IndexPrice           decimal.Decimal
+	EstimatedSettlePrice decimal.Decimal
+	// FundingRate 交割合约为 0，NextFundingTime 为零值
+	FundingRate     decimal.Decimal
+	NextFundingTime time.Time
+	ExchangeTime    time.Time
+	LocalTime       time.Time
+}
+
+// Liquidation is a forced liquidation order
+type Liquidation struct {
+	Instrument     InstrumentID
+	Side           OrderSide
+	OrderType      OrderType
+	TimeInForce    TimeInForce
+	Status         OrderStatus
+	Price          decimal.Decimal
+	AveragePrice   decimal.Decimal
+	Quantity       decimal.Decimal
+	LastFilledQty  decimal.Decimal
+	FilledQuantity decimal.Decimal
+	// ExchangeTime 强平单的成交时间
+	ExchangeTime time.Time
+	LocalTime    time.Time
+}
+
+// Ticker is the rolling 24h statistics of an instrument. Mini tickers only carry the
+// OHLC prices and volumes, the other fields are zero.
+type Ticker struct {
+	Instrument         InstrumentID
+	LastPrice          decimal.Decimal
+	LastQuantity       decimal.Decimal
+	PriceChange        decimal.Decimal
+	PriceChangePercent decimal.Decimal
+	WeightedAvgPrice   decimal.Decimal
+	// 交易所未提供最优买卖价时为 0
+	BidPrice    decimal.Decimal
+	BidSize     decimal.Decimal
+	AskPrice    decimal.Decimal
+	AskSize     decimal.Decimal
+	Open        decimal.Decimal
+	High        decimal.Decimal
+	Low         decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+	Trades      int64
+	// OpenTime 与 CloseTime 为统计窗口
+	OpenTime     time.Time
+	CloseTime    time.Time
+	ExchangeTime time.Time
+	LocalTime    time.Time
+}
+
+// TickerBatch is the tickers of one exchange message, an all-market stream carries
+// every instrument that changed
+type TickerBatch struct {
+	Tickers []Ticker
+}
+
+// 池化的行情对象只在 handler 回调期间有效，需要保留的订阅者必须自行拷贝。
+
+var tradeTickPool = sync.Pool{
+	New: func() any { return new(TradeTick) },
+}
+
+var quoteTickPool = sync.Pool{
+	New: func() any { return new(QuoteTick) },
+}
+
+var orderBookDeltaPool = sync.Pool{
+	New: func() any { return new(OrderBookDelta) },
+}
+
+var markPriceUpdatePool = sync.Pool{
+	New: func() any { return new(MarkPriceUpdate) },
+}
+
+var liquidationPool = sync.Pool{
+	New: func() any { return new(Liquidation) },
+}
+
+var tickerBatchPool = sync.Pool{
+	New: func() any { return new(TickerBatch) },
+}
+
+var barPool = sync.Pool{
+	New: func() any { return new(Bar) },
+}
+
+// AcquireTradeTick takes a TradeTick from the pool
+func AcquireTradeTick() *TradeTick {
+	return tradeTickPool.Get().(*TradeTick)
+}
+
+// ReleaseTradeTick returns a TradeTick to the pool, it must not be used afterwards
+func ReleaseTradeTick(t *TradeTick) {
+	tradeTickPool.Put(t)
+}
+
+// AcquireQuoteTick takes a QuoteTick from the pool
+func AcquireQuoteTick() *QuoteTick {
+	return quoteTickPool.Get().(*QuoteTick)
+}
+
+// ReleaseQuoteTick returns a QuoteTick to the pool, it must not be used afterwards
+func ReleaseQuoteTick(q *QuoteTick) {
+	quoteTickPool.Put(q)
+}
+
+// AcquireOrderBookDelta takes an OrderBookDelta from the pool
+func AcquireOrderBookDelta() *OrderBookDelta {
+	return orderBookDeltaPool.Get().(*OrderBookDelta)
+}
+
+// ReleaseOrderBookDelta returns an OrderBookDelta to the pool, it must not be used afterwards
+func ReleaseOrderBookDelta(d *OrderBookDelta) {
+	// 档位切片属于转换来源，不随对象保留
+	d.Bids, d.Asks = nil, nil
+	orderBookDeltaPool.Put(d)
+}
+
+// AcquireMarkPriceUpdate takes a MarkPriceUpdate from the pool
+func AcquireMarkPriceUpdate() *MarkPriceUpdate {
+	return markPriceUpdatePool.Get().(*MarkPriceUpdate)
+}
+
+// ReleaseMarkPriceUpdate returns a MarkPriceUpdate to the pool, it must not be used afterwards
+func ReleaseMarkPriceUpdate(u *MarkPriceUpdate) {
+	markPriceUpdatePool.Put(u)
+}
+
+// AcquireLiquidation takes a Liquidation from the pool
+func AcquireLiquidation() *Liquidation {
+	return liquidationPool.Get().(*Liquidation)
+}
+
+// ReleaseLiquidation returns a Liquidation to the pool, it must not be used afterwards
+func ReleaseLiquidation(l *Liquidation) {
+	liquidationPool.Put(l)
+}
+
+// AcquireTickerBatch takes an empty TickerBatch from the pool
+func AcquireTickerBatch() *TickerBatch {
+	return tickerBatchPool.Get().(*TickerBatch)
+}
+
+// ReleaseTickerBatch returns a TickerBatch to the pool, it must not be used afterwards
+func ReleaseTickerBatch(b *TickerBatch) {
+	// 保留切片容量，全市场推送每次有数百个 ticker
+	b.Tickers = b.Tickers[:0]
+	tickerBatchPool.Put(b)
+}
+
+// AcquireBar takes a Bar from the pool
+func AcquireBar() *Bar {
+	return barPool.Get().(*Bar)
+}
+
+// ReleaseBar returns a Bar to the pool, it must not be used afterwards
+func ReleaseBar(b *Bar) {
+	barPool.Put(b)
+}
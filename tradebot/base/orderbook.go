@@ -0,0 +1,146 @@
+package base
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// PriceLevel is the total quantity resting at one price
+type PriceLevel struct {
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+// OrderBookView is a copy of the best levels of an OrderBook, safe to keep
+type OrderBookView struct {
+	Symbol   string
+	UpdateID int64
+	// Time 最后一次更新的交易所事件时间 (ms)
+	Time int64
+	Bids []PriceLevel
+	Asks []PriceLevel
+}
+
+// OrderBook is a local L2 order book maintained from a snapshot and diff updates.
+// It is safe for concurrent use.
+type OrderBook struct {
+	Symbol string
+
+	mu       sync.RWMutex
+	updateID int64
+	time     int64
+	bids     []PriceLevel // 价格从高到低
+	asks     []PriceLevel // 价格从低到高
+}
+
+func NewOrderBook(symbol string) *OrderBook {
+	return &OrderBook{Symbol: symbol}
+}
+
+// Reset replaces the whole book with a snapshot
+func (b *OrderBook) Reset(updateID int64, time int64, bids, asks []PriceLevel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updateID = updateID
+	b.time = time
+	b.bids = b.bids[:0]
+	b.asks = b.asks[:0]
+	for _, level := range bids {
+		b.bids = setLevel(b.bids, level, true)
+	}
+	for _, level := range asks {
+		b.asks = setLevel(b.asks, level, false)
+	}
+}
+
+// Update applies a diff update, a level with zero quantity is removed
+func (b *OrderBook) Update(updateID int64, time int64, bids, asks []PriceLevel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updateID = updateID
+	b.time = time
+	for _, level := range bids {
+		b.bids = setLevel(b.bids, level, true)
+	}
+	for _, level := range asks {
+		b.asks = setLevel(b.asks, level, false)
+	}
+}
+
+// UpdateID returns the update ID of the last snapshot or update applied
+func (b *OrderBook) UpdateID() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.updateID
+}
+
+// BestBid returns the highest bid, ok is false if there is none
+func (b *OrderBook) BestBid() (PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.bids) == 0 {
+		return PriceLevel{}, false
+	}
+	return b.bids[0], true
+}
+
+// BestAsk returns the lowest ask, ok is false if there is none
+func (b *OrderBook) BestAsk() (PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.asks) == 0 {
+		return PriceLevel{}, false
+	}
+	return b.asks[0], true
+}
+
+// Depth returns a copy of the best n levels of each side, n <= 0 returns all levels
+func (b *OrderBook) Depth(n int) *OrderBookView {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	view := &OrderBookView{
+		Symbol:   b.Symbol,
+		UpdateID: b.updateID,
+		Time:     b.time,
+	}
+	view.Bids = append([]PriceLevel(nil), topLevels(b.bids, n)...)
+	view.Asks = append([]PriceLevel(nil), topLevels(b.asks, n)...)
+	return view
+}
+
+func topLevels(levels []PriceLevel, n int) []PriceLevel {
+	if n <= 0 || n > len(levels) {
+		return levels
+	}
+	return levels[:n]
+}
+
+// setLevel inserts, replaces or removes level in a sorted side of the book
+func setLevel(levels []PriceLevel, level PriceLevel, descending bool) []PriceLevel {
+	i := sort.Search(len(levels), func(i int) bool {
+		if descending {
+			return levels[i].Price.Cmp(level.Price) <= 0
+		}
+		return levels[i].Price.Cmp(level.Price) >= 0
+	})
+	found := i < len(levels) && levels[i].Price.Equal(level.Price)
+
+	switch {
+	case level.Quantity.Sign() <= 0:
+		if found {
+			levels = append(levels[:i], levels[i+1:]...)
+		}
+	case found:
+		levels[i].Quantity = level.Quantity
+	default:
+		levels = append(levels, PriceLevel{})
+		copy(levels[i+1:], levels[i:])
+		levels[i] = level
+	}
+	return levels
+}
@@ -0,0 +1,69 @@
+package base
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrRateLimited is returned for requests a RateLimiter rejects instead of sending
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimiter throttles the requests of a Client
+type RateLimiter interface {
+	// Acquire blocks until req may be sent, or returns an error wrapping ErrRateLimited
+	// if it would have to wait too long
+	Acquire(req *http.Request) error
+	// Observe syncs the limiter with the status and headers of the response to req
+	Observe(req *http.Request, resp *http.Response)
+}
+
+// WindowBucket counts usage within fixed windows aligned to the clock, the way exchanges
+// count request weight and orders per minute / per 10 seconds
+type WindowBucket struct {
+	Limit  int
+	Window time.Duration
+
+	start time.Time
+	used  int
+}
+
+// NewWindowBucket creates a bucket allowing limit units per window
+func NewWindowBucket(limit int, window time.Duration) *WindowBucket {
+	return &WindowBucket{Limit: limit, Window: window}
+}
+
+func (b *WindowBucket) roll(now time.Time) {
+	if start := now.Truncate(b.Window); !start.Equal(b.start) {
+		b.start = start
+		b.used = 0
+	}
+}
+
+// Wait returns how long to wait before n more units fit into the bucket, 0 if they fit now
+func (b *WindowBucket) Wait(n int, now time.Time) time.Duration {
+	b.roll(now)
+	if b.used+n <= b.Limit {
+		return 0
+	}
+	return b.start.Add(b.Window).Sub(now)
+}
+
+// Take counts n units in the current window
+func (b *WindowBucket) Take(n int, now time.Time) {
+	b.roll(now)
+	b.used += n
+}
+
+// Sync adopts the usage the server reports for the current window. 本地计数包含尚未被服务端
+// 计入的在途请求，所以只取较大值
+func (b *WindowBucket) Sync(used int, now time.Time) {
+	b.roll(now)
+	b.used = max(b.used, used)
+}
+
+// Used returns the usage of the current window
+func (b *WindowBucket) Used(now time.Time) int {
+	b.roll(now)
+	return b.used
+}
@@ -0,0 +1,80 @@
+package base
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// ReconnectPolicy decides how long WSClient waits before each reconnect attempt
+type ReconnectPolicy interface {
+	// NextDelay returns the wait before attempt (starting at 0), ok is false once the policy gives up
+	NextDelay(attempt int) (delay time.Duration, ok bool)
+}
+
+// ExponentialJitterPolicy doubles the delay on every attempt up to MaxDelay and
+// randomises it by Jitter, so that many connections don't reconnect in lockstep
+type ExponentialJitterPolicy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetries 最大重连次数，<= 0 表示不限次数
+	MaxRetries int
+	// Jitter 随机扰动的比例 [0, 1]，实际等待时间在 [delay*(1-Jitter), delay] 之间
+	Jitter float64
+}
+
+func (p *ExponentialJitterPolicy) NextDelay(attempt int) (time.Duration, bool) {
+	if p.MaxRetries > 0 && attempt >= p.MaxRetries {
+		return 0, false
+	}
+
+	delay := p.MaxDelay
+	// 避免移位溢出，超过 30 次必然已经到达上限
+	if attempt < 30 {
+		if d := p.BaseDelay << uint(attempt); d < p.MaxDelay || p.MaxDelay <= 0 {
+			delay = d
+		}
+	}
+	return withJitter(delay, p.Jitter), true
+}
+
+// InfiniteRetryPolicy retries forever with a fixed, jittered delay
+type InfiniteRetryPolicy struct {
+	Delay  time.Duration
+	Jitter float64
+}
+
+func (p *InfiniteRetryPolicy) NextDelay(attempt int) (time.Duration, bool) {
+	return withJitter(p.Delay, p.Jitter), true
+}
+
+func withJitter(delay time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	jitter = min(jitter, 1)
+	return delay - time.Duration(float64(delay)*jitter*rand.Float64())
+}
+
+// ConnectionState is a websocket connection lifecycle state
+type ConnectionState string
+
+const (
+	ConnectionStateConnecting   ConnectionState = "CONNECTING"
+	ConnectionStateConnected    ConnectionState = "CONNECTED"
+	ConnectionStateDisconnected ConnectionState = "DISCONNECTED"
+	ConnectionStateResubscribed ConnectionState = "RESUBSCRIBED"
+	ConnectionStateRotated      ConnectionState = "ROTATED"
+	ConnectionStateGaveUp       ConnectionState = "GAVE_UP"
+)
+
+// ConnectionStateEvent is emitted by WSClient on every state transition
+type ConnectionStateEvent struct {
+	Conn    string
+	State   ConnectionState
+	Attempt int
+	Err     error
+	Time    time.Time
+}
+
+// StateHandler receives connection state events
+type StateHandler func(event ConnectionStateEvent)
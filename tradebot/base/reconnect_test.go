@@ -0,0 +1,52 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialJitterPolicy(t *testing.T) {
+	p := &ExponentialJitterPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, MaxRetries: 6, Jitter: 0.2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for attempt, max := range want {
+		for i := 0; i < 100; i++ {
+			delay, ok := p.NextDelay(attempt)
+			// 扰动只会缩短等待，范围 [delay*(1-Jitter), delay]
+			if !ok || delay > max || delay < max-max/5 {
+				t.Fatalf("attempt %d: delay %v ok %v, want within [%v, %v]", attempt, delay, ok, max-max/5, max)
+			}
+		}
+	}
+	if _, ok := p.NextDelay(len(want)); ok {
+		t.Fatalf("policy retried after %d attempts", p.MaxRetries)
+	}
+
+	// MaxRetries 为 0 时不限次数，移位不会溢出
+	p.MaxRetries, p.Jitter = 0, 0
+	for _, attempt := range []int{10, 63, 1000} {
+		if delay, ok := p.NextDelay(attempt); !ok || delay != p.MaxDelay {
+			t.Fatalf("attempt %d: delay %v ok %v", attempt, delay, ok)
+		}
+	}
+}
+
+func TestInfiniteRetryPolicy(t *testing.T) {
+	p := &InfiniteRetryPolicy{Delay: time.Second, Jitter: 0.5}
+	for _, attempt := range []int{0, 1, 100, 1 << 20} {
+		if delay, ok := p.NextDelay(attempt); !ok || delay > time.Second || delay < time.Second/2 {
+			t.Fatalf("attempt %d: delay %v ok %v", attempt, delay, ok)
+		}
+	}
+}
+
+func TestDefaultReconnectPolicyUnlimited(t *testing.T) {
+	client, err := NewWSClient("ws://test", func(message []byte, event string, receivedAt time.Time) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delay, ok := client.reconnectPolicy.NextDelay(1000); !ok || delay > 5*time.Minute {
+		t.Fatalf("default policy: delay %v ok %v", delay, ok)
+	}
+}
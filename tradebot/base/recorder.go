@@ -0,0 +1,456 @@
+package base
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// 原始帧录制与回放：录制 messageLoop 收到的每一帧，离线按原速、倍速或最快速度
+// 重新送入同一条处理路径，逐字节复现线上问题。
+//
+// 文件为 gzip 压缩的追加写文件，以 frameFileMagic 开头，之后每条记录依次为
+// uvarint 连接名长度、连接名、varint 墙上时间 (ns)、varint 单调时钟偏移 (ns)、
+// uvarint 帧长度、帧原始字节。
+
+const (
+	frameFileMagic  = "TBFRAMES1\n"
+	frameFileSuffix = ".frames.gz"
+	// defaultRecordRotateBytes 单个文件未压缩数据的默认上限
+	defaultRecordRotateBytes = 256 << 20
+	// recordQueueSize 录制队列长度，队列满时 Record 阻塞而不是丢帧
+	recordQueueSize = 4096
+	// recordFlushInterval 录制文件的落盘周期
+	recordFlushInterval = time.Second
+)
+
+// Frame is one recorded websocket frame
+type Frame struct {
+	// Conn identifies the connection the frame arrived on, "name/sequence"
+	Conn string
+	// Wall is the local wall clock receive time
+	Wall time.Time
+	// Mono is the monotonic receive time, relative to the start of the recording
+	Mono time.Duration
+	Data []byte
+}
+
+// FrameRecorder writes frames to rotating, compressed, append-only files
+type FrameRecorder struct {
+	dir         string
+	prefix      string
+	rotateBytes int64
+	start       time.Time
+
+	// mu 保护 closed：连接的读循环可能在 Close 之后仍在录制最后一帧
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Frame
+	done   chan struct{}
+	err    error
+
+	file    *os.File
+	gz      *gzip.Writer
+	w       *bufio.Writer
+	written int64
+	buf     []byte
+}
+
+// NewFrameRecorder creates a recorder writing "<prefix>-<time>.frames.gz" files in dir,
+// rotateBytes is the uncompressed size after which a new file is started (0 for the default)
+func NewFrameRecorder(dir string, prefix string, rotateBytes int64) (*FrameRecorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record dir: %w", err)
+	}
+	if rotateBytes <= 0 {
+		rotateBytes = defaultRecordRotateBytes
+	}
+
+	r := &FrameRecorder{
+		dir:         dir,
+		prefix:      prefix,
+		rotateBytes: rotateBytes,
+		start:       time.Now(),
+		queue:       make(chan Frame, recordQueueSize),
+		done:        make(chan struct{}),
+	}
+	if err := r.openFile(); err != nil {
+		return nil, err
+	}
+
+	go r.writeLoop()
+	return r, nil
+}
+
+// Record queues a copy of data, received at receivedAt on conn. Frames recorded
+// after Close are dropped.
+func (r *FrameRecorder) Record(conn string, data []byte, receivedAt time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+
+	frame := Frame{
+		Conn: conn,
+		Wall: receivedAt,
+		Mono: receivedAt.Sub(r.start),
+		Data: append([]byte(nil), data...),
+	}
+	select {
+	case r.queue <- frame:
+	case <-r.done:
+	}
+}
+
+// Close flushes the queued frames and closes the current file
+func (r *FrameRecorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+	return r.err
+}
+
+func (r *FrameRecorder) writeLoop() {
+	defer close(r.done)
+
+	// 定时落盘，进程崩溃时最多丢失最近一个周期的数据
+	ticker := time.NewTicker(recordFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame, ok := <-r.queue:
+			if !ok {
+				if err := r.closeFile(); err != nil && r.err == nil {
+					r.err = err
+				}
+				return
+			}
+			r.fail(r.write(&frame))
+		case <-ticker.C:
+			r.fail(r.flush())
+		}
+	}
+}
+
+// fail stops recording on the first error, later frames are dropped
+func (r *FrameRecorder) fail(err error) {
+	if err != nil && r.err == nil {
+		log.Errorf("Frame recorder stopped: %v", err)
+		r.err = err
+	}
+}
+
+func (r *FrameRecorder) write(frame *Frame) error {
+	if r.err != nil {
+		return nil
+	}
+
+	buf := r.buf[:0]
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Conn)))
+	buf = append(buf, frame.Conn...)
+	buf = binary.AppendVarint(buf, frame.Wall.UnixNano())
+	buf = binary.AppendVarint(buf, int64(frame.Mono))
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Data)))
+	buf = append(buf, frame.Data...)
+	r.buf = buf
+
+	if _, err := r.w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	r.written += int64(len(buf))
+
+	if r.written >= r.rotateBytes {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+		return r.openFile()
+	}
+	return nil
+}
+
+func (r *FrameRecorder) flush() error {
+	if r.err != nil || r.file == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush frames: %w", err)
+	}
+	if err := r.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to flush frames: %w", err)
+	}
+	return nil
+}
+
+func (r *FrameRecorder) openFile() error {
+	name := fmt.Sprintf("%s-%s%s", r.prefix, time.Now().UTC().Format("20060102T150405.000000000"), frameFileSuffix)
+	file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create record file: %w", err)
+	}
+
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.w = bufio.NewWriter(r.gz)
+	r.written = 0
+	if _, err := r.w.WriteString(frameFileMagic); err != nil {
+		return fmt.Errorf("failed to write record header: %w", err)
+	}
+	log.Infof("Recording frames to %s", file.Name())
+	return nil
+}
+
+func (r *FrameRecorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	defer func() {
+		r.file = nil
+	}()
+
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("failed to flush frames: %w", err)
+	}
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("failed to close record file: %w", err)
+	}
+	return r.file.Close()
+}
+
+// RecordedFiles lists the record files of prefix in dir in recording order
+func RecordedFiles(dir string, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list record dir: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, prefix+"-") && strings.HasSuffix(name, frameFileSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// 文件名中的时间戳定长，字典序即录制顺序
+	sort.Strings(files)
+	return files, nil
+}
+
+// FrameReader reads recorded frames from a sequence of files
+type FrameReader struct {
+	files []string
+	file  *os.File
+	gz    *gzip.Reader
+	r     *bufio.Reader
+	frame Frame
+}
+
+// OpenFrameReader reads the frames of files in order, see RecordedFiles
+func OpenFrameReader(files ...string) (*FrameReader, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no record files")
+	}
+	return &FrameReader{files: files}, nil
+}
+
+// Next returns the next frame, or io.EOF after the last file. The frame and its
+// data are only valid until the next call.
+func (fr *FrameReader) Next() (*Frame, error) {
+	for {
+		if fr.r == nil {
+			if len(fr.files) == 0 {
+				return nil, io.EOF
+			}
+			if err := fr.openNext(); err != nil {
+				return nil, err
+			}
+		}
+
+		err := fr.readFrame()
+		if err == nil {
+			return &fr.frame, nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		if err := fr.closeFile(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close closes the file being read
+func (fr *FrameReader) Close() error {
+	fr.files = nil
+	return fr.closeFile()
+}
+
+func (fr *FrameReader) openNext() error {
+	name := fr.files[0]
+	fr.files = fr.files[1:]
+
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open record file: %w", err)
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open record file %s: %w", name, err)
+	}
+	r := bufio.NewReader(gz)
+
+	magic := make([]byte, len(frameFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != frameFileMagic {
+		gz.Close()
+		file.Close()
+		return fmt.Errorf("%s is not a frame record file", name)
+	}
+
+	fr.file, fr.gz, fr.r = file, gz, r
+	return nil
+}
+
+func (fr *FrameReader) closeFile() error {
+	if fr.file == nil {
+		return nil
+	}
+	fr.gz.Close()
+	err := fr.file.Close()
+	fr.file, fr.gz, fr.r = nil, nil, nil
+	return err
+}
+
+// readFrame reads one record, io.EOF means the file ended cleanly
+func (fr *FrameReader) readFrame() error {
+	connLen, err := binary.ReadUvarint(fr.r)
+	if err != nil {
+		// 录制进程崩溃时文件末尾可能不完整，视为文件结束
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read frame: %w", err)
+	}
+
+	conn := make([]byte, connLen)
+	if _, err := io.ReadFull(fr.r, conn); err != nil {
+		return truncated(err)
+	}
+	wall, err := binary.ReadVarint(fr.r)
+	if err != nil {
+		return truncated(err)
+	}
+	mono, err := binary.ReadVarint(fr.r)
+	if err != nil {
+		return truncated(err)
+	}
+	dataLen, err := binary.ReadUvarint(fr.r)
+	if err != nil {
+		return truncated(err)
+	}
+	if uint64(cap(fr.frame.Data)) < dataLen {
+		fr.frame.Data = make([]byte, dataLen)
+	}
+	fr.frame.Data = fr.frame.Data[:dataLen]
+	if _, err := io.ReadFull(fr.r, fr.frame.Data); err != nil {
+		return truncated(err)
+	}
+
+	if fr.frame.Conn != string(conn) {
+		fr.frame.Conn = string(conn)
+	}
+	fr.frame.Wall = time.Unix(0, wall)
+	fr.frame.Mono = time.Duration(mono)
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Warnf("Record file ends with a truncated frame")
+		return io.EOF
+	}
+	return fmt.Errorf("failed to read frame: %w", err)
+}
+
+// ReplayMaxSpeed replays frames as fast as possible
+const ReplayMaxSpeed = 0
+
+// Replayer feeds recorded frames back through a WSClient's message handling
+type Replayer struct {
+	// Speed 回放倍速，1 为原速，ReplayMaxSpeed 表示不等待
+	Speed float64
+}
+
+func NewReplayer(speed float64) *Replayer {
+	return &Replayer{Speed: speed}
+}
+
+// Replay feeds every frame of reader to client as if it was read from its connection,
+// keeping the recorded spacing divided by Speed. It returns the number of frames replayed.
+func (p *Replayer) Replay(ctx context.Context, reader *FrameReader, client *WSClient) (int, error) {
+	var (
+		count    int
+		started  time.Time
+		elapsed  time.Duration
+		prevMono time.Duration
+		prevWall time.Time
+	)
+
+	for {
+		frame, err := reader.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if p.Speed > 0 {
+			if count == 0 {
+				started = time.Now()
+			} else {
+				gap := frame.Mono - prevMono
+				if gap < 0 {
+					// 新的录制会话，单调时钟重新计数，退回墙上时间
+					gap = max(frame.Wall.Sub(prevWall), 0)
+				}
+				elapsed += gap
+			}
+			if wait := time.Until(started.Add(time.Duration(float64(elapsed) / p.Speed))); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return count, ctx.Err()
+				}
+			}
+			prevMono, prevWall = frame.Mono, frame.Wall
+		} else if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		// 接收时间取录制时刻，回放结果不依赖回放时的墙上时间
+		if err := client.handleMessage(frame.Data, frame.Wall); err != nil {
+			log.Errorf("Message handling error: %v", err)
+		}
+		count++
+	}
+}
@@ -0,0 +1,64 @@
+package base
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+func TestMain(m *testing.M) {
+	logPath, err := os.MkdirTemp("", "base-test-log")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(log.WithLogPath(logPath), log.WithConsole(false))
+	code := m.Run()
+	os.RemoveAll(logPath)
+	os.Exit(code)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewFrameRecorder(dir, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wall := time.Now().Add(-time.Hour).Round(0)
+	recorder.Record("conn#0/1", []byte(`{"e":"trade","t":1}`), wall)
+	recorder.Record("conn#0/1", []byte(`{"e":"trade","t":2}`), wall.Add(time.Millisecond))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 读循环可能在 Close 之后才录制最后一帧
+	recorder.Record("conn#0/1", []byte(`{"e":"trade","t":3}`), wall.Add(2*time.Millisecond))
+
+	files, err := RecordedFiles(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenFrameReader(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var received []time.Time
+	client, err := NewWSClient("ws://replay", func(message []byte, event string, receivedAt time.Time) error {
+		received = append(received, receivedAt)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewReplayer(ReplayMaxSpeed).Replay(context.Background(), reader, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回放使用录制时的接收时间
+	if n != 2 || !received[0].Equal(wall) || !received[1].Equal(wall.Add(time.Millisecond)) {
+		t.Fatalf("replayed %d frames at %v", n, received)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"time"
 )
@@ -15,6 +16,8 @@ type Client struct {
 	ApiKey    string
 	SecretKey string
 	client    *http.Client
+	// Limiter 为 nil 时不限速
+	Limiter RateLimiter
 }
 
 // NewClient creates a new Binance API client
@@ -46,13 +49,31 @@ func (c *Client) BuildRequest(method, endpoint, queryString string) (*http.Reque
 	return req, nil
 }
 
+// BuildBodyRequest creates an HTTP request carrying body as a form-encoded request body
+func (c *Client) BuildBodyRequest(method, endpoint, body string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.baseURL+endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
 // sendRequest sends an HTTP request and decodes the response into the result interface
 func (c *Client) SendRequest(req *http.Request, result interface{}) error {
+	if c.Limiter != nil {
+		if err := c.Limiter.Acquire(req); err != nil {
+			return err
+		}
+	}
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	if c.Limiter != nil {
+		c.Limiter.Observe(req, resp)
+	}
 
 	// Check if the status code indicates an error
 	if resp.StatusCode != http.StatusOK {
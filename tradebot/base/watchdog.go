@@ -0,0 +1,164 @@
+package base
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// StaleEvent is raised when a stream has been silent for longer than its threshold.
+// Count is the number of consecutive alerts since the stream last delivered data.
+type StaleEvent struct {
+	Stream  string
+	Silence time.Duration
+	Count   int
+	Time    time.Time
+}
+
+// StaleHandler receives staleness alerts
+type StaleHandler func(event StaleEvent)
+
+type streamClock struct {
+	threshold time.Duration
+	last      atomic.Int64 // unix nano of the last message
+	alertedAt time.Time    // guarded by StalenessWatchdog.mu
+	count     int          // guarded by StalenessWatchdog.mu
+}
+
+// StalenessWatchdog tracks the last message time of every stream and raises an
+// alert when one goes quiet, also for half-open connections where others still flow
+type StalenessWatchdog struct {
+	mu       sync.Mutex
+	streams  map[string]*streamClock
+	interval time.Duration
+	onStale  StaleHandler
+
+	running   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStalenessWatchdog creates a watchdog that checks all streams every interval
+func NewStalenessWatchdog(interval time.Duration, onStale StaleHandler) *StalenessWatchdog {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &StalenessWatchdog{
+		streams:  make(map[string]*streamClock),
+		interval: interval,
+		onStale:  onStale,
+		done:     make(chan struct{}),
+	}
+}
+
+// Track starts watching a stream, a threshold <= 0 leaves it unwatched
+func (w *StalenessWatchdog) Track(stream string, threshold time.Duration) {
+	if threshold <= 0 {
+		return
+	}
+	clock := &streamClock{threshold: threshold}
+	clock.last.Store(time.Now().UnixNano())
+
+	w.mu.Lock()
+	w.streams[stream] = clock
+	w.mu.Unlock()
+}
+
+// Untrack stops watching a stream
+func (w *StalenessWatchdog) Untrack(stream string) {
+	w.mu.Lock()
+	delete(w.streams, stream)
+	w.mu.Unlock()
+}
+
+// Touch records that a message of the stream arrived, it is called for every message
+func (w *StalenessWatchdog) Touch(stream string) {
+	w.mu.Lock()
+	clock, ok := w.streams[stream]
+	w.mu.Unlock()
+
+	if ok {
+		clock.last.Store(time.Now().UnixNano())
+	}
+}
+
+// Silent reports whether a tracked stream has been quiet for at least its threshold,
+// untracked streams are never silent
+func (w *StalenessWatchdog) Silent(stream string) bool {
+	w.mu.Lock()
+	clock, ok := w.streams[stream]
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+	return time.Since(time.Unix(0, clock.last.Load())) >= clock.threshold
+}
+
+// Start runs the check loop until Stop is called
+func (w *StalenessWatchdog) Start() {
+	if !w.running.CompareAndSwap(false, true) {
+		return
+	}
+	go w.loop()
+}
+
+// Stop ends the check loop
+func (w *StalenessWatchdog) Stop() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+func (w *StalenessWatchdog) loop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			for _, event := range w.check(now) {
+				log.Errorf("Stream %s silent for %v (alert %d)", event.Stream, event.Silence, event.Count)
+				if w.onStale != nil {
+					w.onStale(event)
+				}
+			}
+		}
+	}
+}
+
+// check collects the streams that went stale, alerting again once per threshold while they stay silent
+func (w *StalenessWatchdog) check(now time.Time) []StaleEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var events []StaleEvent
+	for stream, clock := range w.streams {
+		last := time.Unix(0, clock.last.Load())
+		silence := now.Sub(last)
+		if silence < clock.threshold {
+			if clock.count > 0 {
+				log.Infof("Stream %s recovered after %d alerts", stream, clock.count)
+			}
+			clock.count = 0
+			clock.alertedAt = time.Time{}
+			continue
+		}
+		if !clock.alertedAt.IsZero() && now.Sub(clock.alertedAt) < clock.threshold {
+			continue
+		}
+
+		clock.count++
+		clock.alertedAt = now
+		events = append(events, StaleEvent{
+			Stream:  stream,
+			Silence: silence,
+			Count:   clock.count,
+			Time:    now,
+		})
+	}
+	return events
+}
@@ -1,6 +1,7 @@
 package base
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -21,24 +22,78 @@ const (
 	connectingState
 )
 
-type MessageHandler func(message map[string]interface{}) error
+// MessageHandler receives the raw frame together with its event type ("e" field),
+// which is empty for frames without one such as combined stream envelopes, and the
+// local time the frame was read from the socket. message is only valid during the call.
+type MessageHandler func(message []byte, event string, receivedAt time.Time) error
+
+// WSError is the error frame the exchange returns for a rejected request
+//
+//	{"error": {"code": 2, "msg": "Invalid request: unknown stream"}, "id": 3}
+type WSError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *WSError) Error() string {
+	return fmt.Sprintf("websocket error: code=%d, message=%s", e.Code, e.Msg)
+}
+
+// wsResponse is the outcome of a request, matched to it by SubscribeMsg.ID
+type wsResponse struct {
+	result json.RawMessage
+	err    error
+}
+
+// wsAck is the ack or error frame of a request
+type wsAck struct {
+	Result json.RawMessage `json:"result"`
+	Error  *WSError        `json:"error"`
+	ID     *int64          `json:"id"`
+}
+
+const (
+	// defaultAckTimeout bounds how long a request waits for its ack when ctx has no deadline
+	defaultAckTimeout = 10 * time.Second
+	// resubscribeBatch is the number of streams sent per SUBSCRIBE after a reconnect
+	resubscribeBatch = 100
+	// defaultRotationOverlap is how long the old and the new connection both deliver data during a rotation
+	defaultRotationOverlap = 3 * time.Second
+	// rotationRetryWait is the wait before retrying a failed rotation
+	rotationRetryWait = time.Minute
+)
 
 // WSClient represents a WebSocket client
 type WSClient struct {
-	url        string
-	handler    MessageHandler
-	done       chan struct{}
-	status     atomic.Uint32
-	mu         sync.RWMutex
-	conn       *websocket.Conn
-	maxRetries int
+	url     string
+	handler MessageHandler
+	done    chan struct{}
+	status  atomic.Uint32
+	mu      sync.RWMutex
+	conn    *websocket.Conn
+	name    string
+
+	// 连接存活上限，到期前主动切换到新连接，切换时新旧连接同时接收 rotationOverlap
+	maxConnAge      time.Duration
+	rotationOverlap time.Duration
+
+	// recorder 录制每条连接收到的原始帧，connSeq 为连接编号
+	recorder *FrameRecorder
+	connSeq  atomic.Uint64
 
 	// Add reconnection configuration
-	reconnectWait     time.Duration
+	reconnectPolicy   ReconnectPolicy
 	reconnectAttempt  int
+	stateHandler      StateHandler
 	SubscribedStreams []string
-	limiter           *rate.Limiter // Rate limiter for resubscription
+	subMu             sync.RWMutex  // guards SubscribedStreams
+	limiter           *rate.Limiter // Rate limiter for outgoing control messages
 	closeOnce         sync.Once
+
+	// Pending requests waiting for their ack, keyed by request ID
+	nextID     atomic.Int64
+	pending    sync.Map // map[int64]chan wsResponse
+	ackTimeout time.Duration
 }
 
 // NewWSClient creates a new WebSocket client with improved configuration
@@ -51,12 +106,19 @@ func NewWSClient(url string, handler MessageHandler) (*WSClient, error) {
 	}
 
 	client := &WSClient{
-		url:           url,
-		handler:       handler,
-		done:          make(chan struct{}),
-		maxRetries:    5,
-		reconnectWait: 5 * time.Second,
-		limiter:       rate.NewLimiter(rate.Every(300*time.Millisecond), 1),
+		url:             url,
+		handler:         handler,
+		done:            make(chan struct{}),
+		name:            url,
+		limiter:         rate.NewLimiter(rate.Every(300*time.Millisecond), 1),
+		ackTimeout:      defaultAckTimeout,
+		rotationOverlap: defaultRotationOverlap,
+		// 行情连接不应放弃重连，默认不限次数
+		reconnectPolicy: &ExponentialJitterPolicy{
+			BaseDelay: 5 * time.Second,
+			MaxDelay:  5 * time.Minute,
+			Jitter:    0.2,
+		},
 	}
 
 	// Initialize the atomic status
@@ -65,6 +127,85 @@ func NewWSClient(url string, handler MessageHandler) (*WSClient, error) {
 	return client, nil
 }
 
+// SetName sets the connection name used in logs and state events, defaults to the url
+func (c *WSClient) SetName(name string) {
+	c.name = name
+}
+
+// SetRecorder records every frame read from the connection, call it before Connect
+func (c *WSClient) SetRecorder(recorder *FrameRecorder) {
+	c.recorder = recorder
+}
+
+// SetAckTimeout sets how long requests without a context deadline wait for their ack
+func (c *WSClient) SetAckTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		c.ackTimeout = timeout
+	}
+}
+
+// SetReconnectPolicy replaces the default policy (unlimited attempts, exponential backoff from 5s to 5m)
+func (c *WSClient) SetReconnectPolicy(policy ReconnectPolicy) {
+	if policy == nil {
+		return
+	}
+	c.mu.Lock()
+	c.reconnectPolicy = policy
+	c.mu.Unlock()
+}
+
+// SetMaxConnAge makes the client replace its connection after age, before the exchange
+// drops it (Binance closes every connection after 24 hours), 0 disables rotation
+func (c *WSClient) SetMaxConnAge(age time.Duration) {
+	c.mu.Lock()
+	c.maxConnAge = age
+	c.mu.Unlock()
+}
+
+// SetRotationOverlap sets how long both connections deliver data during a rotation,
+// defaults to 3s
+func (c *WSClient) SetRotationOverlap(overlap time.Duration) {
+	if overlap <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.rotationOverlap = overlap
+	c.mu.Unlock()
+}
+
+// SetStateHandler registers a callback for connection state transitions
+func (c *WSClient) SetStateHandler(handler StateHandler) {
+	c.mu.Lock()
+	c.stateHandler = handler
+	c.mu.Unlock()
+}
+
+func (c *WSClient) emitState(state ConnectionState, attempt int, err error) {
+	c.mu.RLock()
+	handler := c.stateHandler
+	c.mu.RUnlock()
+
+	if handler == nil {
+		return
+	}
+	handler(ConnectionStateEvent{
+		Conn:    c.name,
+		State:   state,
+		Attempt: attempt,
+		Err:     err,
+		Time:    time.Now(),
+	})
+}
+
+func (c *WSClient) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *WSClient) IsConnected() bool {
 	return c.status.Load() == connectedState
 }
@@ -82,11 +223,37 @@ func (c *WSClient) Connect(ctx context.Context) error {
 	}
 
 	c.status.Store(connectingState)
+	c.emitState(ConnectionStateConnecting, c.reconnectAttempt, nil)
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		c.emitState(ConnectionStateDisconnected, c.reconnectAttempt, err)
+		return err
+	}
 
+	c.mu.Lock()
+	c.conn = conn
+	c.status.Store(connectedState)
+	c.reconnectAttempt = 0
+	c.mu.Unlock()
+
+	go c.messageLoop(ctx, conn)
+	go c.rotateLoop(ctx, conn)
+
+	// 不需要主动发送ping，因为Binance服务器会发送ping
+	// go c.Ping(30 * time.Second)
+
+	log.Infof("Successfully connected to WebSocket at %s", c.url)
+	c.emitState(ConnectionStateConnected, 0, nil)
+	return nil
+}
+
+// dial opens a connection and installs the ping/pong handlers
+func (c *WSClient) dial(ctx context.Context) (*websocket.Conn, error) {
 	dialer := websocket.DefaultDialer
 	conn, _, err := dialer.DialContext(ctx, c.url, nil)
 	if err != nil {
-		return fmt.Errorf("websocket connection failed: %w", err)
+		return nil, fmt.Errorf("websocket connection failed: %w", err)
 	}
 
 	// 设置 Binance ping-pong 处理
@@ -108,27 +275,26 @@ func (c *WSClient) Connect(ctx context.Context) error {
 		return nil
 	})
 
-	c.mu.Lock()
-	c.conn = conn
-	c.status.Store(connectedState)
-	c.reconnectAttempt = 0
-	c.mu.Unlock()
-
-	go c.messageLoop(ctx)
-
-	// 不需要主动发送ping，因为Binance服务器会发送ping
-	// go c.Ping(30 * time.Second)
+	return conn, nil
+}
 
-	log.Infof("Successfully connected to WebSocket at %s", c.url)
-	return nil
+// currentConn returns the connection writes currently go to
+func (c *WSClient) currentConn() *websocket.Conn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
 }
 
 // messageLoop with improved error handling and reconnection logic
-func (c *WSClient) messageLoop(ctx context.Context) {
+func (c *WSClient) messageLoop(ctx context.Context, conn *websocket.Conn) {
 
 	// 设置一个更合理的 read deadline
 	const readTimeout = 1 * time.Minute
 
+	// 每条连接复用一个读缓冲区，handler 拿到的切片只在回调期间有效
+	var buf bytes.Buffer
+	connID := fmt.Sprintf("%s/%d", c.name, c.connSeq.Add(1))
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -139,23 +305,36 @@ func (c *WSClient) messageLoop(ctx context.Context) {
 			return
 		default:
 			// 为每次读取设置新的 deadline
-			c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
 
-			messageType, message, err := c.conn.ReadMessage()
+			messageType, reader, err := conn.NextReader()
+			if err == nil {
+				buf.Reset()
+				_, err = buf.ReadFrom(reader)
+			}
 			if err != nil {
+				// 轮换后被替换掉的旧连接直接退出，不触发重连
+				if c.isClosed() || conn != c.currentConn() {
+					return
+				}
 				log.Errorf("ReadMessage error: %v, messageType: %d", err, messageType)
+				c.emitState(ConnectionStateDisconnected, 0, err)
 				c.tryReconnect()
 				return
 			}
 
-			if err := c.handleMessage(message); err != nil {
+			receivedAt := time.Now()
+			if c.recorder != nil {
+				c.recorder.Record(connID, buf.Bytes(), receivedAt)
+			}
+			if err := c.handleMessage(buf.Bytes(), receivedAt); err != nil {
 				log.Errorf("Message handling error: %v", err)
 			}
 		}
 	}
 }
 
-// tryReconnect implements exponential backoff reconnection
+// tryReconnect reconnects according to the reconnect policy and resubscribes
 func (c *WSClient) tryReconnect() {
 	defer func() {
 		if c.status.Load() != connectedState {
@@ -175,11 +354,24 @@ func (c *WSClient) tryReconnect() {
 	}
 	c.mu.Unlock()
 
-	for c.reconnectAttempt < c.maxRetries {
-		wait := c.reconnectWait * time.Duration(1<<uint(c.reconnectAttempt))
-		log.Infof("Attempting to reconnect in %v (attempt %d/%d)", wait, c.reconnectAttempt+1, c.maxRetries)
+	for {
+		c.mu.RLock()
+		wait, ok := c.reconnectPolicy.NextDelay(c.reconnectAttempt)
+		attempt := c.reconnectAttempt
+		c.mu.RUnlock()
+
+		if !ok {
+			log.Errorf("Max reconnection attempts reached for %s", c.name)
+			c.emitState(ConnectionStateGaveUp, attempt, nil)
+			return
+		}
+		log.Infof("Attempting to reconnect in %v (attempt %d)", wait, attempt+1)
 
-		time.Sleep(wait)
+		select {
+		case <-time.After(wait):
+		case <-c.done:
+			return
+		}
 
 		if err := c.Connect(context.Background()); err == nil {
 			log.Info("Reconnected successfully")
@@ -191,60 +383,311 @@ func (c *WSClient) tryReconnect() {
 		c.mu.Unlock()
 	}
 
-	if c.reconnectAttempt == c.maxRetries {
-		log.Error("Max reconnection attempts reached")
-	} else {
-		// Resubscribe with rate limiting
-		log.Infof("Resubscribing with rate limiting %v", c.SubscribedStreams)
-		for _, subId := range c.SubscribedStreams {
-			// Wait for rate limiter
-			err := c.limiter.Wait(context.Background())
-			if err != nil {
-				log.Errorf("Rate limiter error: %v", err)
-				continue
-			}
+	// Resubscribe in batches, each batch waits for its ack
+	streams := c.Streams()
+	log.Infof("Resubscribing with rate limiting %v", streams)
+	var resubErr error
+	for start := 0; start < len(streams); start += resubscribeBatch {
+		end := min(start+resubscribeBatch, len(streams))
+		batch := streams[start:end]
+		if _, err := c.Request(context.Background(), "SUBSCRIBE", batch); err != nil {
+			log.Errorf("Failed to resubscribe to %v: %v", batch, err)
+			resubErr = err
+		} else {
+			log.Infof("Resubscribed to %v", batch)
+		}
+	}
+	c.emitState(ConnectionStateResubscribed, 0, resubErr)
+}
 
-			err = c.WriteJSON(SubscribeMsg{
-				Method: "SUBSCRIBE",
-				Params: []string{subId},
-				ID:     time.Now().UnixNano(),
-			})
-			if err != nil {
-				log.Errorf("Failed to resubscribe to %s: %v", subId, err)
-			} else {
-				log.Infof("Resubscribed to %s", subId)
-			}
+// rotateLoop replaces conn once it reaches the max connection age, retrying until
+// the rotation succeeds or conn is replaced some other way
+func (c *WSClient) rotateLoop(ctx context.Context, conn *websocket.Conn) {
+	c.mu.RLock()
+	wait := c.maxConnAge
+	c.mu.RUnlock()
+	if wait <= 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		}
+		if conn != c.currentConn() {
+			return
+		}
+
+		err := c.rotate(ctx, conn)
+		if err == nil {
+			return
+		}
+		log.Errorf("Failed to rotate connection %s: %v", c.name, err)
+		wait = rotationRetryWait
+	}
+}
+
+// rotate opens a replacement connection and subscribes it to the same streams. Both
+// connections deliver data for the rotation overlap, duplicates have to be dropped by the
+// handler, then the old connection is closed.
+func (c *WSClient) rotate(ctx context.Context, old *websocket.Conn) error {
+	log.Infof("Rotating connection %s", c.name)
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	go c.messageLoop(ctx, conn)
+
+	streams := c.Streams()
+	for start := 0; start < len(streams); start += resubscribeBatch {
+		end := min(start+resubscribeBatch, len(streams))
+		if _, err := c.request(ctx, conn, "SUBSCRIBE", streams[start:end]); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if c.conn != old {
+		// 轮换期间发生了重连，放弃这条新连接
+		c.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	c.conn = conn
+	overlap := c.rotationOverlap
+	c.mu.Unlock()
+
+	go c.rotateLoop(ctx, conn)
+	c.emitState(ConnectionStateRotated, 0, nil)
+
+	time.AfterFunc(overlap, func() {
+		old.Close()
+		log.Infof("Closed rotated connection %s", c.name)
+	})
+	return nil
+}
+
+// Request sends a SUBSCRIBE/UNSUBSCRIBE/LIST_SUBSCRIPTIONS style request and waits
+// until the exchange acks it, returns the "result" field of the ack. If ctx has no
+// deadline the request times out after the client's ack timeout.
+func (c *WSClient) Request(ctx context.Context, method string, params []string) (json.RawMessage, error) {
+	return c.request(ctx, nil, method, params)
+}
+
+// request sends a request on conn, or on the current connection if conn is nil
+func (c *WSClient) request(ctx context.Context, conn *websocket.Conn, method string, params []string) (json.RawMessage, error) {
+	id := c.nextID.Add(1)
+	ch := make(chan wsResponse, 1)
+	c.pending.Store(id, ch)
+	defer c.pending.Delete(id)
+
+	if err := c.Throttle(ctx); err != nil {
+		return nil, fmt.Errorf("%s %v: rate limiter error: %w", method, params, err)
+	}
+
+	err := c.writeJSON(conn, SubscribeMsg{
+		Method: method,
+		Params: params,
+		ID:     id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s %v: %w", method, params, err)
+	}
+
+	// 超时从发出请求开始计算，不包括限速排队的时间
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ackTimeout)
+		defer cancel()
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.err != nil {
+			return nil, fmt.Errorf("%s %v: %w", method, params, resp.err)
+		}
+		return resp.result, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s %v: waiting for ack: %w", method, params, ctx.Err())
+	}
+}
+
+// Subscribe subscribes to streams and records them for resubscription once the exchange accepts
+func (c *WSClient) Subscribe(ctx context.Context, streams ...string) error {
+	if _, err := c.Request(ctx, "SUBSCRIBE", streams); err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		c.AddStream(stream)
+	}
+	return nil
+}
+
+// Unsubscribe removes streams from the resubscribe set and unsubscribes from them
+func (c *WSClient) Unsubscribe(ctx context.Context, streams ...string) error {
+	for _, stream := range streams {
+		c.RemoveStream(stream)
+	}
+	_, err := c.Request(ctx, "UNSUBSCRIBE", streams)
+	return err
+}
+
+// ListSubscriptions asks the exchange which streams the connection is subscribed to
+func (c *WSClient) ListSubscriptions(ctx context.Context) ([]string, error) {
+	result, err := c.Request(ctx, "LIST_SUBSCRIPTIONS", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []string
+	if err := json.Unmarshal(result, &streams); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions: %w", err)
+	}
+	return streams, nil
+}
+
+// resolve delivers an ack or error frame to the request waiting for it
+func (c *WSClient) resolve(message []byte) {
+	var ack wsAck
+	if err := json.Unmarshal(message, &ack); err != nil {
+		log.Errorf("Failed to parse response %s: %v", message, err)
+		return
+	}
+	if ack.ID == nil {
+		log.Errorf("Received response without request id: %s", message)
+		return
+	}
+
+	resp := wsResponse{result: ack.Result}
+	if ack.Error != nil {
+		resp.err = ack.Error
+	}
+
+	// 取出即删除，重复的确认按未知请求处理，不会阻塞读循环
+	ch, ok := c.pending.LoadAndDelete(*ack.ID)
+	if !ok {
+		log.Infof("Received response for unknown request %d: %s", *ack.ID, message)
+		return
+	}
+	ch.(chan wsResponse) <- resp
+}
+
+// AddStream records a stream so that it is resubscribed after a reconnect
+func (c *WSClient) AddStream(stream string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	for _, s := range c.SubscribedStreams {
+		if s == stream {
+			return
 		}
 	}
+	c.SubscribedStreams = append(c.SubscribedStreams, stream)
 }
 
-// handleMessage processes incoming messages
-func (c *WSClient) handleMessage(message []byte) error {
-	log.Debugf("Received message: %s", string(message))
+// RemoveStream drops a stream from the resubscribe set, reports whether it was present
+func (c *WSClient) RemoveStream(stream string) bool {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
 
-	var raw map[string]interface{}
-	if err := json.Unmarshal(message, &raw); err != nil {
+	for i, s := range c.SubscribedStreams {
+		if s == stream {
+			c.SubscribedStreams = append(c.SubscribedStreams[:i], c.SubscribedStreams[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Streams returns a copy of the subscribed streams
+func (c *WSClient) Streams() []string {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+
+	streams := make([]string, len(c.SubscribedStreams))
+	copy(streams, c.SubscribedStreams)
+	return streams
+}
+
+// StreamCount returns the number of subscribed streams
+func (c *WSClient) StreamCount() int {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return len(c.SubscribedStreams)
+}
+
+// SetMessageRate sets how many control messages per second may be sent on the connection
+func (c *WSClient) SetMessageRate(perSecond int) {
+	if perSecond <= 0 {
+		return
+	}
+	c.limiter.SetLimit(rate.Limit(perSecond))
+}
+
+// Throttle blocks until the connection's outgoing message budget allows another message
+func (c *WSClient) Throttle(ctx context.Context) error {
+	return c.limiter.Wait(ctx)
+}
+
+// handleMessage peeks at the top-level keys of a frame, resolves request acks and
+// passes everything else on together with its event type. Arrays go through as is.
+func (c *WSClient) handleMessage(message []byte, receivedAt time.Time) error {
+	var event []byte
+	isResponse := false
+	err := ObjectEach(message, func(key, value []byte) bool {
+		switch string(key) {
+		case "e":
+			event = value
+		case "result", "error":
+			isResponse = true
+		}
+		return true
+	})
+	if err != nil && err != ErrNotObject {
 		return fmt.Errorf("failed to parse message: %w", err)
 	}
+	// 数组帧 (如 !ticker@arr) 的事件类型取自第一个元素
+	if err == ErrNotObject {
+		if first, ok := FirstElement(message); ok {
+			event, _ = PeekField(first, "e")
+		}
+	}
 
-	// Handle subscription response
-	if _, ok := raw["result"]; ok {
+	// Handle request acks and error frames
+	if isResponse {
+		c.resolve(message)
 		return nil
 	}
 
-	return c.handler(raw)
+	if len(event) == 0 {
+		return c.handler(message, "", receivedAt)
+	}
+	return c.handler(message, Intern(event), receivedAt)
 }
 
 // WriteJSON sends a JSON message through the WebSocket connection
 func (c *WSClient) WriteJSON(v interface{}) error {
+	return c.writeJSON(nil, v)
+}
+
+// writeJSON writes to conn, or to the current connection if conn is nil
+func (c *WSClient) writeJSON(conn *websocket.Conn, v interface{}) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.conn == nil {
+	if conn == nil {
+		conn = c.conn
+	}
+	if conn == nil {
 		return fmt.Errorf("connection is not established")
 	}
 
-	return c.conn.WriteJSON(v)
+	return conn.WriteJSON(v)
 }
 
 // Close closes the WebSocket connection
@@ -252,16 +695,16 @@ func (c *WSClient) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// 使用 sync.Once 安全地关闭 channel，断线重连中的客户端也要能停下来
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
 	if c.status.Load() == disconnectedState {
 		return nil
 	}
 	c.status.Store(disconnectedState)
 
-	// 使用 sync.Once 安全地关闭 channel
-	c.closeOnce.Do(func() {
-		close(c.done)
-	})
-
 	if c.conn != nil {
 		return c.conn.Close()
 	}
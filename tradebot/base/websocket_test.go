@@ -0,0 +1,33 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveDuplicateAck(t *testing.T) {
+	client, err := NewWSClient("ws://test", func(message []byte, event string, receivedAt time.Time) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan wsResponse, 1)
+	client.pending.Store(int64(1), ch)
+
+	// 同一 ID 的第二个确认不能阻塞读循环
+	done := make(chan struct{})
+	go func() {
+		client.resolve([]byte(`{"result":null,"id":1}`))
+		client.resolve([]byte(`{"result":null,"id":1}`))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("duplicate ack blocked resolve")
+	}
+	if len(ch) != 1 {
+		t.Fatalf("got %d responses", len(ch))
+	}
+}
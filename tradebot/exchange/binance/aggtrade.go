@@ -0,0 +1,60 @@
+package binance
+
+import (
+	"sync"
+)
+
+// 历史归集成交与实时流的衔接：
+//  1. 先订阅 aggTrade 流，实时事件暂存在 buffer
+//  2. 通过 REST 按 fromId 翻页发布历史成交，直到追上最新成交
+//  3. 发布 buffer 中 ID 更大的事件后切换为实时，之后 ID 不大于已发布的事件都丢弃
+// 订阅先于 REST 请求建立，REST 最后一页之后的成交一定会出现在流上，衔接处既不重复也不遗漏。
+
+// AggTradeFetcher pages historical aggregate trades, BinanceClient implements it
+type AggTradeFetcher interface {
+	PageAggTrades(symbol string, startTime, endTime int64, fn func(trades []AggTrade) error) (int64, error)
+}
+
+// aggTradeBackfill joins the history of one symbol with its live stream
+type aggTradeBackfill struct {
+	mu     sync.Mutex
+	live   bool
+	lastID int64
+	buffer []AggTrade
+}
+
+func newAggTradeBackfill() *aggTradeBackfill {
+	return &aggTradeBackfill{lastID: -1}
+}
+
+// accept reports whether a live trade should be published now, trades received
+// during the backfill are buffered
+func (b *aggTradeBackfill) accept(trade *AggTrade) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.live {
+		b.buffer = append(b.buffer, *trade)
+		return false
+	}
+	if trade.AggTradeID <= b.lastID {
+		return false
+	}
+	b.lastID = trade.AggTradeID
+	return true
+}
+
+// goLive publishes the buffered trades after lastID, the last historical trade, and
+// lets the live trades through from then on
+func (b *aggTradeBackfill) goLive(lastID int64, publish func(trade *AggTrade)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID = max(b.lastID, lastID)
+	for i := range b.buffer {
+		if trade := &b.buffer[i]; trade.AggTradeID > b.lastID {
+			publish(trade)
+			b.lastID = trade.AggTradeID
+		}
+	}
+	b.buffer = nil
+	b.live = true
+}
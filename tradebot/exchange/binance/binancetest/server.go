@@ -0,0 +1,679 @@
+// Package binancetest provides an in-process Binance websocket server for tests.
+//
+// Server 实现 SUBSCRIBE / UNSUBSCRIBE / LIST_SUBSCRIPTIONS 协议，按订阅推送脚本化的
+// trade / aggTrade / bookTicker / depthUpdate 事件，并支持断线、卡死、畸形帧、延迟与拒绝 ack 等故障注入。
+// /ws/ 下为单条流模式，/stream 为组合流模式，另外提供 REST 深度快照、历史成交与历史归集成交接口。
+package binancetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tradebot_go/tradebot/base"
+	"tradebot_go/tradebot/exchange/binance"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+// Server is a mock Binance market data websocket server
+type Server struct {
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	conns   map[*serverConn]struct{}
+	resume  chan struct{} // closed unless the server is stalled
+	ackWait time.Duration
+	ackErr  *base.WSError
+	depths  map[string]depthSnapshot
+	history map[string][]binance.AggTrade
+	trades  map[string][]binance.HistoricalTrade
+
+	connects atomic.Int64
+	pongs    atomic.Int64
+}
+
+// serverConn is one client connection
+type serverConn struct {
+	ws       *websocket.Conn
+	combined bool
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	streams map[string]bool
+}
+
+// request is a client control message
+type request struct {
+	Method string          `json:"method"`
+	Params []string        `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// NewServer starts a server, pingInterval > 0 makes it ping every connection periodically
+func NewServer(pingInterval time.Duration) *Server {
+	s := &Server{
+		conns:   make(map[*serverConn]struct{}),
+		resume:  make(chan struct{}),
+		depths:  make(map[string]depthSnapshot),
+		history: make(map[string][]binance.AggTrade),
+		trades:  make(map[string][]binance.HistoricalTrade),
+	}
+	close(s.resume)
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, pingInterval)
+	}))
+	return s
+}
+
+// URL returns the raw stream endpoint
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/ws"
+}
+
+// StreamURL returns the combined stream endpoint
+func (s *Server) StreamURL() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/stream"
+}
+
+// HTTPURL returns the REST endpoint
+func (s *Server) HTTPURL() string {
+	return s.srv.URL
+}
+
+// Config returns a websocket config pointing at the server, with fast reconnects
+func (s *Server) Config(combined bool) *base.WSConfig {
+	config := &base.WSConfig{
+		URL:                s.URL(),
+		CombinedStream:     combined,
+		ReconnectBaseDelay: 10 * time.Millisecond,
+		ReconnectMaxDelay:  100 * time.Millisecond,
+	}
+	if combined {
+		config.URL = s.StreamURL()
+	}
+	return config
+}
+
+// OverrideURLs points every account type's websocket and REST endpoints at the server,
+// the returned function restores the previous endpoints
+func (s *Server) OverrideURLs() (restore func()) {
+	raw := make(map[binance.BinanceAccountType]string, len(binance.BinanceWebSocketURLs))
+	combined := make(map[binance.BinanceAccountType]string, len(binance.BinanceCombinedStreamURLs))
+	rest := make(map[binance.BinanceAccountType]string, len(binance.BinanceHttpURLs))
+	for accountType, url := range binance.BinanceWebSocketURLs {
+		raw[accountType] = url
+		binance.BinanceWebSocketURLs[accountType] = s.URL()
+	}
+	for accountType, url := range binance.BinanceCombinedStreamURLs {
+		combined[accountType] = url
+		binance.BinanceCombinedStreamURLs[accountType] = s.StreamURL()
+	}
+	for accountType, url := range binance.BinanceHttpURLs {
+		rest[accountType] = url
+		binance.BinanceHttpURLs[accountType] = s.HTTPURL()
+	}
+	return func() {
+		for accountType, url := range rest {
+			binance.BinanceHttpURLs[accountType] = url
+		}
+		for accountType, url := range raw {
+			binance.BinanceWebSocketURLs[accountType] = url
+		}
+		for accountType, url := range combined {
+			binance.BinanceCombinedStreamURLs[accountType] = url
+		}
+	}
+}
+
+// Close drops every connection and stops the server
+func (s *Server) Close() {
+	s.Resume()
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// Connections returns the number of open connections
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// ConnectCount returns the number of connections accepted so far
+func (s *Server) ConnectCount() int {
+	return int(s.connects.Load())
+}
+
+// PongCount returns the number of pongs received so far
+func (s *Server) PongCount() int {
+	return int(s.pongs.Load())
+}
+
+// Subscriptions returns the streams subscribed on any connection, sorted
+func (s *Server) Subscriptions() []string {
+	set := make(map[string]bool)
+	for _, c := range s.connections() {
+		c.mu.Lock()
+		for stream := range c.streams {
+			set[stream] = true
+		}
+		c.mu.Unlock()
+	}
+
+	streams := make([]string, 0, len(set))
+	for stream := range set {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// StreamCounts returns the number of streams subscribed on each open connection, sorted
+func (s *Server) StreamCounts() []int {
+	var counts []int
+	for _, c := range s.connections() {
+		c.mu.Lock()
+		counts = append(counts, len(c.streams))
+		c.mu.Unlock()
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// SetAckDelay delays every response to a control message
+func (s *Server) SetAckDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ackWait = d
+}
+
+// RejectRequests answers every control message with err, nil accepts them again
+func (s *Server) RejectRequests(err *base.WSError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ackErr = err
+}
+
+// Stall stops reading from and writing to every connection until Resume, the
+// connections stay open
+func (s *Server) Stall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.resume:
+		s.resume = make(chan struct{})
+	default:
+	}
+}
+
+// Resume ends a Stall
+func (s *Server) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.resume:
+	default:
+		close(s.resume)
+	}
+}
+
+// DropConnections closes every connection abruptly, without a close frame
+func (s *Server) DropConnections() {
+	for _, c := range s.connections() {
+		c.ws.UnderlyingConn().Close()
+	}
+}
+
+// Ping sends a ping frame on every connection
+func (s *Server) Ping() {
+	for _, c := range s.connections() {
+		c.writeMu.Lock()
+		c.ws.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+		c.writeMu.Unlock()
+	}
+}
+
+// SendTrade pushes a trade event to the subscribers of "<symbol>@trade" and
+// returns the number of connections it was sent to
+func (s *Server) SendTrade(symbol string, tradeID int64, price string, quantity string) int {
+	now := time.Now().UnixMilli()
+	return s.SendEvent(streamName(symbol, "trade"), map[string]interface{}{
+		"e": "trade",
+		"E": now,
+		"T": now,
+		"s": strings.ToUpper(symbol),
+		"t": tradeID,
+		"p": price,
+		"q": quantity,
+		"X": "MARKET",
+		"m": false,
+	})
+}
+
+// SendAggTrade pushes an aggTrade event to the subscribers of "<symbol>@aggTrade"
+func (s *Server) SendAggTrade(symbol string, aggTradeID int64, price string, quantity string) int {
+	now := time.Now().UnixMilli()
+	return s.SendEvent(streamName(symbol, "aggTrade"), map[string]interface{}{
+		"e": "aggTrade",
+		"E": now,
+		"s": strings.ToUpper(symbol),
+		"a": aggTradeID,
+		"p": price,
+		"q": quantity,
+		"f": aggTradeID,
+		"l": aggTradeID,
+		"T": now,
+		"m": false,
+	})
+}
+
+// SetAggTrades sets the aggregate trades the REST aggTrades endpoint pages through
+// for symbol, trades must be sorted by ID
+func (s *Server) SetAggTrades(symbol string, trades []binance.AggTrade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[strings.ToUpper(symbol)] = trades
+}
+
+// SetHistoricalTrades sets the trades the REST historicalTrades endpoint returns for
+// symbol, trades must be sorted by ID
+func (s *Server) SetHistoricalTrades(symbol string, trades []binance.HistoricalTrade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trades[strings.ToUpper(symbol)] = trades
+}
+
+// SendBookTicker pushes a bookTicker event to the subscribers of "<symbol>@bookTicker"
+func (s *Server) SendBookTicker(symbol string, updateID int64, bidPrice, bidQty, askPrice, askQty string) int {
+	now := time.Now().UnixMilli()
+	return s.SendEvent(streamName(symbol, "bookTicker"), map[string]interface{}{
+		"e": "bookTicker",
+		"u": updateID,
+		"E": now,
+		"T": now,
+		"s": strings.ToUpper(symbol),
+		"b": bidPrice,
+		"B": bidQty,
+		"a": askPrice,
+		"A": askQty,
+	})
+}
+
+// SetDepthSnapshot sets the order book snapshot the REST depth endpoint returns for
+// symbol, levels are [price, quantity] pairs
+func (s *Server) SetDepthSnapshot(symbol string, lastUpdateID int64, bids, asks [][2]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.depths[strings.ToUpper(symbol)] = depthSnapshot{
+		LastUpdateID: lastUpdateID,
+		Bids:         bids,
+		Asks:         asks,
+	}
+}
+
+// SendDepthUpdate pushes a futures depthUpdate event to the subscribers of the diff
+// depth stream of symbol, speed as in BinanceWSClient.SubscribeDepth
+func (s *Server) SendDepthUpdate(symbol string, speed string, first, final, prev int64, bids, asks [][2]string) int {
+	stream := "depth"
+	if speed != "" {
+		stream += "@" + speed
+	}
+	now := time.Now().UnixMilli()
+	return s.SendEvent(streamName(symbol, stream), map[string]interface{}{
+		"e":  "depthUpdate",
+		"E":  now,
+		"T":  now,
+		"s":  strings.ToUpper(symbol),
+		"U":  first,
+		"u":  final,
+		"pu": prev,
+		"b":  levels(bids),
+		"a":  levels(asks),
+	})
+}
+
+// SendEvent pushes event to the subscribers of stream, wrapped in the combined
+// stream envelope on /stream connections
+func (s *Server) SendEvent(stream string, event interface{}) int {
+	data, err := json.Marshal(event)
+	if err != nil {
+		panic(fmt.Sprintf("binancetest: failed to marshal event: %v", err))
+	}
+
+	sent := 0
+	for _, c := range s.connections() {
+		c.mu.Lock()
+		subscribed := c.streams[stream]
+		c.mu.Unlock()
+		if !subscribed {
+			continue
+		}
+
+		frame := data
+		if c.combined {
+			frame, _ = json.Marshal(map[string]interface{}{
+				"stream": stream,
+				"data":   json.RawMessage(data),
+			})
+		}
+		if s.write(c, frame) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// SendRaw writes frame as is to every connection, e.g. to inject malformed frames
+func (s *Server) SendRaw(frame []byte) {
+	for _, c := range s.connections() {
+		s.write(c, frame)
+	}
+}
+
+func (s *Server) connections() []*serverConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// waitResume blocks while the server is stalled
+func (s *Server) waitResume() {
+	s.mu.Lock()
+	resume := s.resume
+	s.mu.Unlock()
+	<-resume
+}
+
+// stalled reports whether the server is stalled
+func (s *Server) stalled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.resume:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *Server) write(c *serverConn, frame []byte) error {
+	if s.stalled() {
+		return fmt.Errorf("server stalled")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, frame)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, pingInterval time.Duration) {
+	if strings.HasSuffix(r.URL.Path, "/depth") {
+		s.serveDepth(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/aggTrades") {
+		s.serveAggTrades(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/historicalTrades") {
+		s.serveHistoricalTrades(w, r)
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &serverConn{
+		ws:       ws,
+		combined: strings.HasPrefix(r.URL.Path, "/stream"),
+		streams:  make(map[string]bool),
+	}
+	// Binance 在连接 URL 中也可以直接带上 stream
+	if c.combined {
+		for _, stream := range strings.Split(r.URL.Query().Get("streams"), "/") {
+			if stream != "" {
+				c.streams[stream] = true
+			}
+		}
+	} else if stream := strings.TrimPrefix(r.URL.Path, "/ws/"); stream != r.URL.Path && stream != "" {
+		c.streams[stream] = true
+	}
+	ws.SetPongHandler(func(string) error {
+		s.pongs.Add(1)
+		return nil
+	})
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	s.connects.Add(1)
+
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	if pingInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(pingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if !s.stalled() {
+						c.writeMu.Lock()
+						ws.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+						c.writeMu.Unlock()
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.waitResume()
+
+		var req request
+		if err := json.Unmarshal(message, &req); err != nil {
+			s.respond(c, nil, nil, &base.WSError{Code: 3, Msg: "Invalid JSON"})
+			continue
+		}
+		s.handleRequest(c, &req)
+	}
+}
+
+func (s *Server) handleRequest(c *serverConn, req *request) {
+	s.mu.Lock()
+	ackErr := s.ackErr
+	s.mu.Unlock()
+	if ackErr != nil {
+		s.respond(c, req.ID, nil, ackErr)
+		return
+	}
+
+	var result interface{}
+	c.mu.Lock()
+	switch req.Method {
+	case "SUBSCRIBE":
+		for _, stream := range req.Params {
+			c.streams[stream] = true
+		}
+	case "UNSUBSCRIBE":
+		for _, stream := range req.Params {
+			delete(c.streams, stream)
+		}
+	case "LIST_SUBSCRIPTIONS":
+		streams := make([]string, 0, len(c.streams))
+		for stream := range c.streams {
+			streams = append(streams, stream)
+		}
+		sort.Strings(streams)
+		result = streams
+	default:
+		c.mu.Unlock()
+		s.respond(c, req.ID, nil, &base.WSError{Code: 2, Msg: "Invalid request: unknown method"})
+		return
+	}
+	c.mu.Unlock()
+	s.respond(c, req.ID, result, nil)
+}
+
+// respond sends the ack of a control message, after the configured delay
+func (s *Server) respond(c *serverConn, id json.RawMessage, result interface{}, wsErr *base.WSError) {
+	resp := map[string]interface{}{"id": id}
+	if wsErr != nil {
+		resp["error"] = wsErr
+	} else {
+		resp["result"] = result
+	}
+	frame, _ := json.Marshal(resp)
+
+	s.mu.Lock()
+	delay := s.ackWait
+	s.mu.Unlock()
+	if delay <= 0 {
+		s.write(c, frame)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		s.write(c, frame)
+	})
+}
+
+// depthSnapshot is the REST depth response
+type depthSnapshot struct {
+	LastUpdateID int64       `json:"lastUpdateId"`
+	Bids         [][2]string `json:"bids"`
+	Asks         [][2]string `json:"asks"`
+}
+
+func (s *Server) serveDepth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	snapshot, ok := s.depths[strings.ToUpper(r.URL.Query().Get("symbol"))]
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": -1121, "msg": "Invalid symbol."})
+		return
+	}
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// restTrade is an aggTrade in the REST response format
+type restTrade struct {
+	AggTradeID   int64           `json:"a"`
+	Price        decimal.Decimal `json:"p"`
+	Quantity     decimal.Decimal `json:"q"`
+	FirstTradeID int64           `json:"f"`
+	LastTradeID  int64           `json:"l"`
+	TradeTime    int64           `json:"T"`
+	IsMaker      bool            `json:"m"`
+}
+
+func (s *Server) serveAggTrades(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	param := func(name string, def int64) int64 {
+		if v, err := strconv.ParseInt(query.Get(name), 10, 64); err == nil {
+			return v
+		}
+		return def
+	}
+	fromID := param("fromId", -1)
+	startTime := param("startTime", 0)
+	endTime := param("endTime", math.MaxInt64)
+	limit := int(param("limit", 500))
+
+	s.mu.Lock()
+	history := s.history[strings.ToUpper(query.Get("symbol"))]
+	s.mu.Unlock()
+
+	trades := make([]restTrade, 0, limit)
+	for _, trade := range history {
+		if len(trades) == limit {
+			break
+		}
+		if fromID >= 0 && trade.AggTradeID < fromID ||
+			fromID < 0 && (trade.TradeTime < startTime || trade.TradeTime > endTime) {
+			continue
+		}
+		trades = append(trades, restTrade{
+			AggTradeID:   trade.AggTradeID,
+			Price:        trade.Price,
+			Quantity:     trade.Quantity,
+			FirstTradeID: trade.FirstTradeID,
+			LastTradeID:  trade.LastTradeID,
+			TradeTime:    trade.TradeTime,
+			IsMaker:      trade.IsMaker,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trades)
+}
+
+func (s *Server) serveHistoricalTrades(w http.ResponseWriter, r *http.Request) {
+	// 与交易所一致，historicalTrades 需要 API key
+	if r.Header.Get("X-MBX-APIKEY") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code":-2014,"msg":"API-key format invalid."}`))
+		return
+	}
+	query := r.URL.Query()
+	fromID, _ := strconv.ParseInt(query.Get("fromId"), 10, 64)
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		limit = 500
+	}
+
+	s.mu.Lock()
+	history := s.trades[strings.ToUpper(query.Get("symbol"))]
+	s.mu.Unlock()
+
+	trades := make([]binance.HistoricalTrade, 0, limit)
+	for _, trade := range history {
+		if len(trades) == limit {
+			break
+		}
+		if trade.ID >= fromID {
+			trades = append(trades, trade)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trades)
+}
+
+func levels(levels [][2]string) [][2]string {
+	if levels == nil {
+		return [][2]string{}
+	}
+	return levels
+}
+
+func streamName(symbol string, stream string) string {
+	return strings.ToLower(symbol) + "@" + stream
+}
@@ -0,0 +1,923 @@
+package binance
+
+import (
+	"fmt"
+	"sync"
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
+// 行情热路径的解码：直接扫描原始帧写入池化对象，不经过 map[string]interface{}。
+// 池化对象只在 handler 回调期间有效，需要保留的订阅者必须自行拷贝。
+
+var tradePool = sync.Pool{
+	New: func() any { return new(Trade) },
+}
+
+var aggTradePool = sync.Pool{
+	New: func() any { return new(AggTrade) },
+}
+
+var bookTickerPool = sync.Pool{
+	New: func() any { return new(BookTicker) },
+}
+
+var bookDepthPool = sync.Pool{
+	New: func() any { return new(BookDepth) },
+}
+
+var markPricePool = sync.Pool{
+	New: func() any { return new(MarkPrice) },
+}
+
+var liquidationPool = sync.Pool{
+	New: func() any { return new(Liquidation) },
+}
+
+var tickerBatchPool = sync.Pool{
+	New: func() any { return new(TickerBatch) },
+}
+
+var miniTickerBatchPool = sync.Pool{
+	New: func() any { return new(MiniTickerBatch) },
+}
+
+var klinePool = sync.Pool{
+	New: func() any { return new(Kline) },
+}
+
+// AcquireTrade takes a Trade from the pool
+func AcquireTrade() *Trade {
+	return tradePool.Get().(*Trade)
+}
+
+// ReleaseTrade returns a Trade to the pool, it must not be used afterwards
+func ReleaseTrade(t *Trade) {
+	tradePool.Put(t)
+}
+
+// AcquireAggTrade takes an AggTrade from the pool
+func AcquireAggTrade() *AggTrade {
+	return aggTradePool.Get().(*AggTrade)
+}
+
+// ReleaseAggTrade returns an AggTrade to the pool, it must not be used afterwards
+func ReleaseAggTrade(t *AggTrade) {
+	aggTradePool.Put(t)
+}
+
+// AcquireBookTicker takes a BookTicker from the pool
+func AcquireBookTicker() *BookTicker {
+	return bookTickerPool.Get().(*BookTicker)
+}
+
+// ReleaseBookTicker returns a BookTicker to the pool, it must not be used afterwards
+func ReleaseBookTicker(b *BookTicker) {
+	bookTickerPool.Put(b)
+}
+
+// AcquireBookDepth takes a BookDepth from the pool
+func AcquireBookDepth() *BookDepth {
+	return bookDepthPool.Get().(*BookDepth)
+}
+
+// ReleaseBookDepth returns a BookDepth to the pool, it must not be used afterwards
+func ReleaseBookDepth(d *BookDepth) {
+	bookDepthPool.Put(d)
+}
+
+// AcquireMarkPrice takes a MarkPrice from the pool
+func AcquireMarkPrice() *MarkPrice {
+	return markPricePool.Get().(*MarkPrice)
+}
+
+// ReleaseMarkPrice returns a MarkPrice to the pool, it must not be used afterwards
+func ReleaseMarkPrice(m *MarkPrice) {
+	markPricePool.Put(m)
+}
+
+// AcquireLiquidation takes a Liquidation from the pool
+func AcquireLiquidation() *Liquidation {
+	return liquidationPool.Get().(*Liquidation)
+}
+
+// ReleaseLiquidation returns a Liquidation to the pool, it must not be used afterwards
+func ReleaseLiquidation(l *Liquidation) {
+	liquidationPool.Put(l)
+}
+
+// AcquireTickerBatch takes a TickerBatch from the pool
+func AcquireTickerBatch() *TickerBatch {
+	return tickerBatchPool.Get().(*TickerBatch)
+}
+
+// ReleaseTickerBatch returns a TickerBatch to the pool, it must not be used afterwards
+func ReleaseTickerBatch(b *TickerBatch) {
+	tickerBatchPool.Put(b)
+}
+
+// AcquireMiniTickerBatch takes a MiniTickerBatch from the pool
+func AcquireMiniTickerBatch() *MiniTickerBatch {
+	return miniTickerBatchPool.Get().(*MiniTickerBatch)
+}
+
+// ReleaseMiniTickerBatch returns a MiniTickerBatch to the pool, it must not be used afterwards
+func ReleaseMiniTickerBatch(b *MiniTickerBatch) {
+	miniTickerBatchPool.Put(b)
+}
+
+// AcquireKline takes a Kline from the pool
+func AcquireKline() *Kline {
+	return klinePool.Get().(*Kline)
+}
+
+// ReleaseKline returns a Kline to the pool, it must not be used afterwards
+func ReleaseKline(k *Kline) {
+	klinePool.Put(k)
+}
+
+// DecodeTrade decodes a trade event into t without intermediate allocations besides
+// the decimals, string fields are reused when unchanged
+func DecodeTrade(data []byte, t *Trade) error {
+	var err error
+	var seen uint8
+	const (
+		seenSymbol = 1 << iota
+		seenPrice
+		seenQuantity
+		seenMarketType
+	)
+
+	t.EventTime, t.TradeID, t.TradeTime = 0, 0, 0
+	t.IsMaker, t.Ignore = false, false
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			t.EventType = base.Intern(value)
+		case 'E':
+			t.EventTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&t.Symbol, value)
+			seen |= seenSymbol
+		case 't':
+			t.TradeID, err = base.ParseInt(value)
+		case 'p':
+			t.Price, err = base.ParseDecimal(value)
+			seen |= seenPrice
+		case 'q':
+			t.Quantity, err = base.ParseDecimal(value)
+			seen |= seenQuantity
+		case 'T':
+			t.TradeTime, err = base.ParseInt(value)
+		case 'm':
+			t.IsMaker, err = base.ParseBool(value)
+		case 'M':
+			t.Ignore, err = base.ParseBool(value)
+		case 'X':
+			base.SetString(&t.MarketType, value)
+			seen |= seenMarketType
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode trade: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode trade: %w", err)
+	}
+
+	if seen&seenMarketType == 0 {
+		t.MarketType = ""
+	}
+	if seen&(seenSymbol|seenPrice|seenQuantity) != seenSymbol|seenPrice|seenQuantity || t.TradeID == 0 {
+		return fmt.Errorf("failed to decode trade: missing required fields")
+	}
+	return nil
+}
+
+// DecodeAggTrade decodes an aggTrade event into t without intermediate allocations
+// besides the decimals
+func DecodeAggTrade(data []byte, t *AggTrade) error {
+	var err error
+	var seen uint8
+	const (
+		seenSymbol = 1 << iota
+		seenID
+		seenPrice
+		seenQuantity
+	)
+	const seenAll = seenSymbol | seenID | seenPrice | seenQuantity
+
+	t.EventTime, t.FirstTradeID, t.LastTradeID, t.TradeTime = 0, 0, 0, 0
+	t.IsMaker, t.BestMatch = false, false
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			t.EventType = base.Intern(value)
+		case 'E':
+			t.EventTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&t.Symbol, value)
+			seen |= seenSymbol
+		case 'a':
+			t.AggTradeID, err = base.ParseInt(value)
+			seen |= seenID
+		case 'p':
+			t.Price, err = base.ParseDecimal(value)
+			seen |= seenPrice
+		case 'q':
+			t.Quantity, err = base.ParseDecimal(value)
+			seen |= seenQuantity
+		case 'f':
+			t.FirstTradeID, err = base.ParseInt(value)
+		case 'l':
+			t.LastTradeID, err = base.ParseInt(value)
+		case 'T':
+			t.TradeTime, err = base.ParseInt(value)
+		case 'm':
+			t.IsMaker, err = base.ParseBool(value)
+		case 'M':
+			t.BestMatch, err = base.ParseBool(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode aggTrade: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode aggTrade: %w", err)
+	}
+	if seen != seenAll {
+		return fmt.Errorf("failed to decode aggTrade: missing required fields")
+	}
+	return nil
+}
+
+// DecodeBookTicker decodes a bookTicker event into b without intermediate allocations
+// besides the decimals
+func DecodeBookTicker(data []byte, b *BookTicker) error {
+	var err error
+	var seen uint8
+	const (
+		seenSymbol = 1 << iota
+		seenBidPrice
+		seenBidQty
+		seenAskPrice
+		seenAskQty
+	)
+	const seenAll = seenSymbol | seenBidPrice | seenBidQty | seenAskPrice | seenAskQty
+
+	b.EventType = ""
+	b.UpdateID, b.EventTime, b.TransactionTime = 0, 0, 0
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'u':
+			b.UpdateID, err = base.ParseInt(value)
+		case 'e':
+			b.EventType = base.Intern(value)
+		case 'E':
+			b.EventTime, err = base.ParseInt(value)
+		case 'T':
+			b.TransactionTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&b.Symbol, value)
+			seen |= seenSymbol
+		case 'b':
+			b.BidPrice, err = base.ParseDecimal(value)
+			seen |= seenBidPrice
+		case 'B':
+			b.BidQty, err = base.ParseDecimal(value)
+			seen |= seenBidQty
+		case 'a':
+			b.AskPrice, err = base.ParseDecimal(value)
+			seen |= seenAskPrice
+		case 'A':
+			b.AskQty, err = base.ParseDecimal(value)
+			seen |= seenAskQty
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode bookTicker: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode bookTicker: %w", err)
+	}
+	if seen != seenAll {
+		return fmt.Errorf("failed to decode bookTicker: missing required fields")
+	}
+	return nil
+}
+
+// DecodeBookDepth decodes a futures or spot partial book depth message into d,
+// reusing its level slices
+func DecodeBookDepth(data []byte, d *BookDepth) error {
+	var err error
+	var hasID bool
+	d.EventType = ""
+	d.EventTime, d.TransactionTime = 0, 0
+	d.FirstUpdateID, d.LastUpdateID, d.PrevFinalUpdateID = 0, 0, 0
+	d.Bids, d.Asks = d.Bids[:0], d.Asks[:0]
+
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		switch string(key) {
+		case "e":
+			d.EventType = base.Intern(value)
+		case "E":
+			d.EventTime, err = base.ParseInt(value)
+		case "T":
+			d.TransactionTime, err = base.ParseInt(value)
+		case "s":
+			base.SetString(&d.Symbol, value)
+		case "U":
+			d.FirstUpdateID, err = base.ParseInt(value)
+		case "u", "lastUpdateId":
+			d.LastUpdateID, err = base.ParseInt(value)
+			hasID = true
+		case "pu":
+			d.PrevFinalUpdateID, err = base.ParseInt(value)
+		case "b", "bids":
+			d.Bids, err = decodeLevels(value, d.Bids)
+		case "a", "asks":
+			d.Asks, err = decodeLevels(value, d.Asks)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode book depth: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode book depth: %w", err)
+	}
+	if !hasID {
+		return fmt.Errorf("failed to decode book depth: missing required fields")
+	}
+	return nil
+}
+
+// DecodeMarkPrice decodes a markPriceUpdate event into m
+func DecodeMarkPrice(data []byte, m *MarkPrice) error {
+	var err error
+	var seen uint8
+	const (
+		seenSymbol = 1 << iota
+		seenMarkPrice
+	)
+	const seenAll = seenSymbol | seenMarkPrice
+
+	m.EventType = ""
+	m.EventTime, m.NextFundingTime = 0, 0
+	m.IndexPrice, m.EstimatedSettlePrice, m.FundingRate = decimal.Zero, decimal.Zero, decimal.Zero
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			m.EventType = base.Intern(value)
+		case 'E':
+			m.EventTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&m.Symbol, value)
+			seen |= seenSymbol
+		case 'p':
+			m.MarkPrice, err = base.ParseDecimal(value)
+			seen |= seenMarkPrice
+		case 'i':
+			m.IndexPrice, err = base.ParseDecimal(value)
+		case 'P':
+			m.EstimatedSettlePrice, err = base.ParseDecimal(value)
+		case 'r':
+			if len(value) > 0 {
+				m.FundingRate, err = base.ParseDecimal(value)
+			}
+		case 'T':
+			m.NextFundingTime, err = base.ParseInt(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode markPriceUpdate: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode markPriceUpdate: %w", err)
+	}
+	if seen != seenAll {
+		return fmt.Errorf("failed to decode markPriceUpdate: missing required fields")
+	}
+	return nil
+}
+
+// DecodeLiquidation decodes a forceOrder event into l
+func DecodeLiquidation(data []byte, l *Liquidation) error {
+	var err error
+	var order []byte
+	l.EventType = ""
+	l.EventTime = 0
+
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			l.EventType = base.Intern(value)
+		case 'E':
+			l.EventTime, err = base.ParseInt(value)
+		case 'o':
+			order = value
+		}
+		return err == nil
+	})
+	if scanErr == nil && err == nil && order == nil {
+		err = fmt.Errorf("missing required fields")
+	}
+	if scanErr == nil && err == nil {
+		scanErr = decodeLiquidationOrder(order, l)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode forceOrder: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode forceOrder: %w", err)
+	}
+	return nil
+}
+
+// decodeLiquidationOrder decodes the "o" object of a forceOrder event
+func decodeLiquidationOrder(data []byte, l *Liquidation) error {
+	var err error
+	var seen uint8
+	const (
+		seenSymbol = 1 << iota
+		seenSide
+		seenPrice
+		seenQuantity
+	)
+	const seenAll = seenSymbol | seenSide | seenPrice | seenQuantity
+
+	l.TradeTime = 0
+	l.AveragePrice, l.LastFilledQty, l.FilledQty = decimal.Zero, decimal.Zero, decimal.Zero
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		switch string(key) {
+		case "s":
+			base.SetString(&l.Symbol, value)
+			seen |= seenSymbol
+		case "S":
+			l.Side = base.Intern(value)
+			seen |= seenSide
+		case "o":
+			l.OrderType = base.Intern(value)
+		case "f":
+			l.TimeInForce = base.Intern(value)
+		case "q":
+			l.Quantity, err = base.ParseDecimal(value)
+			seen |= seenQuantity
+		case "p":
+			l.Price, err = base.ParseDecimal(value)
+			seen |= seenPrice
+		case "ap":
+			l.AveragePrice, err = base.ParseDecimal(value)
+		case "X":
+			l.Status = base.Intern(value)
+		case "l":
+			l.LastFilledQty, err = base.ParseDecimal(value)
+		case "z":
+			l.FilledQty, err = base.ParseDecimal(value)
+		case "T":
+			l.TradeTime, err = base.ParseInt(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		return err
+	}
+	if seen != seenAll {
+		return fmt.Errorf("missing required fields")
+	}
+	return nil
+}
+
+// DecodeTickers decodes a 24hrTicker event or an array of them into b, reusing its slice
+func DecodeTickers(data []byte, b *TickerBatch) error {
+	b.Tickers = b.Tickers[:0]
+	decode := func(value []byte) error {
+		b.Tickers = append(b.Tickers, Ticker{})
+		return DecodeTicker(value, &b.Tickers[len(b.Tickers)-1])
+	}
+	if base.IsArray(data) {
+		return base.ArrayEach(data, decode)
+	}
+	return decode(data)
+}
+
+// DecodeTicker decodes a 24hrTicker event into t
+func DecodeTicker(data []byte, t *Ticker) error {
+	var err error
+	var seen bool
+	*t = Ticker{}
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		var field *decimal.Decimal
+		switch key[0] {
+		case 'e':
+			t.EventType = base.Intern(value)
+		case 'E':
+			t.EventTime, err = base.ParseInt(value)
+		case 's':
+			t.Symbol = base.Intern(value)
+			seen = true
+		case 'p':
+			field = &t.PriceChange
+		case 'P':
+			field = &t.PriceChangePercent
+		case 'w':
+			field = &t.WeightedAvgPrice
+		case 'c':
+			field = &t.LastPrice
+		case 'Q':
+			field = &t.LastQty
+		case 'b':
+			field = &t.BidPrice
+		case 'B':
+			field = &t.BidQty
+		case 'a':
+			field = &t.AskPrice
+		case 'A':
+			field = &t.AskQty
+		case 'o':
+			field = &t.OpenPrice
+		case 'h':
+			field = &t.HighPrice
+		case 'l':
+			field = &t.LowPrice
+		case 'v':
+			field = &t.Volume
+		case 'q':
+			field = &t.QuoteVolume
+		case 'O':
+			t.OpenTime, err = base.ParseInt(value)
+		case 'C':
+			t.CloseTime, err = base.ParseInt(value)
+		case 'F':
+			t.FirstTradeID, err = base.ParseInt(value)
+		case 'L':
+			t.LastTradeID, err = base.ParseInt(value)
+		case 'n':
+			t.Trades, err = base.ParseInt(value)
+		}
+		if field != nil {
+			*field, err = base.ParseDecimal(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode 24hrTicker: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode 24hrTicker: %w", err)
+	}
+	if !seen {
+		return fmt.Errorf("failed to decode 24hrTicker: missing required fields")
+	}
+	return nil
+}
+
+// DecodeMiniTickers decodes a 24hrMiniTicker event or an array of them into b, reusing its slice
+func DecodeMiniTickers(data []byte, b *MiniTickerBatch) error {
+	b.Tickers = b.Tickers[:0]
+	decode := func(value []byte) error {
+		b.Tickers = append(b.Tickers, MiniTicker{})
+		return DecodeMiniTicker(value, &b.Tickers[len(b.Tickers)-1])
+	}
+	if base.IsArray(data) {
+		return base.ArrayEach(data, decode)
+	}
+	return decode(data)
+}
+
+// DecodeMiniTicker decodes a 24hrMiniTicker event into t
+func DecodeMiniTicker(data []byte, t *MiniTicker) error {
+	var err error
+	var seen bool
+	*t = MiniTicker{}
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		var field *decimal.Decimal
+		switch key[0] {
+		case 'e':
+			t.EventType = base.Intern(value)
+		case 'E':
+			t.EventTime, err = base.ParseInt(value)
+		case 's':
+			t.Symbol = base.Intern(value)
+			seen = true
+		case 'c':
+			field = &t.ClosePrice
+		case 'o':
+			field = &t.OpenPrice
+		case 'h':
+			field = &t.HighPrice
+		case 'l':
+			field = &t.LowPrice
+		case 'v':
+			field = &t.Volume
+		case 'q':
+			field = &t.QuoteVolume
+		}
+		if field != nil {
+			*field, err = base.ParseDecimal(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode 24hrMiniTicker: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode 24hrMiniTicker: %w", err)
+	}
+	if !seen {
+		return fmt.Errorf("failed to decode 24hrMiniTicker: missing required fields")
+	}
+	return nil
+}
+
+// DecodeKline decodes a kline event into k
+func DecodeKline(data []byte, k *Kline) error {
+	var err error
+	var kline []byte
+	k.EventType = ""
+	k.EventTime = 0
+
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			k.EventType = base.Intern(value)
+		case 'E':
+			k.EventTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&k.Symbol, value)
+		case 'k':
+			kline = value
+		}
+		return err == nil
+	})
+	if scanErr == nil && err == nil && kline == nil {
+		err = fmt.Errorf("missing required fields")
+	}
+	if scanErr == nil && err == nil {
+		scanErr = decodeKlineBody(kline, k)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode kline: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode kline: %w", err)
+	}
+	return nil
+}
+
+// decodeKlineBody decodes the "k" object of a kline event
+func decodeKlineBody(data []byte, k *Kline) error {
+	var err error
+	var seen uint8
+	const (
+		seenStart = 1 << iota
+		seenInterval
+		seenOpen
+		seenClose
+	)
+	const seenAll = seenStart | seenInterval | seenOpen | seenClose
+
+	k.CloseTime, k.FirstTradeID, k.LastTradeID, k.Trades = 0, 0, 0, 0
+	k.IsClosed = false
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 't':
+			k.StartTime, err = base.ParseInt(value)
+			seen |= seenStart
+		case 'T':
+			k.CloseTime, err = base.ParseInt(value)
+		case 's':
+			base.SetString(&k.Symbol, value)
+		case 'i':
+			k.Interval = base.Intern(value)
+			seen |= seenInterval
+		case 'f':
+			k.FirstTradeID, err = base.ParseInt(value)
+		case 'L':
+			k.LastTradeID, err = base.ParseInt(value)
+		case 'o':
+			k.Open, err = base.ParseDecimal(value)
+			seen |= seenOpen
+		case 'c':
+			k.Close, err = base.ParseDecimal(value)
+			seen |= seenClose
+		case 'h':
+			k.High, err = base.ParseDecimal(value)
+		case 'l':
+			k.Low, err = base.ParseDecimal(value)
+		case 'v':
+			k.Volume, err = base.ParseDecimal(value)
+		case 'q':
+			k.QuoteVolume, err = base.ParseDecimal(value)
+		case 'V':
+			k.TakerBuyVolume, err = base.ParseDecimal(value)
+		case 'Q':
+			k.TakerBuyQuoteVolume, err = base.ParseDecimal(value)
+		case 'n':
+			k.Trades, err = base.ParseInt(value)
+		case 'x':
+			k.IsClosed, err = base.ParseBool(value)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		return err
+	}
+	if seen != seenAll || k.Symbol == "" {
+		return fmt.Errorf("missing required fields")
+	}
+	return nil
+}
+
+// frameMeta holds the fields routing and de-duplication need, peeked in one pass
+type frameMeta struct {
+	event  string
+	symbol []byte
+	// interval K 线周期，不同周期的 K 线事件类型与 symbol 都相同
+	interval  []byte
+	id        int64
+	hasID     bool
+	eventTime int64
+}
+
+// peekFrame scans the top-level fields of an event, event is the type if already known
+func peekFrame(data []byte, event string) frameMeta {
+	meta := frameMeta{event: event}
+	if base.IsArray(data) {
+		// 全市场数组流：事件类型取自第一个元素，没有 symbol 与 ID
+		if first, ok := base.FirstElement(data); ok && meta.event == "" {
+			if e, ok := base.PeekField(first, "e"); ok {
+				meta.event = base.Intern(e)
+			}
+		}
+		return meta
+	}
+	var eventBytes, t, a, u, order, kline []byte
+	var hasBid bool
+
+	base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'e':
+			eventBytes = value
+		case 's':
+			meta.symbol = value
+		case 't':
+			t = value
+		case 'a':
+			a = value
+		case 'u':
+			u = value
+		case 'b':
+			hasBid = true
+		case 'o':
+			order = value
+		case 'k':
+			kline = value
+		case 'E':
+			meta.eventTime, _ = base.ParseInt(value)
+		}
+		return true
+	})
+
+	if meta.event == "" {
+		if len(eventBytes) > 0 {
+			meta.event = base.Intern(eventBytes)
+		} else if hasBid && u != nil {
+			// spot bookTicker has no event type
+			meta.event = "bookTicker"
+		}
+	}
+
+	var idField []byte
+	switch meta.event {
+	case "forceOrder":
+		// 强平事件的 symbol 在订单对象内；每个 symbol 每秒只推送最新一笔强平，
+		// 以 symbol 加成交时间标识，symbol 在 key 中
+		if meta.symbol == nil && order != nil {
+			meta.symbol, _ = base.PeekField(order, "s")
+		}
+		if order != nil {
+			idField, _ = base.PeekField(order, "T")
+		}
+	case "kline":
+		// 同一根 K 线会多次推送，以周期 (在 key 中)、开盘时间、成交笔数与是否收盘标识
+		if kline != nil {
+			meta.interval, meta.id, meta.hasID = peekKline(kline)
+		}
+		return meta
+	case "trade":
+		idField = t
+	case "aggTrade":
+		idField = a
+	case "bookTicker", "depthUpdate":
+		idField = u
+	case "markPriceUpdate", "24hrTicker", "24hrMiniTicker":
+		// 按固定周期推送的快照，事件时间就是快照的标识
+		meta.id, meta.hasID = meta.eventTime, meta.eventTime != 0
+		return meta
+	}
+	if idField != nil {
+		var err error
+		meta.id, err = base.ParseInt(idField)
+		meta.hasID = err == nil
+	}
+	return meta
+}
+
+// peekKline returns the interval and the identity of a kline update: the open time in
+// seconds in the high 32 bits, then the trade count and whether the kline is closed.
+// Updates without new trades repeat the same content and share the identity.
+func peekKline(data []byte) (interval []byte, id int64, ok bool) {
+	var start, trades int64
+	var closed, seenStart bool
+	base.ObjectEach(data, func(key, value []byte) bool {
+		if len(key) != 1 {
+			return true
+		}
+		switch key[0] {
+		case 'i':
+			interval = value
+		case 't':
+			start, _ = base.ParseInt(value)
+			seenStart = true
+		case 'n':
+			trades, _ = base.ParseInt(value)
+		case 'x':
+			closed, _ = base.ParseBool(value)
+		}
+		return true
+	})
+	if !seenStart {
+		return interval, 0, false
+	}
+	id = (start/1000)<<32 | (trades&(1<<31-1))<<1
+	if closed {
+		id |= 1
+	}
+	return interval, id, true
+}
+
+// rawKey appends the "symbol@event" key of the frame, "symbol@kline_<interval>" for
+// klines. Raw mode frames are recognised and de-duplicated by it.
+func (m *frameMeta) rawKey(buf []byte) []byte {
+	buf = appendStreamKey(buf, m.symbol, m.event)
+	if len(m.interval) > 0 {
+		buf = append(buf, '_')
+		buf = append(buf, m.interval...)
+	}
+	return buf
+}
+
+// appendStreamKey appends "symbol@event" with the symbol lowercased
+func appendStreamKey[S string | []byte](buf []byte, symbol S, event string) []byte {
+	for i := 0; i < len(symbol); i++ {
+		c := symbol[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf = append(buf, c)
+	}
+	buf = append(buf, '@')
+	return append(buf, event...)
+}
@@ -0,0 +1,366 @@
+package binance
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
+// testdata/frames.jsonl 是按 Binance 组合流格式生成的 trade / bookTicker 帧，
+// 字段与线上推送一致，用于对比解码路径的吞吐与内存分配
+
+type testFrame struct {
+	raw     []byte // combined stream envelope
+	payload []byte // the event inside "data"
+	event   string
+}
+
+func loadFrames(tb testing.TB) []testFrame {
+	tb.Helper()
+	data, err := os.ReadFile("testdata/frames.jsonl")
+	if err != nil {
+		tb.Fatalf("failed to read frames: %v", err)
+	}
+
+	var frames []testFrame
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		payload, ok := base.PeekField(line, "data")
+		if !ok {
+			tb.Fatalf("frame without data: %s", line)
+		}
+		meta := peekFrame(payload, "")
+		frames = append(frames, testFrame{raw: line, payload: payload, event: meta.event})
+	}
+	return frames
+}
+
+func TestDecodeMatchesEncodingJSON(t *testing.T) {
+	for _, f := range loadFrames(t) {
+		switch f.event {
+		case "trade":
+			var want Trade
+			if err := json.Unmarshal(f.payload, &want); err != nil {
+				t.Fatal(err)
+			}
+			got := AcquireTrade()
+			if err := DecodeTrade(f.payload, got); err != nil {
+				t.Fatalf("DecodeTrade(%s): %v", f.payload, err)
+			}
+			if !reflect.DeepEqual(*got, want) {
+				t.Fatalf("DecodeTrade(%s) = %+v, want %+v", f.payload, *got, want)
+			}
+			ReleaseTrade(got)
+		case "bookTicker":
+			var want BookTicker
+			if err := json.Unmarshal(f.payload, &want); err != nil {
+				t.Fatal(err)
+			}
+			got := AcquireBookTicker()
+			if err := DecodeBookTicker(f.payload, got); err != nil {
+				t.Fatalf("DecodeBookTicker(%s): %v", f.payload, err)
+			}
+			if !reflect.DeepEqual(*got, want) {
+				t.Fatalf("DecodeBookTicker(%s) = %+v, want %+v", f.payload, *got, want)
+			}
+			ReleaseBookTicker(got)
+		default:
+			t.Fatalf("unexpected event %q", f.event)
+		}
+	}
+}
+
+func TestTradeDecimalRoundTrip(t *testing.T) {
+	data := []byte(`{"e":"trade","E":1,"s":"BTCUSDT","t":7,"p":"0.10000000","q":"0.20000000","T":1,"m":true}`)
+	var trade Trade
+	if err := DecodeTrade(data, &trade); err != nil {
+		t.Fatal(err)
+	}
+	if !trade.Price.Add(trade.Quantity).Equal(decimal.RequireFromString("0.3")) {
+		t.Fatalf("0.1 + 0.2 = %s", trade.Price.Add(trade.Quantity))
+	}
+
+	encoded, err := json.Marshal(&trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Trade
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Price.Equal(trade.Price) || !decoded.Quantity.Equal(trade.Quantity) || decoded.Price.String() != "0.1" {
+		t.Fatalf("round trip %s = %+v", encoded, decoded)
+	}
+}
+
+func TestDecodeTradeAllocs(t *testing.T) {
+	data := []byte(`{"e":"trade","E":1,"s":"BTCUSDT","t":7,"p":"67123.45000000","q":"0.01200000","T":1,"m":true}`)
+	trade := AcquireTrade()
+	defer ReleaseTrade(trade)
+	// 只有 price 和 quantity 两个 decimal 分配
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := DecodeTrade(data, trade); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 4 {
+		t.Fatalf("DecodeTrade allocates %v times", allocs)
+	}
+}
+
+// BenchmarkLegacyDecode is the previous path: envelope into a map, then
+// marshal and unmarshal again into the typed struct
+func BenchmarkLegacyDecode(b *testing.B) {
+	frames := loadFrames(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := frames[i%len(frames)]
+		var msg map[string]interface{}
+		if err := json.Unmarshal(f.raw, &msg); err != nil {
+			b.Fatal(err)
+		}
+		data := msg["data"].(map[string]interface{})
+		var err error
+		switch data["e"] {
+		case "trade":
+			_, err = legacyParse[Trade](data)
+		case "bookTicker":
+			_, err = legacyParse[BookTicker](data)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func legacyParse[T any](msg map[string]interface{}) (*T, error) {
+	jsonBytes, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var result T
+	if err := json.Unmarshal(jsonBytes, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func BenchmarkTypedDecode(b *testing.B) {
+	frames := loadFrames(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := frames[i%len(frames)]
+		payload, _ := base.PeekField(f.raw, "data")
+		meta := peekFrame(payload, "")
+		var err error
+		switch meta.event {
+		case "trade":
+			t := AcquireTrade()
+			err = DecodeTrade(payload, t)
+			ReleaseTrade(t)
+		case "bookTicker":
+			t := AcquireBookTicker()
+			err = DecodeBookTicker(payload, t)
+			ReleaseBookTicker(t)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDispatch runs frames through stream routing, staleness tracking,
+// de-duplication and the connector's pooled decoding
+func BenchmarkDispatch(b *testing.B) {
+	frames := loadFrames(b)
+	connector := &BinancePublicConnector{latency: base.NewLatencyMonitor(), bars: base.NewBarAggregator()}
+	client, err := NewBinanceWSClientWithConfig(
+		BinanceAccountTypeUsdMFuturesTestnet,
+		&base.WSConfig{CombinedStream: true},
+		connector.HandleMessage,
+		nil,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, f := range frames {
+		stream, _ := base.PeekField(f.raw, "stream")
+		client.streams[string(stream)] = &streamEntry{name: string(stream)}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// replaying the same IDs again would only exercise the duplicate path
+		if i%len(frames) == 0 {
+			b.StopTimer()
+			client.dedup = NewDeduper()
+			b.StartTimer()
+		}
+		if err := client.handleMessage(0, frames[i%len(frames)].raw, "", time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeBookDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want BookDepth
+	}{
+		{
+			name: "futures",
+			data: `{"e":"depthUpdate","E":1571889248277,"T":1571889248276,"s":"BTCUSDT","U":390497796,"u":390497878,"pu":390497794,"b":[["7403.89","0.002"],["7403.90","3.906"]],"a":[["7405.96","3.340"]]}`,
+			want: BookDepth{EventType: "depthUpdate", EventTime: 1571889248277, TransactionTime: 1571889248276,
+				Symbol: "BTCUSDT", FirstUpdateID: 390497796, LastUpdateID: 390497878, PrevFinalUpdateID: 390497794},
+		},
+		{
+			name: "spot",
+			data: `{"lastUpdateId":160,"bids":[["0.0024","10"],["0.0023","5"]],"asks":[["0.0026","100"]]}`,
+			want: BookDepth{LastUpdateID: 160},
+		},
+	}
+
+	// 复用同一个对象，确认上一条消息的字段被清空
+	depth := &BookDepth{}
+	for _, tt := range tests {
+		if err := DecodeBookDepth([]byte(tt.data), depth); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if depth.EventType != tt.want.EventType || depth.EventTime != tt.want.EventTime ||
+			depth.TransactionTime != tt.want.TransactionTime || depth.FirstUpdateID != tt.want.FirstUpdateID ||
+			depth.LastUpdateID != tt.want.LastUpdateID || depth.PrevFinalUpdateID != tt.want.PrevFinalUpdateID {
+			t.Fatalf("%s: got %+v", tt.name, depth)
+		}
+		if tt.want.Symbol != "" && depth.Symbol != tt.want.Symbol {
+			t.Fatalf("%s: symbol %q", tt.name, depth.Symbol)
+		}
+		if len(depth.Bids) != 2 || len(depth.Asks) != 1 {
+			t.Fatalf("%s: %d bids, %d asks", tt.name, len(depth.Bids), len(depth.Asks))
+		}
+	}
+	if depth.Bids[0].Price.String() != "0.0024" || depth.Asks[0].Quantity.String() != "100" {
+		t.Fatalf("unexpected levels %v %v", depth.Bids, depth.Asks)
+	}
+
+	if err := DecodeBookDepth([]byte(`{"bids":[["1"]]}`), depth); err == nil {
+		t.Fatal("expected an error for a malformed level")
+	}
+}
+
+func TestDecodeKline(t *testing.T) {
+	data := []byte(`{"e":"kline","E":1672515782136,"s":"BNBBTC","k":{"t":1672515780000,"T":1672515839999,"s":"BNBBTC","i":"1m","f":100,"L":200,"o":"0.0010","c":"0.0020","h":"0.0025","l":"0.0015","v":"1000","n":100,"x":true,"q":"1.0000","V":"500","Q":"0.500","B":"123456"}}`)
+	var k Kline
+	if err := DecodeKline(data, &k); err != nil {
+		t.Fatal(err)
+	}
+	if k.EventType != "kline" || k.Symbol != "BNBBTC" || k.Interval != "1m" || !k.IsClosed ||
+		k.StartTime != 1672515780000 || k.CloseTime != 1672515839999 || k.Trades != 100 || k.LastTradeID != 200 {
+		t.Fatalf("got %+v", k)
+	}
+	if k.High.String() != "0.0025" || k.Volume.String() != "1000" || k.TakerBuyQuoteVolume.String() != "0.5" {
+		t.Fatalf("got high %s volume %s taker quote %s", k.High, k.Volume, k.TakerBuyQuoteVolume)
+	}
+
+	// 去重标识来自 K 线本身：收盘推送与之前的同内容推送不同，与事件时间无关
+	meta := peekFrame(data, "")
+	open := peekFrame(bytes.Replace(data, []byte(`"x":true`), []byte(`"x":false`), 1), "")
+	var buf [64]byte
+	if string(meta.rawKey(buf[:0])) != "bnbbtc@kline_1m" || !meta.hasID || !open.hasID || meta.id == open.id {
+		t.Fatalf("got meta %+v, open %+v", meta, open)
+	}
+
+	var bar base.Bar
+	KlineToBar(base.MarketTypeSpot, &k, &bar)
+	if bar.Spec != base.TimeBars(time.Minute) || bar.OpenTime != k.StartTime || bar.CloseTime != 1672515840000 || bar.Partial {
+		t.Fatalf("got bar %+v", bar)
+	}
+
+	if err := DecodeKline([]byte(`{"e":"kline","E":1,"s":"BNBBTC"}`), &k); err == nil {
+		t.Fatal("expected an error without the kline body")
+	}
+}
+
+func TestDecodeMarkPrice(t *testing.T) {
+	data := []byte(`{"e":"markPriceUpdate","E":1562305380000,"s":"BTCUSDT","p":"11794.15000000","i":"11784.62659091","P":"11784.25641265","r":"0.00038167","T":1562306400000}`)
+	var m MarkPrice
+	if err := DecodeMarkPrice(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.EventType != "markPriceUpdate" || m.Symbol != "BTCUSDT" || m.NextFundingTime != 1562306400000 ||
+		m.MarkPrice.String() != "11794.15" || m.IndexPrice.String() != "11784.62659091" || m.FundingRate.String() != "0.00038167" {
+		t.Fatalf("got %+v", m)
+	}
+
+	// 交割合约的资金费率为空
+	data = []byte(`{"e":"markPriceUpdate","E":1562305380000,"s":"BTCUSD_200626","p":"11794.15","i":"11784.62","P":"11784.25","r":"","T":0}`)
+	if err := DecodeMarkPrice(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !m.FundingRate.IsZero() || m.Symbol != "BTCUSD_200626" {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestDecodeLiquidation(t *testing.T) {
+	data := []byte(`{"e":"forceOrder","E":1568014460893,"o":{"s":"BTCUSDT","S":"SELL","o":"LIMIT","f":"IOC","q":"0.014","p":"9910","ap":"9910.5","X":"FILLED","l":"0.014","z":"0.014","T":1568014460893}}`)
+	var l Liquidation
+	if err := DecodeLiquidation(data, &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.EventType != "forceOrder" || l.Symbol != "BTCUSDT" || l.Side != "SELL" || l.OrderType != "LIMIT" ||
+		l.TimeInForce != "IOC" || l.Status != "FILLED" || l.TradeTime != 1568014460893 ||
+		l.AveragePrice.String() != "9910.5" || l.FilledQty.String() != "0.014" {
+		t.Fatalf("got %+v", l)
+	}
+
+	// symbol 在订单对象内，路由与延迟统计需要从中取出，去重按成交时间
+	meta := peekFrame(data, "")
+	if meta.event != "forceOrder" || string(meta.symbol) != "BTCUSDT" || !meta.hasID || meta.id != 1568014460893 {
+		t.Fatalf("got meta %+v", meta)
+	}
+}
+
+func TestDecodeTickers(t *testing.T) {
+	data := []byte(`[{"e":"24hrTicker","E":1672515782136,"s":"BTCUSDT","p":"150.5","P":"0.155","w":"97100.2","c":"97150.5","Q":"0.01","o":"97000","h":"97500","l":"96500","v":"12000","q":"1165200000","O":1672429380000,"C":1672515782136,"F":1,"L":5000,"n":5000},` +
+		`{"e":"24hrTicker","E":1672515782136,"s":"ETHUSDT","p":"-10","P":"-0.3","w":"3400","c":"3390","Q":"1","o":"3400","h":"3450","l":"3350","v":"50000","q":"170000000","O":1672429380000,"C":1672515782136,"F":1,"L":900,"n":900}]`)
+
+	batch := &TickerBatch{}
+	if err := DecodeTickers(data, batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Tickers) != 2 {
+		t.Fatalf("got %d tickers", len(batch.Tickers))
+	}
+	btc, eth := batch.Tickers[0], batch.Tickers[1]
+	if btc.Symbol != "BTCUSDT" || btc.LastPrice.String() != "97150.5" || btc.Trades != 5000 || !btc.BidPrice.IsZero() {
+		t.Fatalf("got %+v", btc)
+	}
+	if eth.Symbol != "ETHUSDT" || eth.PriceChange.String() != "-10" || eth.QuoteVolume.String() != "170000000" {
+		t.Fatalf("got %+v", eth)
+	}
+
+	meta := peekFrame(data, "")
+	if meta.event != "24hrTicker" || meta.hasID {
+		t.Fatalf("got meta %+v", meta)
+	}
+
+	mini := &MiniTickerBatch{}
+	if err := DecodeMiniTickers([]byte(`{"e":"24hrMiniTicker","E":1,"s":"BNBUSDT","c":"600","o":"590","h":"610","l":"580","v":"1000","q":"600000"}`), mini); err != nil {
+		t.Fatal(err)
+	}
+	if len(mini.Tickers) != 1 || mini.Tickers[0].ClosePrice.String() != "600" {
+		t.Fatalf("got %+v", mini.Tickers)
+	}
+}
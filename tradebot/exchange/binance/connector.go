@@ -2,99 +2,643 @@ package binance
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"tradebot_go/tradebot/base"
 	"tradebot_go/tradebot/core/messagebus"
 )
 
+// defaultLatencyReport is the default interval of the feed latency log summaries
+const defaultLatencyReport = time.Minute
+
+// barFlushInterval is how often time bars are closed without waiting for the next trade
+const barFlushInterval = 100 * time.Millisecond
+
+// PublicConnector publishes exchange market data on the message bus. Every event is
+// converted to a base type first ("trade" / "aggTrade" as base.TradeTick, "quote" as
+// base.QuoteTick, "bookDepth" / "orderBookDelta" as base.OrderBookDelta, "bar" / "kline"
+// as base.Bar, "markPrice" as base.MarkPriceUpdate, "liquidation" as base.Liquidation,
+// "ticker" / "miniTicker" as base.TickerBatch), so strategies never import an exchange package.
+// The market data handlers of one connector never run concurrently, trades backfilled
+// after a sequence gap are published from a background goroutine under the same lock.
 type PublicConnector interface {
 	SubscribeTrade(symbol string) error
+	SubscribeAggTrade(symbol string) error
 	SubscribeBookL1(symbol string) error
+	SubscribeBookDepth(symbol string, levels int, speed string) error
+	SubscribeKline(symbol string, interval string) error
+	SubscribeMarkPrice(symbol string, speed string) error
+	SubscribeLiquidation(symbol string) error
+	SubscribeAllLiquidations() error
+	SubscribeTicker(symbol string) error
+	SubscribeMiniTicker(symbol string) error
+	SubscribeBars(symbol string, spec base.BarSpec) error
 }
 
 type BinancePublicConnector struct {
-	wsClient *BinanceWSClient
-	msgBus   *messagebus.MessageBus
+	// legs 冗余行情的各组连接，legs[0] 为主连接
+	legs      []*BinanceWSClient
+	arbiter   *FeedArbiter
+	redundant map[string]bool
+	recorder  *base.FrameRecorder
+	msgBus    *messagebus.MessageBus
+	// busMu 串行化行情的发布，见 send
+	busMu sync.Mutex
+	// market 发布的 instrument ID 的市场类型
+	market base.MarketType
+
+	// latency 按 stream 统计 交易所->读到帧->解码->总线 handler 的延迟
+	latency       *base.LatencyMonitor
+	latencyReport time.Duration
+
+	// bars 由 trade 流聚合的本地 K 线
+	bars *base.BarAggregator
+
+	// history 获取历史归集成交，backfills 按 symbol 衔接历史与实时 aggTrade
+	history    AggTradeFetcher
+	backfillMu sync.RWMutex
+	backfills  map[string]*aggTradeBackfill
+
+	// sequencer 检查 trade 序号，补齐缺口后按序发布
+	sequencer *TradeSequencer
+
+	// clients connector 自建的 REST 客户端，Close 时一并关闭
+	clients []*BinanceClient
 }
 
 func NewBinancePublicConnector(msgBus *messagebus.MessageBus) (*BinancePublicConnector, error) {
+	return NewBinancePublicConnectorWithConfig(msgBus, nil)
+}
+
+// NewBinancePublicConnectorWithConfig creates a connector, config picks between
+// per-connection (/ws) and combined stream (/stream) mode and the number of
+// redundant connection legs
+func NewBinancePublicConnectorWithConfig(msgBus *messagebus.MessageBus, config *base.WSConfig) (*BinancePublicConnector, error) {
+	if config == nil {
+		config = &base.WSConfig{}
+	}
 	connector := &BinancePublicConnector{
-		msgBus: msgBus,
+		msgBus:        msgBus,
+		market:        BinanceMarketTypes[BinanceAccountTypeUsdMFuturesTestnet],
+		redundant:     make(map[string]bool, len(config.RedundantSymbols)),
+		latency:       base.NewLatencyMonitor(),
+		latencyReport: config.LatencyReportInterval,
+		bars:          base.NewBarAggregator(),
+		backfills:     make(map[string]*aggTradeBackfill),
+	}
+	if connector.latencyReport == 0 {
+		connector.latencyReport = defaultLatencyReport
+	}
+	// historicalTrades 需要 API key，公共 connector 默认按归集成交补齐，见 SetTradeFetcher
+	history := NewBinancePublicClient(BinanceAccountTypeUsdMFuturesTestnet)
+	connector.clients = []*BinanceClient{history}
+	connector.history = history
+	connector.sequencer = NewTradeSequencer(nil, history, connector.publishTrade)
+	for _, symbol := range config.RedundantSymbols {
+		connector.redundant[strings.ToLower(symbol)] = true
 	}
 
-	wsClient, err := NewBinanceWSClient(
-		BinanceAccountTypeUsdMFuturesTestnet,
-		connector.HandleMessage,
-		msgBus,
-	)
-	if err != nil {
-		return nil, err
+	legs := max(config.FeedLegs, 1)
+	if legs > 1 {
+		connector.arbiter = NewFeedArbiter(legs)
+	}
+	if config.RecordDir != "" {
+		recorder, err := base.NewFrameRecorder(config.RecordDir, "binance", config.RecordRotateBytes)
+		if err != nil {
+			return nil, err
+		}
+		connector.recorder = recorder
+	}
+	for i := 0; i < legs; i++ {
+		legConfig := *config
+		if i < len(config.FeedLegURLs) && config.FeedLegURLs[i] != "" {
+			legConfig.URL = config.FeedLegURLs[i]
+		}
+
+		wsClient, err := NewBinanceWSClientWithConfig(
+			BinanceAccountTypeUsdMFuturesTestnet,
+			&legConfig,
+			connector.legHandler(i, "", connector.HandleMessage),
+			msgBus,
+		)
+		if err != nil {
+			connector.closeRecorder()
+			return nil, err
+		}
+		if legs > 1 {
+			wsClient.SetName(fmt.Sprintf("leg%d@%s", i, wsClient.url))
+		}
+		wsClient.SetRecorder(connector.recorder)
+		connector.legs = append(connector.legs, wsClient)
 	}
 
-	connector.wsClient = wsClient
 	return connector, nil
 }
 
 func (c *BinancePublicConnector) Connect() error {
-	return c.wsClient.Connect(context.Background())
+	c.latency.Start(c.latencyReport)
+	c.bars.Start(barFlushInterval)
+	for i, leg := range c.legs {
+		if err := leg.Connect(context.Background()); err != nil {
+			return fmt.Errorf("failed to connect leg %d: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func (c *BinancePublicConnector) Close() error {
-	return c.wsClient.Close()
+	c.latency.Stop()
+	c.bars.Stop()
+	var firstErr error
+	for _, leg := range c.legs {
+		if err := leg.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, client := range c.clients {
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := c.closeRecorder(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (c *BinancePublicConnector) closeRecorder() error {
+	if c.recorder == nil {
+		return nil
+	}
+	return c.recorder.Close()
+}
+
+// Replay feeds recorded frames through the primary leg as if they arrived live,
+// events are published on the message bus like live ones
+func (c *BinancePublicConnector) Replay(ctx context.Context, reader *base.FrameReader, replayer *base.Replayer) (int, error) {
+	return c.legs[0].Replay(ctx, reader, replayer)
+}
+
+// Latency returns the feed latency of every stream since the connector started, the
+// periodic summaries in the log cover one interval each
+func (c *BinancePublicConnector) Latency() map[string]base.StreamLatencySummary {
+	return c.latency.CumulativeSummary()
 }
 
 func (c *BinancePublicConnector) SubscribeTrade(symbol string) error {
-	return c.wsClient.SubscribeTrade(symbol)
+	return c.subscribe(symbol, "trade", c.handleTrade)
 }
 
-func (c *BinancePublicConnector) SubscribeBookL1(symbol string) error {
-	return c.wsClient.SubscribeBookL1(symbol)
+func (c *BinancePublicConnector) SubscribeAggTrade(symbol string) error {
+	return c.subscribe(symbol, "aggTrade", c.handleAggTrade)
 }
 
-func (c *BinancePublicConnector) HandleMessage(msg map[string]interface{}) error {
-	event := msg["e"]
-	switch event {
-	case "trade":
-		trade, err := c.HandleTradeMessage(msg)
-		if err != nil {
-			return fmt.Errorf("failed to handle trade message: %v", err)
+// SetAggTradeFetcher replaces the REST client historical aggregate trades are fetched
+// with, they also backfill trade gaps when historical trades are unavailable
+func (c *BinancePublicConnector) SetAggTradeFetcher(history AggTradeFetcher) {
+	c.history = history
+	c.sequencer.SetAggTradeFetcher(history)
+}
+
+// SetTradeFetcher sets the client trade gaps are backfilled with trade by trade, e.g. a
+// BinanceClient with an API key; without one gaps are filled from aggregate trades.
+// Call it before subscribing.
+func (c *BinancePublicConnector) SetTradeFetcher(trades TradeFetcher) {
+	c.sequencer.SetTradeFetcher(trades)
+}
+
+// TradeGapStats returns the trade sequence gap statistics of every symbol
+func (c *BinancePublicConnector) TradeGapStats() map[string]GapStats {
+	return c.sequencer.Stats()
+}
+
+// SubscribeAggTradeFrom publishes the aggregate trades of symbol since startTime as
+// "aggTrade", first the history and then the live stream, without gaps or duplicates
+// at the seam. It returns once the history is published.
+func (c *BinancePublicConnector) SubscribeAggTradeFrom(symbol string, startTime time.Time) error {
+	backfill := newAggTradeBackfill()
+	key := strings.ToUpper(symbol)
+	c.backfillMu.Lock()
+	c.backfills[key] = backfill
+	c.backfillMu.Unlock()
+
+	if err := c.SubscribeAggTrade(symbol); err != nil {
+		c.backfillMu.Lock()
+		delete(c.backfills, key)
+		c.backfillMu.Unlock()
+		return err
+	}
+
+	lastID, err := c.history.PageAggTrades(symbol, startTime.UnixMilli(), 0, func(trades []AggTrade) error {
+		now := time.Now()
+		for i := range trades {
+			trades[i].ReceivedAt = now
+			c.publishAggTrade(&trades[i])
 		}
-		if c.msgBus != nil {
-			c.msgBus.Send("trade", trade)
+		return nil
+	})
+	// 即使历史获取失败也切换为实时，避免实时事件一直积压
+	backfill.goLive(lastID, c.publishAggTrade)
+	if err != nil {
+		return fmt.Errorf("failed to backfill aggTrades of %s: %w", symbol, err)
+	}
+	return nil
+}
+
+// SubscribeBookL1 subscribes to the best bid and ask of symbol, published as "quote"
+func (c *BinancePublicConnector) SubscribeBookL1(symbol string) error {
+	return c.subscribe(symbol, "bookTicker", c.handleBookL1)
+}
+
+// SubscribeBookDepth subscribes to the partial book depth stream of symbol, levels is
+// 5, 10 or 20 and speed the update interval ("100ms", "500ms", ...), empty for the
+// exchange default. The levels are published as a snapshot delta on "bookDepth".
+//
+// 单条流模式下 partial depth 与增量深度的帧无法区分，BinanceWSClient 把同一 symbol 的
+// 两者放在不同的连接上按连接路由；现货 partial depth 不带事件类型与 symbol，只能在组合流模式下路由。
+func (c *BinancePublicConnector) SubscribeBookDepth(symbol string, levels int, speed string) error {
+	switch levels {
+	case 5, 10, 20:
+	default:
+		return fmt.Errorf("invalid book depth levels %d, must be 5, 10 or 20", levels)
+	}
+	stream := fmt.Sprintf("depth%d", levels)
+	if speed != "" {
+		stream += "@" + speed
+	}
+
+	symbol = strings.ToUpper(symbol)
+	return c.subscribe(symbol, stream, func(data []byte, event string, receivedAt time.Time) error {
+		return c.handleBookDepth(data, symbol, receivedAt)
+	})
+}
+
+// SubscribeKline subscribes to the exchange klines of symbol, published as base.Bar on
+// "kline" with Partial set until the kline closes
+func (c *BinancePublicConnector) SubscribeKline(symbol string, interval string) error {
+	return c.subscribe(symbol, klineStream(interval), c.handleKline)
+}
+
+// SubscribeMarkPrice subscribes to the mark price, index price and funding rate of a
+// perpetual, published as "markPrice". speed is "1s" or empty for every 3s.
+func (c *BinancePublicConnector) SubscribeMarkPrice(symbol string, speed string) error {
+	return c.subscribe(symbol, markPriceStream(speed), c.handleMarkPrice)
+}
+
+// SubscribeLiquidation subscribes to the liquidation orders of symbol, published as "liquidation"
+func (c *BinancePublicConnector) SubscribeLiquidation(symbol string) error {
+	return c.subscribe(symbol, "forceOrder", c.handleLiquidation)
+}
+
+// SubscribeAllLiquidations subscribes to the liquidation orders of every symbol,
+// published as "liquidation"
+func (c *BinancePublicConnector) SubscribeAllLiquidations() error {
+	return c.subscribe("", allLiquidationsStream, c.handleLiquidation)
+}
+
+// SubscribeTicker subscribes to the 24h ticker of symbol, or of every symbol if symbol
+// is empty, published as a base.TickerBatch on "ticker"
+func (c *BinancePublicConnector) SubscribeTicker(symbol string) error {
+	return c.subscribe(symbol, tickerStream(symbol, "ticker"), c.handleTickers)
+}
+
+// SubscribeMiniTicker subscribes to the 24h mini ticker of symbol, or of every symbol
+// if symbol is empty, published as a base.TickerBatch on "miniTicker"
+func (c *BinancePublicConnector) SubscribeMiniTicker(symbol string) error {
+	return c.subscribe(symbol, tickerStream(symbol, "miniTicker"), c.handleMiniTickers)
+}
+
+// SubscribeBars builds bars of symbol from its trade stream and publishes them as
+// "bar" when they close, subscribing to the trades if needed
+func (c *BinancePublicConnector) SubscribeBars(symbol string, spec base.BarSpec) error {
+	err := c.bars.Add(c.instrument(symbol), spec, func(bar *base.Bar) {
+		c.send("bar", bar)
+	})
+	if err != nil {
+		return err
+	}
+	return c.SubscribeTrade(symbol)
+}
+
+// UnsubscribeBars stops building bars of symbol with spec, the trade stream stays subscribed
+func (c *BinancePublicConnector) UnsubscribeBars(symbol string, spec base.BarSpec) {
+	c.bars.Remove(c.instrument(symbol), spec)
+}
+
+// instrument returns the instrument ID of symbol
+func (c *BinancePublicConnector) instrument(symbol string) base.InstrumentID {
+	return InstrumentID(c.market, strings.ToUpper(symbol))
+}
+
+// subscribe subscribes the stream on the primary leg, and on the standby legs for redundant symbols
+func (c *BinancePublicConnector) subscribe(symbol string, stream string, handler base.MessageHandler) error {
+	for i, leg := range c.legs {
+		if i > 0 && len(c.redundant) > 0 && !c.redundant[strings.ToLower(symbol)] {
+			break
 		}
-	case "bookTicker":
-		bookTicker, err := c.HandleBookL1Message(msg)
-		if err != nil {
-			return fmt.Errorf("failed to handle bookTicker message: %v", err)
+		if err := leg.SubscribeWithHandler(symbol, stream, c.legHandler(i, streamName(symbol, stream), handler)); err != nil {
+			return fmt.Errorf("leg %d: %w", i, err)
 		}
-		if c.msgBus != nil {
-			c.msgBus.Send("bookTicker", bookTicker)
+	}
+	return nil
+}
+
+// legHandler drops the copies of events of stream another leg already delivered, stream
+// is empty for the default handler
+func (c *BinancePublicConnector) legHandler(leg int, stream string, handler base.MessageHandler) base.MessageHandler {
+	if c.arbiter == nil {
+		return handler
+	}
+	return func(data []byte, event string, receivedAt time.Time) error {
+		if !c.arbiter.Accept(leg, stream, data, event, receivedAt) {
+			return nil
 		}
+		return handler(data, event, receivedAt)
+	}
+}
+
+// FeedStats returns which leg of the redundant feed wins and by how much, nil without redundancy
+func (c *BinancePublicConnector) FeedStats() []LegStats {
+	if c.arbiter == nil {
+		return nil
+	}
+	return c.arbiter.Stats()
+}
+
+// HandleMessage dispatches messages by their event type. depthUpdate 不在这里处理：
+// partial depth 与增量深度的事件类型相同、只能按 stream 区分，因此深度只通过
+// SubscribeBookDepth 和 BinanceWSClient.SubscribeDepth 注册的按 stream 的 handler 投递
+func (c *BinancePublicConnector) HandleMessage(data []byte, event string, receivedAt time.Time) error {
+	switch event {
+	case "trade":
+		return c.handleTrade(data, event, receivedAt)
+	case "aggTrade":
+		return c.handleAggTrade(data, event, receivedAt)
+	case "bookTicker":
+		return c.handleBookL1(data, event, receivedAt)
+	case "kline":
+		return c.handleKline(data, event, receivedAt)
+	case "markPriceUpdate":
+		return c.handleMarkPrice(data, event, receivedAt)
+	case "forceOrder":
+		return c.handleLiquidation(data, event, receivedAt)
+	case "24hrTicker":
+		return c.handleTickers(data, event, receivedAt)
+	case "24hrMiniTicker":
+		return c.handleMiniTickers(data, event, receivedAt)
 	}
 	return nil
 }
 
-// HandleTradeMessage converts raw message to Trade struct
-func (c *BinancePublicConnector) HandleTradeMessage(msg map[string]interface{}) (*Trade, error) {
-	return parseMessage[Trade](msg)
+// handleTrade hands a trade to the sequencer, which publishes it in order
+func (c *BinancePublicConnector) handleTrade(data []byte, event string, receivedAt time.Time) error {
+	trade := AcquireTrade()
+	defer ReleaseTrade(trade)
+	if err := DecodeTrade(data, trade); err != nil {
+		return fmt.Errorf("failed to handle trade message: %w", err)
+	}
+	decodedAt := time.Now()
+	trade.ReceivedAt = receivedAt
+	dispatchedAt := time.Now()
+	if c.sequencer != nil {
+		c.sequencer.Handle(trade)
+	} else {
+		c.publishTrade(trade)
+	}
+	c.observeLatency(trade.Symbol, "trade", trade.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
 }
 
-// HandleBookTickerMessage converts raw message to BookTicker struct
-func (c *BinancePublicConnector) HandleBookL1Message(msg map[string]interface{}) (*BookTicker, error) {
-	return parseMessage[BookTicker](msg)
+// publishTrade publishes a trade in sequence as a pooled base.TradeTick and feeds it
+// to the bar builders, subscribers must copy the tick if they keep it beyond the callback
+func (c *BinancePublicConnector) publishTrade(trade *Trade) {
+	tick := base.AcquireTradeTick()
+	defer base.ReleaseTradeTick(tick)
+	ToTradeTick(c.market, trade, tick)
+	c.send("trade", tick)
+	c.bars.Trade(tick.Instrument, tick.Price, tick.Quantity, trade.TradeTime)
 }
 
-// parseMessage is a generic function to handle websocket messages
-func parseMessage[T any](msg map[string]interface{}) (*T, error) {
-	jsonBytes, err := json.Marshal(msg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal message: %w", err)
+// handleMarkPrice publishes a pooled base.MarkPriceUpdate, subscribers must copy it if
+// they keep it beyond the callback
+func (c *BinancePublicConnector) handleMarkPrice(data []byte, event string, receivedAt time.Time) error {
+	markPrice := AcquireMarkPrice()
+	defer ReleaseMarkPrice(markPrice)
+	if err := DecodeMarkPrice(data, markPrice); err != nil {
+		return fmt.Errorf("failed to handle markPrice message: %w", err)
+	}
+	decodedAt := time.Now()
+	update := base.AcquireMarkPriceUpdate()
+	defer base.ReleaseMarkPriceUpdate(update)
+	ToMarkPriceUpdate(c.market, markPrice, receivedAt, update)
+	dispatchedAt := time.Now()
+	c.send("markPrice", update)
+	c.observeLatency(markPrice.Symbol, "markPrice", markPrice.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// handleLiquidation publishes a pooled base.Liquidation, subscribers must copy it if
+// they keep it beyond the callback
+func (c *BinancePublicConnector) handleLiquidation(data []byte, event string, receivedAt time.Time) error {
+	liquidation := AcquireLiquidation()
+	defer ReleaseLiquidation(liquidation)
+	if err := DecodeLiquidation(data, liquidation); err != nil {
+		return fmt.Errorf("failed to handle forceOrder message: %w", err)
+	}
+	decodedAt := time.Now()
+	l := base.AcquireLiquidation()
+	defer base.ReleaseLiquidation(l)
+	ToLiquidation(c.market, liquidation, receivedAt, l)
+	dispatchedAt := time.Now()
+	c.send("liquidation", l)
+	c.observeLatency(liquidation.Symbol, "forceOrder", liquidation.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// handleTickers publishes a pooled base.TickerBatch, subscribers must copy it if they
+// keep it beyond the callback
+func (c *BinancePublicConnector) handleTickers(data []byte, event string, receivedAt time.Time) error {
+	batch := AcquireTickerBatch()
+	defer ReleaseTickerBatch(batch)
+	if err := DecodeTickers(data, batch); err != nil {
+		return fmt.Errorf("failed to handle 24hrTicker message: %w", err)
+	}
+	decodedAt := time.Now()
+	if len(batch.Tickers) == 0 {
+		return nil
+	}
+	tickers := base.AcquireTickerBatch()
+	defer base.ReleaseTickerBatch(tickers)
+	ToTickerBatch(c.market, batch, receivedAt, tickers)
+	dispatchedAt := time.Now()
+	c.send("ticker", tickers)
+	c.observeLatency(batchSymbol(len(batch.Tickers), batch.Tickers[0].Symbol), "ticker", batch.Tickers[0].EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// handleMiniTickers publishes the mini tickers as a pooled base.TickerBatch,
+// subscribers must copy it if they keep it beyond the callback
+func (c *BinancePublicConnector) handleMiniTickers(data []byte, event string, receivedAt time.Time) error {
+	batch := AcquireMiniTickerBatch()
+	defer ReleaseMiniTickerBatch(batch)
+	if err := DecodeMiniTickers(data, batch); err != nil {
+		return fmt.Errorf("failed to handle 24hrMiniTicker message: %w", err)
+	}
+	decodedAt := time.Now()
+	if len(batch.Tickers) == 0 {
+		return nil
 	}
+	tickers := base.AcquireTickerBatch()
+	defer base.ReleaseTickerBatch(tickers)
+	MiniTickersToTickerBatch(c.market, batch, receivedAt, tickers)
+	dispatchedAt := time.Now()
+	c.send("miniTicker", tickers)
+	c.observeLatency(batchSymbol(len(batch.Tickers), batch.Tickers[0].Symbol), "miniTicker", batch.Tickers[0].EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// batchSymbol is the symbol latency of a batch is recorded under, all-market batches
+// are recorded as "!all"
+func batchSymbol(n int, first string) string {
+	if n > 1 {
+		return "!all"
+	}
+	return first
+}
+
+// handleKline publishes the kline as a pooled base.Bar, Partial until the kline
+// closes. Subscribers must copy it if they keep it beyond the callback.
+func (c *BinancePublicConnector) handleKline(data []byte, event string, receivedAt time.Time) error {
+	kline := AcquireKline()
+	defer ReleaseKline(kline)
+	if err := DecodeKline(data, kline); err != nil {
+		return fmt.Errorf("failed to handle kline message: %w", err)
+	}
+	decodedAt := time.Now()
+	bar := base.AcquireBar()
+	defer base.ReleaseBar(bar)
+	KlineToBar(c.market, kline, bar)
+	dispatchedAt := time.Now()
+	c.send("kline", bar)
+	c.observeLatency(kline.Symbol, "kline", kline.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// handleAggTrade publishes an aggregate trade unless a history backfill holds it back
+func (c *BinancePublicConnector) handleAggTrade(data []byte, event string, receivedAt time.Time) error {
+	trade := AcquireAggTrade()
+	defer ReleaseAggTrade(trade)
+	if err := DecodeAggTrade(data, trade); err != nil {
+		return fmt.Errorf("failed to handle aggTrade message: %w", err)
+	}
+	decodedAt := time.Now()
+	trade.ReceivedAt = receivedAt
+	if backfill := c.backfill(trade.Symbol); backfill != nil && !backfill.accept(trade) {
+		return nil
+	}
+	dispatchedAt := time.Now()
+	c.publishAggTrade(trade)
+	c.observeLatency(trade.Symbol, "aggTrade", trade.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// publishAggTrade publishes an aggregate trade as a pooled base.TradeTick, subscribers
+// must copy it if they keep it beyond the callback
+func (c *BinancePublicConnector) publishAggTrade(trade *AggTrade) {
+	if c.msgBus == nil {
+		return
+	}
+	tick := base.AcquireTradeTick()
+	defer base.ReleaseTradeTick(tick)
+	AggTradeToTradeTick(c.market, trade, tick)
+	c.send("aggTrade", tick)
+}
+
+// backfill returns the history backfill of symbol, nil if it has none
+func (c *BinancePublicConnector) backfill(symbol string) *aggTradeBackfill {
+	c.backfillMu.RLock()
+	defer c.backfillMu.RUnlock()
+	if len(c.backfills) == 0 {
+		return nil
+	}
+	return c.backfills[symbol]
+}
 
-	var result T
-	if err := json.Unmarshal(jsonBytes, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+// handleBookL1 publishes a pooled base.QuoteTick, subscribers must copy it if they
+// keep it beyond the callback
+func (c *BinancePublicConnector) handleBookL1(data []byte, event string, receivedAt time.Time) error {
+	bookTicker := AcquireBookTicker()
+	defer ReleaseBookTicker(bookTicker)
+	if err := DecodeBookTicker(data, bookTicker); err != nil {
+		return fmt.Errorf("failed to handle bookTicker message: %w", err)
 	}
+	decodedAt := time.Now()
+	quote := base.AcquireQuoteTick()
+	defer base.ReleaseQuoteTick(quote)
+	ToQuoteTick(c.market, bookTicker, receivedAt, quote)
+	dispatchedAt := time.Now()
+	c.send("quote", quote)
+	c.observeLatency(bookTicker.Symbol, "bookTicker", bookTicker.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// handleBookDepth publishes a partial book depth as a snapshot base.OrderBookDelta,
+// symbol fills in the symbol spot messages lack. Subscribers must copy the delta if
+// they keep it beyond the callback.
+func (c *BinancePublicConnector) handleBookDepth(data []byte, symbol string, receivedAt time.Time) error {
+	depth := AcquireBookDepth()
+	defer ReleaseBookDepth(depth)
+	if err := DecodeBookDepth(data, depth); err != nil {
+		return fmt.Errorf("failed to handle bookDepth message: %w", err)
+	}
+	decodedAt := time.Now()
+	if depth.Symbol == "" {
+		depth.Symbol = symbol
+	}
+	delta := base.AcquireOrderBookDelta()
+	defer base.ReleaseOrderBookDelta(delta)
+	BookDepthToDelta(c.market, depth, receivedAt, delta)
+	dispatchedAt := time.Now()
+	c.send("bookDepth", delta)
+	c.observeLatency(depth.Symbol, "bookDepth", depth.EventTime, receivedAt, decodedAt, dispatchedAt)
+	return nil
+}
+
+// send publishes msg on the message bus. 补齐的成交在后台 goroutine 上发布，
+// 加锁保证同一 connector 的行情 handler 不会并发执行
+func (c *BinancePublicConnector) send(topic string, msg interface{}) {
+	if c.msgBus == nil {
+		return
+	}
+	c.busMu.Lock()
+	defer c.busMu.Unlock()
+	c.msgBus.Send(topic, msg)
+}
 
-	return &result, nil
+// observeLatency records the latency stages of an event once the bus handlers returned,
+// dispatchedAt is the time it was handed to the bus
+func (c *BinancePublicConnector) observeLatency(symbol string, event string, eventTime int64, receivedAt, decodedAt, dispatchedAt time.Time) {
+	var buf [64]byte
+	key := appendStreamKey(buf[:0], symbol, event)
+	c.latency.Stream(key).Observe(eventTime, receivedAt, decodedAt, dispatchedAt, time.Now())
+}
+
+// HandleTradeMessage converts raw message to Trade struct
+func (c *BinancePublicConnector) HandleTradeMessage(data []byte) (*Trade, error) {
+	trade := new(Trade)
+	if err := DecodeTrade(data, trade); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// HandleBookTickerMessage converts raw message to BookTicker struct
+func (c *BinancePublicConnector) HandleBookL1Message(data []byte) (*BookTicker, error) {
+	bookTicker := new(BookTicker)
+	if err := DecodeBookTicker(data, bookTicker); err != nil {
+		return nil, err
+	}
+	return bookTicker, nil
 }
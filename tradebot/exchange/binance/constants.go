@@ -1,5 +1,12 @@
 package binance
 
+import (
+	"time"
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
 // Trade represents a trade message from Binance
 //
 //	{
@@ -18,12 +25,47 @@ type Trade struct {
     EventTime  int64  `json:"E" validate:"required"`
     Symbol     string `json:"s" validate:"required"`
     TradeID    int64  `json:"t" validate:"required"`
-    Price      string `json:"p" validate:"required"`
-    Quantity   string `json:"q" validate:"required"`
+    Price      decimal.Decimal `json:"p" validate:"required"`
+    Quantity   decimal.Decimal `json:"q" validate:"required"`
     TradeTime  int64  `json:"T" validate:"required"`
     IsMaker    bool   `json:"m" validate:"required"`
     Ignore     bool   `json:"M"`
     MarketType string `json:"X"`
+    // ReceivedAt 本地收到该成交的时间，不来自 JSON
+    ReceivedAt time.Time `json:"-"`
+}
+
+// AggTrade represents an aggregate trade, the websocket event and the REST
+// aggTrades response share the field names (REST 没有 e / E / s)
+//
+//	{
+//		"e": "aggTrade",    // Event type
+//		"E": 1672515782136, // Event time
+//		"s": "BNBBTC",      // Symbol
+//		"a": 12345,         // Aggregate trade ID
+//		"p": "0.001",       // Price
+//		"q": "100",         // Quantity
+//		"f": 100,           // First trade ID
+//		"l": 105,           // Last trade ID
+//		"T": 1672515782136, // Trade time
+//		"m": true,          // Is the buyer the market maker?
+//		"M": true           // Was the trade the best price match? (spot REST)
+//	}
+type AggTrade struct {
+	EventType    string          `json:"e"`
+	EventTime    int64           `json:"E"`
+	Symbol       string          `json:"s"`
+	AggTradeID   int64           `json:"a"`
+	Price        decimal.Decimal `json:"p"`
+	Quantity     decimal.Decimal `json:"q"`
+	FirstTradeID int64           `json:"f"`
+	LastTradeID  int64           `json:"l"`
+	TradeTime    int64           `json:"T"`
+	IsMaker      bool            `json:"m"`
+	// BestMatch 需要单独声明，否则 encoding/json 会把 "M" 大小写不敏感地写进 IsMaker
+	BestMatch bool `json:"M"`
+	// ReceivedAt 本地收到该成交的时间，不来自 JSON
+	ReceivedAt time.Time `json:"-"`
 }
 
 // bookTicker
@@ -37,12 +79,246 @@ type Trade struct {
 //		"A":"40.66000000"  // best ask qty
 //	}
 type BookTicker struct {
-	UpdateID int64  `json:"u"`
-	Symbol   string `json:"s"`
-	BidPrice string `json:"b"`
-	BidQty   string `json:"B"`
-	AskPrice string `json:"a"`
-	AskQty   string `json:"A"`
+	UpdateID int64           `json:"u"`
+	Symbol   string          `json:"s"`
+	BidPrice decimal.Decimal `json:"b"`
+	BidQty   decimal.Decimal `json:"B"`
+	AskPrice decimal.Decimal `json:"a"`
+	AskQty   decimal.Decimal `json:"A"`
+	// 期货 bookTicker 才有事件类型、事件时间与撮合时间，现货为空
+	EventType       string `json:"e"`
+	EventTime       int64  `json:"E"`
+	TransactionTime int64  `json:"T"`
+}
+
+// BookDepth is a partial book depth message (<symbol>@depth<levels>), the top
+// levels of the book pushed periodically
+//
+//	futures:
+//	{
+//		"e": "depthUpdate", // Event type
+//		"E": 1571889248277, // Event time
+//		"T": 1571889248276, // Transaction time
+//		"s": "BTCUSDT",
+//		"U": 390497796,     // First update ID in event
+//		"u": 390497878,     // Final update ID in event
+//		"pu": 390497794,    // Final update Id in last stream
+//		"b": [["7403.89", "0.002"]],
+//		"a": [["7405.96", "3.340"]]
+//	}
+//
+//	spot (没有事件类型与 symbol，由订阅补上):
+//	{
+//		"lastUpdateId": 160,
+//		"bids": [["0.0024", "10"]],
+//		"asks": [["0.0026", "100"]]
+//	}
+type BookDepth struct {
+	EventType         string
+	EventTime         int64
+	TransactionTime   int64
+	Symbol            string
+	FirstUpdateID     int64
+	LastUpdateID      int64
+	PrevFinalUpdateID int64
+	Bids              []base.PriceLevel
+	Asks              []base.PriceLevel
+}
+
+// Kline is a kline/candlestick message (<symbol>@kline_<interval>)
+//
+//	{
+//		"e": "kline",         // Event type
+//		"E": 1672515782136,   // Event time
+//		"s": "BNBBTC",        // Symbol
+//		"k": {
+//			"t": 1672515780000, // Kline start time
+//			"T": 1672515839999, // Kline close time
+//			"s": "BNBBTC",      // Symbol
+//			"i": "1m",          // Interval
+//			"f": 100,           // First trade ID
+//			"L": 200,           // Last trade ID
+//			"o": "0.0010",      // Open price
+//			"c": "0.0020",      // Close price
+//			"h": "0.0025",      // High price
+//			"l": "0.0015",      // Low price
+//			"v": "1000",        // Base asset volume
+//			"n": 100,           // Number of trades
+//			"x": false,         // Is this kline closed?
+//			"q": "1.0000",      // Quote asset volume
+//			"V": "500",         // Taker buy base asset volume
+//			"Q": "0.500",       // Taker buy quote asset volume
+//			"B": "123456"       // Ignore
+//		}
+//	}
+type Kline struct {
+	EventType string
+	EventTime int64
+	Symbol    string
+	StartTime int64
+	CloseTime int64
+	Interval  string
+	// FirstTradeID 周期内没有成交时为 -1
+	FirstTradeID        int64
+	LastTradeID         int64
+	Open                decimal.Decimal
+	Close               decimal.Decimal
+	High                decimal.Decimal
+	Low                 decimal.Decimal
+	Volume              decimal.Decimal
+	QuoteVolume         decimal.Decimal
+	TakerBuyVolume      decimal.Decimal
+	TakerBuyQuoteVolume decimal.Decimal
+	Trades              int64
+	// IsClosed 为 false 时是当前周期的实时更新
+	IsClosed bool
+}
+
+// MarkPrice is a futures mark price message (<symbol>@markPrice[@1s])
+//
+//	{
+//		"e": "markPriceUpdate",   // Event type
+//		"E": 1562305380000,       // Event time
+//		"s": "BTCUSDT",           // Symbol
+//		"p": "11794.15000000",    // Mark price
+//		"i": "11784.62659091",    // Index price
+//		"P": "11784.25641265",    // Estimated settle price, only useful in the last hour before the settlement starts
+//		"r": "0.00038167",        // Funding rate
+//		"T": 1562306400000        // Next funding time
+//	}
+type MarkPrice struct {
+	EventType            string
+	EventTime            int64
+	Symbol               string
+	MarkPrice            decimal.Decimal
+	IndexPrice           decimal.Decimal
+	EstimatedSettlePrice decimal.Decimal
+	// FundingRate 交割合约为空 (0)
+	FundingRate     decimal.Decimal
+	NextFundingTime int64
+}
+
+// Liquidation is a futures liquidation order message (<symbol>@forceOrder, !forceOrder@arr)
+//
+//	{
+//		"e": "forceOrder",          // Event type
+//		"E": 1568014460893,         // Event time
+//		"o": {
+//			"s": "BTCUSDT",           // Symbol
+//			"S": "SELL",              // Side
+//			"o": "LIMIT",             // Order type
+//			"f": "IOC",               // Time in force
+//			"q": "0.014",             // Original quantity
+//			"p": "9910",              // Price
+//			"ap": "9910",             // Average price
+//			"X": "FILLED",            // Order status
+//			"l": "0.014",             // Order last filled quantity
+//			"z": "0.014",             // Order filled accumulated quantity
+//			"T": 1568014460893        // Order trade time
+//		}
+//	}
+type Liquidation struct {
+	EventType     string
+	EventTime     int64
+	Symbol        string
+	Side          string
+	OrderType     string
+	TimeInForce   string
+	Quantity      decimal.Decimal
+	Price         decimal.Decimal
+	AveragePrice  decimal.Decimal
+	Status        string
+	LastFilledQty decimal.Decimal
+	FilledQty     decimal.Decimal
+	TradeTime     int64
+}
+
+// Ticker is a rolling 24h ticker (<symbol>@ticker, !ticker@arr)
+//
+//	{
+//		"e": "24hrTicker",  // Event type
+//		"E": 1672515782136, // Event time
+//		"s": "BNBBTC",      // Symbol
+//		"p": "0.0015",      // Price change
+//		"P": "250.00",      // Price change percent
+//		"w": "0.0018",      // Weighted average price
+//		"c": "0.0025",      // Last price
+//		"Q": "10",          // Last quantity
+//		"b": "0.0024",      // Best bid price (spot)
+//		"B": "10",          // Best bid quantity (spot)
+//		"a": "0.0026",      // Best ask price (spot)
+//		"A": "100",         // Best ask quantity (spot)
+//		"o": "0.0010",      // Open price
+//		"h": "0.0025",      // High price
+//		"l": "0.0010",      // Low price
+//		"v": "10000",       // Total traded base asset volume
+//		"q": "18",          // Total traded quote asset volume
+//		"O": 0,             // Statistics open time
+//		"C": 86400000,      // Statistics close time
+//		"F": 0,             // First trade ID
+//		"L": 18150,         // Last trade Id
+//		"n": 18151          // Total number of trades
+//	}
+type Ticker struct {
+	EventType          string
+	EventTime          int64
+	Symbol             string
+	PriceChange        decimal.Decimal
+	PriceChangePercent decimal.Decimal
+	WeightedAvgPrice   decimal.Decimal
+	LastPrice          decimal.Decimal
+	LastQty            decimal.Decimal
+	// 期货 ticker 没有最优买卖价
+	BidPrice     decimal.Decimal
+	BidQty       decimal.Decimal
+	AskPrice     decimal.Decimal
+	AskQty       decimal.Decimal
+	OpenPrice    decimal.Decimal
+	HighPrice    decimal.Decimal
+	LowPrice     decimal.Decimal
+	Volume       decimal.Decimal
+	QuoteVolume  decimal.Decimal
+	OpenTime     int64
+	CloseTime    int64
+	FirstTradeID int64
+	LastTradeID  int64
+	Trades       int64
+}
+
+// MiniTicker is a rolling 24h mini ticker (<symbol>@miniTicker, !miniTicker@arr)
+//
+//	{
+//		"e": "24hrMiniTicker", // Event type
+//		"E": 1672515782136,    // Event time
+//		"s": "BNBBTC",         // Symbol
+//		"c": "0.0025",         // Close price
+//		"o": "0.0010",         // Open price
+//		"h": "0.0025",         // High price
+//		"l": "0.0010",         // Low price
+//		"v": "10000",          // Total traded base asset volume
+//		"q": "18"              // Total traded quote asset volume
+//	}
+type MiniTicker struct {
+	EventType   string
+	EventTime   int64
+	Symbol      string
+	ClosePrice  decimal.Decimal
+	OpenPrice   decimal.Decimal
+	HighPrice   decimal.Decimal
+	LowPrice    decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+}
+
+// TickerBatch is the tickers of one message, the all-market stream carries every
+// symbol that changed, a per-symbol stream exactly one
+type TickerBatch struct {
+	Tickers []Ticker
+}
+
+// MiniTickerBatch is the mini tickers of one message
+type MiniTickerBatch struct {
+	Tickers []MiniTicker
 }
 
 type BinanceAccountType string
@@ -59,6 +335,22 @@ const (
 	BinanceAccountTypeCoinMFuturesTestnet BinanceAccountType = "COIN_M_FUTURE_TESTNET"
 )
 
+// BinanceExchange is the exchange of Binance instrument IDs
+const BinanceExchange = "binance"
+
+// BinanceMarketTypes maps account types to the market their instruments trade on
+var BinanceMarketTypes = map[BinanceAccountType]base.MarketType{
+	BinanceAccountTypeSpot:                base.MarketTypeSpot,
+	BinanceAccountTypeMargin:              base.MarketTypeMargin,
+	BinanceAccountTypeIsolatedMargin:      base.MarketTypeMargin,
+	BinanceAccountTypeUsdMFutures:         base.MarketTypeLinear,
+	BinanceAccountTypeCoinMFutures:        base.MarketTypeInverse,
+	BinanceAccountTypePortfolioMargin:     base.MarketTypeLinear,
+	BinanceAccountTypeSpotTestnet:         base.MarketTypeSpot,
+	BinanceAccountTypeUsdMFuturesTestnet:  base.MarketTypeLinear,
+	BinanceAccountTypeCoinMFuturesTestnet: base.MarketTypeInverse,
+}
+
 // WebSocketURLs maps account types to their WebSocket endpoints
 var BinanceWebSocketURLs = map[BinanceAccountType]string{
 	BinanceAccountTypeSpot:                "wss://stream.binance.com:9443/ws",
@@ -72,6 +364,154 @@ var BinanceWebSocketURLs = map[BinanceAccountType]string{
 	BinanceAccountTypeCoinMFuturesTestnet: "wss://dstream.binancefuture.com/ws",
 }
 
+// BinanceCombinedStreamURLs maps account types to their combined stream endpoints.
+// Streams on these endpoints are wrapped as {"stream":"<name>","data":{...}}.
+var BinanceCombinedStreamURLs = map[BinanceAccountType]string{
+	BinanceAccountTypeSpot:                "wss://stream.binance.com:9443/stream",
+	BinanceAccountTypeMargin:              "wss://stream.binance.com:9443/stream",
+	BinanceAccountTypeIsolatedMargin:      "wss://stream.binance.com:9443/stream",
+	BinanceAccountTypeUsdMFutures:         "wss://fstream.binance.com/stream",
+	BinanceAccountTypeCoinMFutures:        "wss://dstream.binance.com/stream",
+	BinanceAccountTypePortfolioMargin:     "wss://fstream.binance.com/pm/stream",
+	BinanceAccountTypeSpotTestnet:         "wss://testnet.binance.vision/stream",
+	BinanceAccountTypeUsdMFuturesTestnet:  "wss://stream.binancefuture.com/stream",
+	BinanceAccountTypeCoinMFuturesTestnet: "wss://dstream.binancefuture.com/stream",
+}
+
+// BinanceMaxStreamsPerConn is the number of streams a single connection may subscribe to
+var BinanceMaxStreamsPerConn = map[BinanceAccountType]int{
+	BinanceAccountTypeSpot:                1024,
+	BinanceAccountTypeMargin:              1024,
+	BinanceAccountTypeIsolatedMargin:      1024,
+	BinanceAccountTypeUsdMFutures:         200,
+	BinanceAccountTypeCoinMFutures:        200,
+	BinanceAccountTypePortfolioMargin:     200,
+	BinanceAccountTypeSpotTestnet:         1024,
+	BinanceAccountTypeUsdMFuturesTestnet:  200,
+	BinanceAccountTypeCoinMFuturesTestnet: 200,
+}
+
+// BinanceMaxMessagesPerSecond is the number of incoming messages (SUBSCRIBE, pong, ...)
+// Binance accepts per connection and second
+var BinanceMaxMessagesPerSecond = map[BinanceAccountType]int{
+	BinanceAccountTypeSpot:                5,
+	BinanceAccountTypeMargin:              5,
+	BinanceAccountTypeIsolatedMargin:      5,
+	BinanceAccountTypeUsdMFutures:         10,
+	BinanceAccountTypeCoinMFutures:        10,
+	BinanceAccountTypePortfolioMargin:     10,
+	BinanceAccountTypeSpotTestnet:         5,
+	BinanceAccountTypeUsdMFuturesTestnet:  10,
+	BinanceAccountTypeCoinMFuturesTestnet: 10,
+}
+
+// BinanceHistoricalTradesEndpoints maps account types to their historical trades endpoint
+var BinanceHistoricalTradesEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeSpot:                "/api/v3/historicalTrades",
+	BinanceAccountTypeMargin:              "/api/v3/historicalTrades",
+	BinanceAccountTypeIsolatedMargin:      "/api/v3/historicalTrades",
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/historicalTrades",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/historicalTrades",
+	BinanceAccountTypePortfolioMargin:     "/fapi/v1/historicalTrades",
+	BinanceAccountTypeSpotTestnet:         "/api/v3/historicalTrades",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/historicalTrades",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/historicalTrades",
+}
+
+// BinanceAggTradesEndpoints maps account types to their aggregate trades endpoint
+var BinanceAggTradesEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeSpot:                "/api/v3/aggTrades",
+	BinanceAccountTypeMargin:              "/api/v3/aggTrades",
+	BinanceAccountTypeIsolatedMargin:      "/api/v3/aggTrades",
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/aggTrades",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/aggTrades",
+	BinanceAccountTypePortfolioMargin:     "/fapi/v1/aggTrades",
+	BinanceAccountTypeSpotTestnet:         "/api/v3/aggTrades",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/aggTrades",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/aggTrades",
+}
+
+// BinancePremiumIndexEndpoints maps futures account types to their mark price and
+// funding rate endpoint
+var BinancePremiumIndexEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/premiumIndex",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/premiumIndex",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/premiumIndex",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/premiumIndex",
+}
+
+// BinanceFundingRateEndpoints maps futures account types to their funding rate history endpoint
+var BinanceFundingRateEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/fundingRate",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/fundingRate",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/fundingRate",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/fundingRate",
+}
+
+// BinanceDepthEndpoints maps account types to their order book snapshot endpoint
+var BinanceDepthEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeSpot:                "/api/v3/depth",
+	BinanceAccountTypeMargin:              "/api/v3/depth",
+	BinanceAccountTypeIsolatedMargin:      "/api/v3/depth",
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/depth",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/depth",
+	BinanceAccountTypePortfolioMargin:     "/fapi/v1/depth",
+	BinanceAccountTypeSpotTestnet:         "/api/v3/depth",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/depth",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/depth",
+}
+
+// BinanceTimeEndpoints maps account types to their server time endpoint
+var BinanceTimeEndpoints = map[BinanceAccountType]string{
+	BinanceAccountTypeSpot:                "/api/v3/time",
+	BinanceAccountTypeMargin:              "/api/v3/time",
+	BinanceAccountTypeIsolatedMargin:      "/api/v3/time",
+	BinanceAccountTypeUsdMFutures:         "/fapi/v1/time",
+	BinanceAccountTypeCoinMFutures:        "/dapi/v1/time",
+	BinanceAccountTypePortfolioMargin:     "/fapi/v1/time",
+	BinanceAccountTypeSpotTestnet:         "/api/v3/time",
+	BinanceAccountTypeUsdMFuturesTestnet:  "/fapi/v1/time",
+	BinanceAccountTypeCoinMFuturesTestnet: "/dapi/v1/time",
+}
+
+// BinanceOrderEndpoints is the order endpoint family of a spot or margin account type
+type BinanceOrderEndpoints struct {
+	Order      string
+	OpenOrders string
+	AllOrders  string
+	MyTrades   string
+	OCO        string
+	// OTOCO 为空表示不支持
+	OTOCO     string
+	OrderList string
+}
+
+var spotOrderEndpoints = BinanceOrderEndpoints{
+	Order:      "/api/v3/order",
+	OpenOrders: "/api/v3/openOrders",
+	AllOrders:  "/api/v3/allOrders",
+	MyTrades:   "/api/v3/myTrades",
+	OCO:        "/api/v3/orderList/oco",
+	OTOCO:      "/api/v3/orderList/otoco",
+	OrderList:  "/api/v3/orderList",
+}
+
+var marginOrderEndpoints = BinanceOrderEndpoints{
+	Order:      "/sapi/v1/margin/order",
+	OpenOrders: "/sapi/v1/margin/openOrders",
+	AllOrders:  "/sapi/v1/margin/allOrders",
+	MyTrades:   "/sapi/v1/margin/myTrades",
+	OCO:        "/sapi/v1/margin/order/oco",
+	OrderList:  "/sapi/v1/margin/orderList",
+}
+
+// BinanceSpotOrderEndpoints maps spot and margin account types to their order endpoints
+var BinanceSpotOrderEndpoints = map[BinanceAccountType]BinanceOrderEndpoints{
+	BinanceAccountTypeSpot:           spotOrderEndpoints,
+	BinanceAccountTypeSpotTestnet:    spotOrderEndpoints,
+	BinanceAccountTypeMargin:         marginOrderEndpoints,
+	BinanceAccountTypeIsolatedMargin: marginOrderEndpoints,
+}
 
 var BinanceHttpURLs = map[BinanceAccountType]string{
 	BinanceAccountTypeSpot:                "https://api.binance.com",
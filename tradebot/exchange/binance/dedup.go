@@ -0,0 +1,94 @@
+package binance
+
+import (
+	"sync"
+	"time"
+)
+
+// dedupWindow is the number of recent IDs remembered per stream key, duplicates
+// from a parallel connection arrive within a few milliseconds of the original
+const dedupWindow = 256
+
+// arrival records which leg delivered an ID first and when
+type arrival struct {
+	id  int64
+	leg int
+	at  time.Time
+}
+
+// idWindow remembers the last dedupWindow arrivals of one key
+type idWindow struct {
+	max  int64
+	ring [dedupWindow]arrival
+	size int
+	next int
+}
+
+// Deduper drops messages that were already delivered, e.g. while two connections
+// carry the same streams during a rotation. Messages are identified by their stream
+// and an ID from the payload: trade ID, aggregate trade ID, book update ID, kline
+// open time and trade count, liquidation time, or the event time of periodic
+// snapshots (mark price, tickers). Messages without any ID always pass.
+type Deduper struct {
+	mu      sync.Mutex
+	windows map[string]*idWindow
+}
+
+func NewDeduper() *Deduper {
+	return &Deduper{
+		windows: make(map[string]*idWindow),
+	}
+}
+
+// Duplicate reports whether the message of stream was seen before, and records it if
+// not. stream may be empty in raw mode, the key then falls back to symbol and event type.
+func (d *Deduper) Duplicate(stream string, meta *frameMeta) bool {
+	if !meta.hasID {
+		return false
+	}
+	var buf [64]byte
+	_, dup := d.arrive(meta.key(buf[:0], stream), meta.id, 0, time.Time{})
+	return dup
+}
+
+// arrive records the arrival of id, if it was seen before it returns the first arrival
+func (d *Deduper) arrive(key []byte, id int64, leg int, at time.Time) (arrival, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.windows[string(key)]
+	if !ok {
+		w = &idWindow{}
+		d.windows[string(key)] = w
+	}
+
+	// IDs mostly increase, only older ones need the window scan
+	if w.size == 0 || id > w.max {
+		w.max = id
+	} else {
+		for i := 0; i < w.size; i++ {
+			if w.ring[i].id == id {
+				return w.ring[i], true
+			}
+		}
+	}
+
+	w.ring[w.next] = arrival{id: id, leg: leg, at: at}
+	w.next = (w.next + 1) % dedupWindow
+	w.size = min(w.size+1, dedupWindow)
+	return arrival{}, false
+}
+
+// key appends the dedup key of the frame: the stream name if known, "symbol@event" otherwise.
+// 全市场流 (!forceOrder@arr) 上不同 symbol 的 ID 互不相关，key 再加上 symbol
+func (m *frameMeta) key(buf []byte, stream string) []byte {
+	if stream == "" {
+		return m.rawKey(buf)
+	}
+	buf = append(buf, stream...)
+	if stream[0] == '!' && len(m.symbol) > 0 {
+		buf = append(buf, '|')
+		buf = append(buf, m.symbol...)
+	}
+	return buf
+}
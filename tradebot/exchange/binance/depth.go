@@ -0,0 +1,383 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"tradebot_go/tradebot/base"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+	"github.com/shopspring/decimal"
+)
+
+// 本地订单簿同步，按 Binance 的规则：
+//  1. 订阅 <symbol>@depth 增量流，先缓存收到的事件
+//  2. 通过 REST 获取深度快照
+//  3. 丢弃 u < lastUpdateId 的事件 (现货为 u <= lastUpdateId)
+//  4. 第一个应用的事件须满足 U <= lastUpdateId <= u (现货为 lastUpdateId+1)
+//  5. 之后每个事件的 pu 须等于上一个事件的 u (现货为 U 等于上一个 u+1)，否则重新同步
+
+const (
+	// depthSnapshotLimit 快照档位数
+	depthSnapshotLimit = 1000
+	// depthBufferLimit 等待快照期间最多缓存的事件数，超过后重新获取快照
+	depthBufferLimit = 10000
+	// depthPublishLevels 发布到消息总线的档位数
+	depthPublishLevels = 20
+)
+
+// depthUpdate
+//
+//	{
+//		"e": "depthUpdate", // Event type
+//		"E": 123456789,     // Event time
+//		"T": 123456788,     // Transaction time (futures)
+//		"s": "BTCUSDT",     // Symbol
+//		"U": 157,           // First update ID in event
+//		"u": 160,           // Final update ID in event
+//		"pu": 149,          // Final update Id in last stream (futures)
+//		"b": [["0.0024", "10"]],
+//		"a": [["0.0026", "100"]]
+//	}
+type DepthUpdate struct {
+	EventType         string
+	EventTime         int64
+	TransactionTime   int64
+	Symbol            string
+	FirstUpdateID     int64
+	FinalUpdateID     int64
+	PrevFinalUpdateID int64
+	// HasPrev 期货事件带 pu 字段，按 pu 检查连续性
+	HasPrev bool
+	Bids    []base.PriceLevel
+	Asks    []base.PriceLevel
+	// ReceivedAt 本地收到该事件的时间，由订阅方设置
+	ReceivedAt time.Time
+}
+
+// DecodeDepthUpdate decodes a depthUpdate event into u, reusing its level slices
+func DecodeDepthUpdate(data []byte, u *DepthUpdate) error {
+	var err error
+	u.EventTime, u.TransactionTime, u.PrevFinalUpdateID = 0, 0, 0
+	u.FirstUpdateID, u.FinalUpdateID = 0, 0
+	u.HasPrev = false
+	u.Bids, u.Asks = u.Bids[:0], u.Asks[:0]
+
+	scanErr := base.ObjectEach(data, func(key, value []byte) bool {
+		switch string(key) {
+		case "e":
+			u.EventType = base.Intern(value)
+		case "E":
+			u.EventTime, err = base.ParseInt(value)
+		case "T":
+			u.TransactionTime, err = base.ParseInt(value)
+		case "s":
+			base.SetString(&u.Symbol, value)
+		case "U":
+			u.FirstUpdateID, err = base.ParseInt(value)
+		case "u":
+			u.FinalUpdateID, err = base.ParseInt(value)
+		case "pu":
+			u.PrevFinalUpdateID, err = base.ParseInt(value)
+			u.HasPrev = true
+		case "b":
+			u.Bids, err = decodeLevels(value, u.Bids)
+		case "a":
+			u.Asks, err = decodeLevels(value, u.Asks)
+		}
+		return err == nil
+	})
+	if scanErr != nil {
+		return fmt.Errorf("failed to decode depthUpdate: %w", scanErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode depthUpdate: %w", err)
+	}
+	if u.Symbol == "" || u.FinalUpdateID == 0 {
+		return fmt.Errorf("failed to decode depthUpdate: missing required fields")
+	}
+	return nil
+}
+
+// decodeLevels appends the [["price","qty"], ...] levels of data to levels
+func decodeLevels(data []byte, levels []base.PriceLevel) ([]base.PriceLevel, error) {
+	err := base.ArrayEach(data, func(value []byte) error {
+		var level base.PriceLevel
+		i := 0
+		err := base.ArrayEach(value, func(field []byte) error {
+			d, err := base.ParseDecimal(field)
+			if err != nil {
+				return err
+			}
+			switch i {
+			case 0:
+				level.Price = d
+			case 1:
+				level.Quantity = d
+			}
+			i++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if i < 2 {
+			return fmt.Errorf("price level %s: %w", value, base.ErrInvalidValue)
+		}
+		levels = append(levels, level)
+		return nil
+	})
+	return levels, err
+}
+
+// DepthSnapshot is the REST order book snapshot
+type DepthSnapshot struct {
+	LastUpdateID    int64                `json:"lastUpdateId"`
+	EventTime       int64                `json:"E"`
+	TransactionTime int64                `json:"T"`
+	Bids            [][2]decimal.Decimal `json:"bids"`
+	Asks            [][2]decimal.Decimal `json:"asks"`
+}
+
+func snapshotLevels(levels [][2]decimal.Decimal) []base.PriceLevel {
+	result := make([]base.PriceLevel, len(levels))
+	for i, level := range levels {
+		result[i] = base.PriceLevel{Price: level[0], Quantity: level[1]}
+	}
+	return result
+}
+
+// DepthSnapshotter fetches order book snapshots, BinanceClient implements it
+type DepthSnapshotter interface {
+	GetDepth(symbol string, limit int) (*DepthSnapshot, error)
+}
+
+// snapshotResult is the outcome of lining up a snapshot with the buffered events
+type snapshotResult int
+
+const (
+	snapshotApplied snapshotResult = iota
+	// snapshotWaiting 缓存的事件都早于快照，等待后续事件
+	snapshotWaiting
+	// snapshotStale 快照与事件之间有缺口，需要重新获取
+	snapshotStale
+)
+
+// depthSync keeps the local book of one symbol in sync with the diff stream, every
+// change applied to the book is published as a delta before the book itself
+type depthSync struct {
+	symbol       string
+	market       base.MarketType
+	book         *base.OrderBook
+	snapshotter  DepthSnapshotter
+	publish      func(view *base.OrderBookView)
+	publishDelta func(delta *base.OrderBookDelta)
+	// delta 复用的增量对象，只在 publishDelta 回调期间有效
+	delta base.OrderBookDelta
+
+	// ctx 在 close 时取消，结束仍在重试的快照请求
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// synced 为 false 时事件进入 buffer，等待快照
+	synced   bool
+	fetching bool
+	snapshot *DepthSnapshot
+	buffer   []*DepthUpdate
+	lastID   int64
+	closed   bool
+}
+
+// newDepthSync creates the sync of one order book, it stops when ctx is done or it is closed
+func newDepthSync(ctx context.Context, symbol string, market base.MarketType, snapshotter DepthSnapshotter,
+	publish func(view *base.OrderBookView), publishDelta func(delta *base.OrderBookDelta)) *depthSync {
+	ctx, cancel := context.WithCancel(ctx)
+	return &depthSync{
+		symbol:       symbol,
+		market:       market,
+		book:         base.NewOrderBook(symbol),
+		snapshotter:  snapshotter,
+		publish:      publish,
+		publishDelta: publishDelta,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// handle processes a diff event, u must not be reused by the caller
+func (s *depthSync) handle(u *DepthUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if !s.synced {
+		s.bufferUpdate(u)
+		return
+	}
+	if !continuous(s.lastID, u) {
+		log.Warnf("Order book %s gap: last update %d, event U=%d u=%d pu=%d, resyncing",
+			s.symbol, s.lastID, u.FirstUpdateID, u.FinalUpdateID, u.PrevFinalUpdateID)
+		s.synced = false
+		s.buffer = s.buffer[:0]
+		s.bufferUpdate(u)
+		return
+	}
+	s.apply(u)
+}
+
+// bufferUpdate keeps u until it can be applied on a snapshot, must be called with s.mu held
+func (s *depthSync) bufferUpdate(u *DepthUpdate) {
+	if len(s.buffer) >= depthBufferLimit {
+		log.Warnf("Order book %s buffered %d events without a usable snapshot, refetching", s.symbol, len(s.buffer))
+		s.buffer = s.buffer[:0]
+		s.snapshot = nil
+	}
+	s.buffer = append(s.buffer, u)
+
+	if s.snapshot != nil {
+		switch s.applySnapshot(s.snapshot) {
+		case snapshotWaiting:
+			return
+		case snapshotStale:
+			s.snapshot = nil
+		case snapshotApplied:
+			s.snapshot = nil
+			return
+		}
+	}
+	if !s.fetching {
+		s.fetching = true
+		go s.fetchSnapshot()
+	}
+}
+
+// fetchSnapshot fetches snapshots until one lines up with the buffered events
+func (s *depthSync) fetchSnapshot() {
+	delay := 100 * time.Millisecond
+	for {
+		snapshot, err := s.snapshotter.GetDepth(s.symbol, depthSnapshotLimit)
+		if err == nil {
+			s.mu.Lock()
+			if s.closed || s.synced {
+				s.fetching = false
+				s.mu.Unlock()
+				return
+			}
+			result := s.applySnapshot(snapshot)
+			if result != snapshotStale {
+				if result == snapshotWaiting {
+					s.snapshot = snapshot
+				}
+				s.fetching = false
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			log.Infof("Order book %s snapshot %d is older than the buffered events, refetching", s.symbol, snapshot.LastUpdateID)
+		} else {
+			log.Errorf("Failed to fetch order book snapshot of %s: %v", s.symbol, err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			s.fetching = false
+			s.mu.Unlock()
+			return
+		}
+		delay = min(delay*2, 10*time.Second)
+	}
+}
+
+// applySnapshot resets the book to snapshot and replays the buffered events on it,
+// must be called with s.mu held
+func (s *depthSync) applySnapshot(snapshot *DepthSnapshot) snapshotResult {
+	last := snapshot.LastUpdateID
+	start := -1
+	for i, u := range s.buffer {
+		if u.HasPrev {
+			if u.FinalUpdateID < last {
+				continue
+			}
+			if u.FirstUpdateID > last {
+				return snapshotStale
+			}
+		} else {
+			if u.FinalUpdateID <= last {
+				continue
+			}
+			if u.FirstUpdateID > last+1 {
+				return snapshotStale
+			}
+		}
+		start = i
+		break
+	}
+	if start < 0 {
+		s.buffer = s.buffer[:0]
+		return snapshotWaiting
+	}
+
+	bids, asks := snapshotLevels(snapshot.Bids), snapshotLevels(snapshot.Asks)
+	s.book.Reset(last, snapshot.EventTime, bids, asks)
+	if s.publishDelta != nil {
+		s.delta = base.OrderBookDelta{
+			Instrument:    InstrumentID(s.market, s.symbol),
+			Snapshot:      true,
+			FinalUpdateID: last,
+			Bids:          bids,
+			Asks:          asks,
+			ExchangeTime:  exchangeTime(snapshot.EventTime),
+			LocalTime:     time.Now(),
+		}
+		s.publishDelta(&s.delta)
+	}
+	s.apply(s.buffer[start])
+	for _, u := range s.buffer[start+1:] {
+		if !continuous(s.lastID, u) {
+			s.buffer = s.buffer[:0]
+			return snapshotStale
+		}
+		s.apply(u)
+	}
+	s.buffer = s.buffer[:0]
+	s.synced = true
+	log.Infof("Order book %s synced at snapshot %d, update %d", s.symbol, last, s.lastID)
+	return snapshotApplied
+}
+
+// apply applies u to the book and publishes it, must be called with s.mu held
+func (s *depthSync) apply(u *DepthUpdate) {
+	s.book.Update(u.FinalUpdateID, u.EventTime, u.Bids, u.Asks)
+	s.lastID = u.FinalUpdateID
+	if s.publishDelta != nil {
+		DepthUpdateToDelta(s.market, u, &s.delta)
+		s.publishDelta(&s.delta)
+	}
+	if s.publish != nil {
+		s.publish(s.book.Depth(depthPublishLevels))
+	}
+}
+
+func (s *depthSync) close() {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.synced = false
+	s.snapshot = nil
+	s.buffer = nil
+}
+
+// continuous reports whether u directly follows the update lastID
+func continuous(lastID int64, u *DepthUpdate) bool {
+	if u.HasPrev {
+		return u.PrevFinalUpdateID == lastID
+	}
+	return u.FirstUpdateID == lastID+1
+}
@@ -0,0 +1,53 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tradebot_go/tradebot/base"
+)
+
+// failingSnapshotter never returns a snapshot
+type failingSnapshotter struct {
+	calls atomic.Int32
+}
+
+func (f *failingSnapshotter) GetDepth(symbol string, limit int) (*DepthSnapshot, error) {
+	f.calls.Add(1)
+	return nil, errors.New("unavailable")
+}
+
+func TestDepthSyncCloseStopsSnapshotRetries(t *testing.T) {
+	snapshotter := &failingSnapshotter{}
+	depth := newDepthSync(context.Background(), "BTCUSDT", base.MarketTypeLinear, snapshotter,
+		func(view *base.OrderBookView) {}, func(delta *base.OrderBookDelta) {})
+	depth.handle(&DepthUpdate{Symbol: "BTCUSDT", FirstUpdateID: 1, FinalUpdateID: 2})
+
+	deadline := time.Now().Add(time.Second)
+	for snapshotter.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	depth.close()
+
+	// 关闭后重试循环退出，不再请求快照
+	deadline = time.Now().Add(time.Second)
+	for {
+		depth.mu.Lock()
+		fetching := depth.fetching
+		depth.mu.Unlock()
+		if !fetching {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot retries still running after close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	calls := snapshotter.calls.Load()
+	time.Sleep(300 * time.Millisecond)
+	if snapshotter.calls.Load() != calls {
+		t.Fatalf("fetched %d more snapshots after close", snapshotter.calls.Load()-calls)
+	}
+}
@@ -0,0 +1,360 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
+// U 本位合约下单接口，参数与返回值都与 base.Order 互相转换：
+//   - Amount 为下单数量，Price 为限价单价格
+//   - 返回的 Order.Id 为交易所订单号，Filled / Remaining / Average / CumCost 来自成交进度
+//   - 改单只支持限价单，可改价格与数量
+
+const (
+	futuresOrderEndpoint           = "/fapi/v1/order"
+	futuresAllOpenOrdersEndpoint   = "/fapi/v1/allOpenOrders"
+	futuresOpenOrdersEndpoint      = "/fapi/v1/openOrders"
+	futuresAllOrdersEndpoint       = "/fapi/v1/allOrders"
+	futuresOrderDefaultTimeInForce = base.TimeInForceGTC
+)
+
+// FuturesOrder is a USD-M futures order as returned by the order endpoints
+type FuturesOrder struct {
+	OrderID       int64           `json:"orderId"`
+	ClientOrderID string          `json:"clientOrderId"`
+	Symbol        string          `json:"symbol"`
+	Status        string          `json:"status"`
+	Type          string          `json:"type"`
+	Side          string          `json:"side"`
+	PositionSide  string          `json:"positionSide"`
+	TimeInForce   string          `json:"timeInForce"`
+	Price         decimal.Decimal `json:"price"`
+	AvgPrice      decimal.Decimal `json:"avgPrice"`
+	StopPrice     decimal.Decimal `json:"stopPrice"`
+	OrigQty       decimal.Decimal `json:"origQty"`
+	ExecutedQty   decimal.Decimal `json:"executedQty"`
+	CumQuote      decimal.Decimal `json:"cumQuote"`
+	ReduceOnly    bool            `json:"reduceOnly"`
+	ClosePosition bool            `json:"closePosition"`
+	// Time 下单时间 (查询接口才有)，UpdateTime 最后更新时间
+	Time       int64 `json:"time"`
+	UpdateTime int64 `json:"updateTime"`
+}
+
+// OrderIDParams identifies an order of a symbol by its exchange ID or client order ID,
+// OrderID takes precedence
+type OrderIDParams struct {
+	Symbol        string
+	OrderID       *int64
+	ClientOrderID string
+	RecvWindow    *int64
+}
+
+// AllOrdersParams represents the parameters for the all orders queries, OrderID
+// returns the orders from that ID on
+type AllOrdersParams struct {
+	Symbol     string
+	OrderID    *int64
+	StartTime  *int64
+	EndTime    *int64
+	Limit      *int
+	RecvWindow *int64
+}
+
+// binanceOrderStatuses maps Binance order statuses to base statuses
+var binanceOrderStatuses = map[string]base.OrderStatus{
+	"NEW":              base.OrderStatusAccepted,
+	"PARTIALLY_FILLED": base.OrderStatusPartiallyFilled,
+	"FILLED":           base.OrderStatusFilled,
+	"CANCELED":         base.OrderStatusCanceled,
+	"PENDING_CANCEL":   base.OrderStatusCanceling,
+	"EXPIRED":          base.OrderStatusExpired,
+	"EXPIRED_IN_MATCH": base.OrderStatusExpired,
+	"REJECTED":         base.OrderStatusFailed,
+}
+
+// Order converts o into a base.Order
+func (o *FuturesOrder) Order() base.Order {
+	status, ok := binanceOrderStatuses[o.Status]
+	if !ok {
+		status = base.OrderStatus(o.Status)
+	}
+	timestamp := o.UpdateTime
+	if timestamp == 0 {
+		timestamp = o.Time
+	}
+	return base.Order{
+		Exchange:      BinanceExchange,
+		Symbol:        o.Symbol,
+		Status:        status,
+		Id:            strconv.FormatInt(o.OrderID, 10),
+		ClientOrderId: o.ClientOrderID,
+		Timestamp:     timestamp,
+		Type:          base.OrderType(o.Type),
+		Side:          base.OrderSide(o.Side),
+		TimeInForce:   base.TimeInForce(o.TimeInForce),
+		Price:         o.Price,
+		Average:       o.AvgPrice,
+		Amount:        o.OrigQty,
+		Filled:        o.ExecutedQty,
+		Remaining:     o.OrigQty.Sub(o.ExecutedQty),
+		CumCost:       o.CumQuote,
+		ReduceOnly:    o.ReduceOnly,
+		PositionSide:  base.PositionSide(o.PositionSide),
+		Success:       status != base.OrderStatusFailed,
+	}
+}
+
+// NewFuturesOrder places order, Symbol, Side, Type and Amount are required and Price
+// for limit orders. The placed order is returned.
+func (c *BinanceClient) NewFuturesOrder(order *base.Order) (*base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	values, err := futuresOrderValues(order)
+	if err != nil {
+		return nil, err
+	}
+	values.Add("newOrderRespType", "RESULT")
+	return c.futuresOrder(http.MethodPost, values, "failed to place futures order")
+}
+
+// ModifyFuturesOrder changes the price and amount of the limit order order.Id (or
+// order.ClientOrderId), Symbol, Side, Amount and Price are required
+func (c *BinanceClient) ModifyFuturesOrder(order *base.Order) (*base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	if order.Symbol == "" || order.Side == "" || !order.Amount.IsPositive() || !order.Price.IsPositive() {
+		return nil, fmt.Errorf("failed to modify futures order: symbol, side, amount and price are required")
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(order.Symbol))
+	if err := addOrderID(values, order.Id, order.ClientOrderId); err != nil {
+		return nil, fmt.Errorf("failed to modify futures order: %w", err)
+	}
+	values.Add("side", string(order.Side))
+	values.Add("quantity", order.Amount.String())
+	values.Add("price", order.Price.String())
+	return c.futuresOrder(http.MethodPut, values, "failed to modify futures order")
+}
+
+// CancelFuturesOrder cancels an order and returns it
+func (c *BinanceClient) CancelFuturesOrder(params *OrderIDParams) (*base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	values, err := orderIDValues(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel futures order: %w", err)
+	}
+	return c.futuresOrder(http.MethodDelete, values, "failed to cancel futures order")
+}
+
+// CancelAllFuturesOrders cancels every open order of symbol
+func (c *BinanceClient) CancelAllFuturesOrders(symbol string) error {
+	if err := c.checkUsdMFutures(); err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(symbol))
+	_, err := c.fetch(FetchRequest{
+		Method:   http.MethodDelete,
+		Endpoint: futuresAllOpenOrdersEndpoint,
+		Payload:  &values,
+		Signed:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel all futures orders: %w", err)
+	}
+	return nil
+}
+
+// GetFuturesOrder queries an order
+func (c *BinanceClient) GetFuturesOrder(params *OrderIDParams) (*base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	values, err := orderIDValues(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get futures order: %w", err)
+	}
+	return c.futuresOrder(http.MethodGet, values, "failed to get futures order")
+}
+
+// GetFuturesOpenOrders retrieves the open orders of symbol, or of every symbol if
+// symbol is empty
+func (c *BinanceClient) GetFuturesOpenOrders(symbol string) ([]base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	if symbol != "" {
+		values.Add("symbol", strings.ToUpper(symbol))
+	}
+	return c.futuresOrders(futuresOpenOrdersEndpoint, values, "failed to get futures open orders")
+}
+
+// GetFuturesAllOrders retrieves the open, filled and canceled orders of a symbol
+func (c *BinanceClient) GetFuturesAllOrders(params *AllOrdersParams) ([]base.Order, error) {
+	if err := c.checkUsdMFutures(); err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	if params.OrderID != nil {
+		values.Add("orderId", strconv.FormatInt(*params.OrderID, 10))
+	}
+	if params.StartTime != nil {
+		values.Add("startTime", strconv.FormatInt(*params.StartTime, 10))
+	}
+	if params.EndTime != nil {
+		values.Add("endTime", strconv.FormatInt(*params.EndTime, 10))
+	}
+	if params.Limit != nil {
+		values.Add("limit", strconv.Itoa(*params.Limit))
+	}
+	if params.RecvWindow != nil {
+		values.Add("recvWindow", strconv.FormatInt(*params.RecvWindow, 10))
+	}
+	return c.futuresOrders(futuresAllOrdersEndpoint, values, "failed to get futures orders")
+}
+
+func (c *BinanceClient) checkUsdMFutures() error {
+	switch c.AccountType {
+	case BinanceAccountTypeUsdMFutures, BinanceAccountTypeUsdMFuturesTestnet:
+		return nil
+	}
+	return fmt.Errorf("futures orders are not supported for account type %s", c.AccountType)
+}
+
+// futuresOrder sends a signed request to the order endpoint and converts the order it returns
+func (c *BinanceClient) futuresOrder(method string, values url.Values, errMsg string) (*base.Order, error) {
+	resp, err := c.fetch(FetchRequest{
+		Method:   method,
+		Endpoint: futuresOrderEndpoint,
+		Payload:  &values,
+		Signed:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	var result FuturesOrder
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	order := result.Order()
+	return &order, nil
+}
+
+// futuresOrders sends a signed GET to an order list endpoint and converts the orders
+func (c *BinanceClient) futuresOrders(endpoint string, values url.Values, errMsg string) ([]base.Order, error) {
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: endpoint,
+		Payload:  &values,
+		Signed:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	var results []FuturesOrder
+	if err := json.Unmarshal(resp, &results); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	orders := make([]base.Order, len(results))
+	for i := range results {
+		orders[i] = results[i].Order()
+	}
+	return orders, nil
+}
+
+// futuresOrderValues builds the new order parameters of order
+func futuresOrderValues(order *base.Order) (url.Values, error) {
+	if order.Symbol == "" || order.Side == "" || order.Type == "" {
+		return nil, fmt.Errorf("invalid futures order: symbol, side and type are required")
+	}
+	if !order.Amount.IsPositive() {
+		return nil, fmt.Errorf("invalid futures order: amount %s must be positive", order.Amount)
+	}
+
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(order.Symbol))
+	values.Add("side", string(order.Side))
+	values.Add("type", string(order.Type))
+	values.Add("quantity", order.Amount.String())
+	switch order.Type {
+	case base.OrderTypeLimit:
+		if !order.Price.IsPositive() {
+			return nil, fmt.Errorf("invalid futures order: limit price %s must be positive", order.Price)
+		}
+		values.Add("price", order.Price.String())
+		timeInForce := order.TimeInForce
+		if timeInForce == "" {
+			timeInForce = futuresOrderDefaultTimeInForce
+		}
+		values.Add("timeInForce", string(timeInForce))
+	case base.OrderTypeMarket:
+	default:
+		return nil, fmt.Errorf("invalid futures order: unsupported type %s", order.Type)
+	}
+
+	// 双向持仓模式下 positionSide 为 LONG / SHORT，且不接受 reduceOnly
+	switch order.PositionSide {
+	case "", base.PositionSideBoth:
+		if order.ReduceOnly {
+			values.Add("reduceOnly", "true")
+		}
+	case base.PositionSideLong, base.PositionSideShort:
+		if order.ReduceOnly {
+			return nil, fmt.Errorf("invalid futures order: reduceOnly can't be set in hedge mode")
+		}
+		values.Add("positionSide", string(order.PositionSide))
+	default:
+		return nil, fmt.Errorf("invalid futures order: unsupported position side %s", order.PositionSide)
+	}
+	if order.ClientOrderId != "" {
+		values.Add("newClientOrderId", order.ClientOrderId)
+	}
+	return values, nil
+}
+
+// orderIDValues builds the symbol and order ID parameters of params
+func orderIDValues(params *OrderIDParams) (url.Values, error) {
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	id := ""
+	if params.OrderID != nil {
+		id = strconv.FormatInt(*params.OrderID, 10)
+	}
+	if err := addOrderID(values, id, params.ClientOrderID); err != nil {
+		return nil, err
+	}
+	if params.RecvWindow != nil {
+		values.Add("recvWindow", strconv.FormatInt(*params.RecvWindow, 10))
+	}
+	return values, nil
+}
+
+// addOrderID adds the exchange order ID, or the client order ID if id is empty
+func addOrderID(values url.Values, id string, clientOrderID string) error {
+	switch {
+	case id != "":
+		values.Add("orderId", id)
+	case clientOrderID != "":
+		values.Add("origClientOrderId", clientOrderID)
+	default:
+		return fmt.Errorf("order ID or client order ID is required")
+	}
+	return nil
+}
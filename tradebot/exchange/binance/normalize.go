@@ -0,0 +1,211 @@
+package binance
+
+import (
+	"strconv"
+	"time"
+	"tradebot_go/tradebot/base"
+)
+
+// Binance 消息到 base 行情类型的转换，connector 发布前调用。
+// 交易所时间为 0 (现货 bookTicker 等没有时间字段) 时 ExchangeTime 为零值。
+
+// InstrumentID returns the instrument ID of a Binance symbol on market
+func InstrumentID(market base.MarketType, symbol string) base.InstrumentID {
+	return base.InstrumentID{Exchange: BinanceExchange, Symbol: symbol, Market: market}
+}
+
+// aggressorSide is the taker side of a trade, the buyer being the maker means the seller took
+func aggressorSide(buyerMaker bool) base.OrderSide {
+	if buyerMaker {
+		return base.OrderSideSell
+	}
+	return base.OrderSideBuy
+}
+
+func exchangeTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// ToTradeTick converts trade into tick
+func ToTradeTick(market base.MarketType, trade *Trade, tick *base.TradeTick) {
+	*tick = base.TradeTick{
+		Instrument:    InstrumentID(market, trade.Symbol),
+		TradeID:       strconv.FormatInt(trade.TradeID, 10),
+		Price:         trade.Price,
+		Quantity:      trade.Quantity,
+		AggressorSide: aggressorSide(trade.IsMaker),
+		ExchangeTime:  exchangeTime(trade.TradeTime),
+		LocalTime:     trade.ReceivedAt,
+	}
+}
+
+// AggTradeToTradeTick converts an aggregate trade into tick, the trade ID is the
+// aggregate trade ID
+func AggTradeToTradeTick(market base.MarketType, trade *AggTrade, tick *base.TradeTick) {
+	*tick = base.TradeTick{
+		Instrument:    InstrumentID(market, trade.Symbol),
+		TradeID:       strconv.FormatInt(trade.AggTradeID, 10),
+		Price:         trade.Price,
+		Quantity:      trade.Quantity,
+		AggressorSide: aggressorSide(trade.IsMaker),
+		ExchangeTime:  exchangeTime(trade.TradeTime),
+		LocalTime:     trade.ReceivedAt,
+	}
+}
+
+// ToQuoteTick converts bookTicker into quote
+func ToQuoteTick(market base.MarketType, bookTicker *BookTicker, receivedAt time.Time, quote *base.QuoteTick) {
+	// 期货优先使用撮合时间
+	ms := bookTicker.TransactionTime
+	if ms == 0 {
+		ms = bookTicker.EventTime
+	}
+	*quote = base.QuoteTick{
+		Instrument:   InstrumentID(market, bookTicker.Symbol),
+		BidPrice:     bookTicker.BidPrice,
+		BidSize:      bookTicker.BidQty,
+		AskPrice:     bookTicker.AskPrice,
+		AskSize:      bookTicker.AskQty,
+		UpdateID:     bookTicker.UpdateID,
+		ExchangeTime: exchangeTime(ms),
+		LocalTime:    receivedAt,
+	}
+}
+
+// BookDepthToDelta converts a partial book depth into a snapshot delta, the levels
+// are shared with depth
+func BookDepthToDelta(market base.MarketType, depth *BookDepth, receivedAt time.Time, delta *base.OrderBookDelta) {
+	ms := depth.TransactionTime
+	if ms == 0 {
+		ms = depth.EventTime
+	}
+	*delta = base.OrderBookDelta{
+		Instrument:    InstrumentID(market, depth.Symbol),
+		Snapshot:      true,
+		FirstUpdateID: depth.FirstUpdateID,
+		FinalUpdateID: depth.LastUpdateID,
+		Bids:          depth.Bids,
+		Asks:          depth.Asks,
+		ExchangeTime:  exchangeTime(ms),
+		LocalTime:     receivedAt,
+	}
+}
+
+// DepthUpdateToDelta converts a diff depth event into a delta, the levels are shared with u
+func DepthUpdateToDelta(market base.MarketType, u *DepthUpdate, delta *base.OrderBookDelta) {
+	ms := u.TransactionTime
+	if ms == 0 {
+		ms = u.EventTime
+	}
+	*delta = base.OrderBookDelta{
+		Instrument:    InstrumentID(market, u.Symbol),
+		FirstUpdateID: u.FirstUpdateID,
+		FinalUpdateID: u.FinalUpdateID,
+		Bids:          u.Bids,
+		Asks:          u.Asks,
+		ExchangeTime:  exchangeTime(ms),
+		LocalTime:     u.ReceivedAt,
+	}
+}
+
+// ToMarkPriceUpdate converts markPrice into update
+func ToMarkPriceUpdate(market base.MarketType, markPrice *MarkPrice, receivedAt time.Time, update *base.MarkPriceUpdate) {
+	*update = base.MarkPriceUpdate{
+		Instrument:           InstrumentID(market, markPrice.Symbol),
+		MarkPrice:            markPrice.MarkPrice,
+		IndexPrice:           markPrice.IndexPrice,
+		EstimatedSettlePrice: markPrice.EstimatedSettlePrice,
+		FundingRate:          markPrice.FundingRate,
+		NextFundingTime:      exchangeTime(markPrice.NextFundingTime),
+		ExchangeTime:         exchangeTime(markPrice.EventTime),
+		LocalTime:            receivedAt,
+	}
+}
+
+// ToLiquidation converts a liquidation order message into l
+func ToLiquidation(market base.MarketType, liquidation *Liquidation, receivedAt time.Time, l *base.Liquidation) {
+	*l = base.Liquidation{
+		Instrument:     InstrumentID(market, liquidation.Symbol),
+		Side:           base.OrderSide(liquidation.Side),
+		OrderType:      base.OrderType(liquidation.OrderType),
+		TimeInForce:    base.TimeInForce(liquidation.TimeInForce),
+		Status:         base.OrderStatus(liquidation.Status),
+		Price:          liquidation.Price,
+		AveragePrice:   liquidation.AveragePrice,
+		Quantity:       liquidation.Quantity,
+		LastFilledQty:  liquidation.LastFilledQty,
+		FilledQuantity: liquidation.FilledQty,
+		ExchangeTime:   exchangeTime(liquidation.TradeTime),
+		LocalTime:      receivedAt,
+	}
+}
+
+// ToTickerBatch appends the tickers of batch to out
+func ToTickerBatch(market base.MarketType, batch *TickerBatch, receivedAt time.Time, out *base.TickerBatch) {
+	for i := range batch.Tickers {
+		t := &batch.Tickers[i]
+		out.Tickers = append(out.Tickers, base.Ticker{
+			Instrument:         InstrumentID(market, t.Symbol),
+			LastPrice:          t.LastPrice,
+			LastQuantity:       t.LastQty,
+			PriceChange:        t.PriceChange,
+			PriceChangePercent: t.PriceChangePercent,
+			WeightedAvgPrice:   t.WeightedAvgPrice,
+			BidPrice:           t.BidPrice,
+			BidSize:            t.BidQty,
+			AskPrice:           t.AskPrice,
+			AskSize:            t.AskQty,
+			Open:               t.OpenPrice,
+			High:               t.HighPrice,
+			Low:                t.LowPrice,
+			Volume:             t.Volume,
+			QuoteVolume:        t.QuoteVolume,
+			Trades:             t.Trades,
+			OpenTime:           exchangeTime(t.OpenTime),
+			CloseTime:          exchangeTime(t.CloseTime),
+			ExchangeTime:       exchangeTime(t.EventTime),
+			LocalTime:          receivedAt,
+		})
+	}
+}
+
+// MiniTickersToTickerBatch appends the mini tickers of batch to out
+func MiniTickersToTickerBatch(market base.MarketType, batch *MiniTickerBatch, receivedAt time.Time, out *base.TickerBatch) {
+	for i := range batch.Tickers {
+		t := &batch.Tickers[i]
+		out.Tickers = append(out.Tickers, base.Ticker{
+			Instrument:   InstrumentID(market, t.Symbol),
+			LastPrice:    t.ClosePrice,
+			Open:         t.OpenPrice,
+			High:         t.HighPrice,
+			Low:          t.LowPrice,
+			Volume:       t.Volume,
+			QuoteVolume:  t.QuoteVolume,
+			ExchangeTime: exchangeTime(t.EventTime),
+			LocalTime:    receivedAt,
+		})
+	}
+}
+
+// KlineToBar converts an exchange kline into a time bar, the bar interval is the
+// kline period (月线按当月天数)
+func KlineToBar(market base.MarketType, kline *Kline, bar *base.Bar) {
+	*bar = base.Bar{
+		Instrument: InstrumentID(market, kline.Symbol),
+		Spec:       base.TimeBars(time.Duration(kline.CloseTime+1-kline.StartTime) * time.Millisecond),
+		OpenTime:   kline.StartTime,
+		// 交易所的收盘时间是周期最后一毫秒，bar 的 CloseTime 不含终点
+		CloseTime:   kline.CloseTime + 1,
+		Open:        kline.Open,
+		High:        kline.High,
+		Low:         kline.Low,
+		Close:       kline.Close,
+		Volume:      kline.Volume,
+		QuoteVolume: kline.QuoteVolume,
+		Trades:      kline.Trades,
+		Partial:     !kline.IsClosed,
+	}
+}
@@ -0,0 +1,309 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tradebot_go/tradebot/base"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// 限速响应头，服务端按 IP 统计权重、按账户统计下单数，/sapi 接口的 IP 权重单独统计
+const (
+	headerUsedWeight     = "X-MBX-USED-WEIGHT-1M"
+	headerSapiUsedWeight = "X-SAPI-USED-IP-WEIGHT-1M"
+	headerOrderCount10s  = "X-MBX-ORDER-COUNT-10S"
+	headerOrderCount1m   = "X-MBX-ORDER-COUNT-1M"
+	headerOrderCount1d   = "X-MBX-ORDER-COUNT-1D"
+)
+
+// binanceEndpointWeights is the request weight of "METHOD path", endpoints missing here weigh 1.
+// depth 和不带 symbol 的 openOrders 的权重取决于参数，见 requestWeight
+var binanceEndpointWeights = map[string]int{
+	"GET /api/v3/trades":               25,
+	"GET /api/v3/historicalTrades":     25,
+	"GET /api/v3/aggTrades":            4,
+	"GET /api/v3/order":                4,
+	"GET /api/v3/openOrders":           6,
+	"GET /api/v3/allOrders":            20,
+	"GET /api/v3/myTrades":             20,
+	"GET /api/v3/orderList":            4,
+	"GET /fapi/v1/trades":              5,
+	"GET /fapi/v1/historicalTrades":    20,
+	"GET /fapi/v1/aggTrades":           20,
+	"GET /fapi/v1/allOrders":           5,
+	"GET /fapi/v1/userTrades":          5,
+	"GET /dapi/v1/historicalTrades":    20,
+	"GET /dapi/v1/aggTrades":           20,
+	"GET /dapi/v1/allOrders":           20,
+	"GET /dapi/v1/userTrades":          20,
+	"POST /sapi/v1/margin/order":       6,
+	"GET /sapi/v1/margin/order":        10,
+	"DELETE /sapi/v1/margin/order":     10,
+	"GET /sapi/v1/margin/openOrders":   10,
+	"GET /sapi/v1/margin/allOrders":    200,
+	"GET /sapi/v1/margin/myTrades":     10,
+	"POST /sapi/v1/margin/order/oco":   6,
+	"DELETE /sapi/v1/margin/orderList": 1,
+}
+
+// binanceOrderCounts is the number of orders "METHOD path" places, an OCO places two
+var binanceOrderCounts = map[string]int{
+	"POST /api/v3/order":             1,
+	"POST /api/v3/orderList/oco":     2,
+	"POST /api/v3/orderList/otoco":   3,
+	"POST /fapi/v1/order":            1,
+	"PUT /fapi/v1/order":             1,
+	"POST /dapi/v1/order":            1,
+	"PUT /dapi/v1/order":             1,
+	"POST /sapi/v1/margin/order":     1,
+	"POST /sapi/v1/margin/order/oco": 2,
+}
+
+type rateLimit struct {
+	header string
+	limit  int
+	window time.Duration
+}
+
+type rateLimits struct {
+	weights []rateLimit
+	orders  []rateLimit
+}
+
+var (
+	spotRateLimits = rateLimits{
+		weights: []rateLimit{{headerUsedWeight, 6000, time.Minute}, {headerSapiUsedWeight, 12000, time.Minute}},
+		orders:  []rateLimit{{headerOrderCount10s, 100, 10 * time.Second}, {headerOrderCount1d, 200000, 24 * time.Hour}},
+	}
+	usdMFuturesRateLimits = rateLimits{
+		weights: []rateLimit{{headerUsedWeight, 2400, time.Minute}},
+		orders:  []rateLimit{{headerOrderCount10s, 300, 10 * time.Second}, {headerOrderCount1m, 1200, time.Minute}},
+	}
+	coinMFuturesRateLimits = rateLimits{
+		weights: []rateLimit{{headerUsedWeight, 2400, time.Minute}},
+		orders:  []rateLimit{{headerOrderCount1m, 1200, time.Minute}},
+	}
+)
+
+// DefaultRateLimitMaxWait is the MaxWait of the shared rate limit managers NewBinanceClient installs
+const DefaultRateLimitMaxWait = 10 * time.Second
+
+// binanceRateLimits maps market types to their default request weight and order limits
+var binanceRateLimits = map[base.MarketType]rateLimits{
+	base.MarketTypeSpot:    spotRateLimits,
+	base.MarketTypeMargin:  spotRateLimits,
+	base.MarketTypeLinear:  usdMFuturesRateLimits,
+	base.MarketTypeInverse: coinMFuturesRateLimits,
+}
+
+// RateLimitManager throttles the REST requests of one account type before Binance does:
+//   - 每个请求按接口权重和下单数扣减本地窗口计数，超限时等待到窗口重置，等待超过 MaxWait 直接拒绝
+//   - 每个响应的 X-MBX-USED-WEIGHT-* / X-MBX-ORDER-COUNT-* 头同步服务端的实际用量
+//   - 429 / 418 触发全局冷却，冷却时长取 Retry-After，期间所有请求等待或被拒绝
+type RateLimitManager struct {
+	// MaxWait 请求最多等待的时长，为 0 时超限立即拒绝
+	MaxWait time.Duration
+
+	mu            sync.Mutex
+	weights       map[string]*base.WindowBucket // 按响应头
+	orders        map[string]*base.WindowBucket // 按响应头
+	cooldownUntil time.Time
+}
+
+// NewRateLimitManager creates a manager with the limits of the market of accountType
+func NewRateLimitManager(accountType BinanceAccountType, maxWait time.Duration) *RateLimitManager {
+	limits := binanceRateLimits[BinanceMarketTypes[accountType]]
+	m := &RateLimitManager{
+		MaxWait: maxWait,
+		weights: make(map[string]*base.WindowBucket, len(limits.weights)),
+		orders:  make(map[string]*base.WindowBucket, len(limits.orders)),
+	}
+	for _, l := range limits.weights {
+		m.weights[l.header] = base.NewWindowBucket(l.limit, l.window)
+	}
+	for _, l := range limits.orders {
+		m.orders[l.header] = base.NewWindowBucket(l.limit, l.window)
+	}
+	return m
+}
+
+// sharedRateLimitManagers holds one manager per REST host, Binance 按 IP 统计权重，同一主机的客户端共用一个窗口
+var (
+	sharedRateLimitMu       sync.Mutex
+	sharedRateLimitManagers = make(map[string]*RateLimitManager)
+)
+
+// SharedRateLimitManager returns the manager every client of the REST host of accountType
+// shares, spot 和 margin 共用 api.binance.com 的窗口，测试网与主网分开统计
+func SharedRateLimitManager(accountType BinanceAccountType) *RateLimitManager {
+	host := BinanceHttpURLs[accountType]
+	sharedRateLimitMu.Lock()
+	defer sharedRateLimitMu.Unlock()
+	m, ok := sharedRateLimitManagers[host]
+	if !ok {
+		m = NewRateLimitManager(accountType, DefaultRateLimitMaxWait)
+		sharedRateLimitManagers[host] = m
+	}
+	return m
+}
+
+// Acquire blocks until req fits into every limit and counts it
+func (m *RateLimitManager) Acquire(req *http.Request) error {
+	header, weight := requestWeight(req)
+	orders := binanceOrderCounts[req.Method+" "+req.URL.Path]
+	for {
+		m.mu.Lock()
+		now := time.Now()
+		wait, reason := m.cooldownUntil.Sub(now), "cool-down"
+		if wait <= 0 {
+			wait, reason = m.wait(header, weight, orders, now)
+		}
+		if wait <= 0 {
+			if bucket, ok := m.weights[header]; ok {
+				bucket.Take(weight, now)
+			}
+			for _, bucket := range m.orders {
+				bucket.Take(orders, now)
+			}
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+
+		if wait > m.MaxWait {
+			return fmt.Errorf("%w: %s %s would wait %s for %s", base.ErrRateLimited, req.Method, req.URL.Path, wait, reason)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// wait returns the longest wait of the buckets req counts against, m.mu is held
+func (m *RateLimitManager) wait(header string, weight int, orders int, now time.Time) (time.Duration, string) {
+	var wait time.Duration
+	reason := ""
+	if bucket, ok := m.weights[header]; ok {
+		if w := bucket.Wait(weight, now); w > wait {
+			wait, reason = w, header
+		}
+	}
+	if orders > 0 {
+		for h, bucket := range m.orders {
+			if w := bucket.Wait(orders, now); w > wait {
+				wait, reason = w, h
+			}
+		}
+	}
+	return wait, reason
+}
+
+// Observe syncs the buckets with the usage headers of resp and starts a cool-down on 429 / 418
+func (m *RateLimitManager) Observe(req *http.Request, resp *http.Response) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	syncBuckets(m.weights, resp.Header, now)
+	syncBuckets(m.orders, resp.Header, now)
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusTeapot {
+		return
+	}
+	until := now.Add(retryAfter(resp))
+	if until.After(m.cooldownUntil) {
+		m.cooldownUntil = until
+	}
+	log.Warnf("binance %s %s returned %d, cooling down until %s", req.Method, req.URL.Path, resp.StatusCode, m.cooldownUntil.Format(time.RFC3339))
+}
+
+// CooldownUntil returns the end of the current cool-down, zero if there was none
+func (m *RateLimitManager) CooldownUntil() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cooldownUntil
+}
+
+// UsedWeight returns the request weight used in the current minute, /sapi 接口除外
+func (m *RateLimitManager) UsedWeight() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bucket, ok := m.weights[headerUsedWeight]; ok {
+		return bucket.Used(time.Now())
+	}
+	return 0
+}
+
+func syncBuckets(buckets map[string]*base.WindowBucket, header http.Header, now time.Time) {
+	for h, bucket := range buckets {
+		if used, err := strconv.Atoi(header.Get(h)); err == nil {
+			bucket.Sync(used, now)
+		}
+	}
+}
+
+// retryAfter returns the Retry-After of resp in seconds, 429 默认等到下一分钟窗口，418 封禁至少 2 分钟
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode == http.StatusTeapot {
+		return 2 * time.Minute
+	}
+	return time.Minute
+}
+
+// requestWeight returns the weight header req counts against and its weight
+func requestWeight(req *http.Request) (string, int) {
+	header := headerUsedWeight
+	if strings.HasPrefix(req.URL.Path, "/sapi/") {
+		header = headerSapiUsedWeight
+	}
+
+	query := req.URL.Query()
+	switch req.URL.Path {
+	case "/api/v3/depth":
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		switch {
+		case limit <= 100:
+			return header, 5
+		case limit <= 500:
+			return header, 25
+		case limit <= 1000:
+			return header, 50
+		default:
+			return header, 250
+		}
+	case "/fapi/v1/depth", "/dapi/v1/depth":
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		switch {
+		case limit <= 50:
+			return header, 2
+		case limit <= 100:
+			return header, 5
+		case limit <= 500:
+			return header, 10
+		default:
+			return header, 20
+		}
+	case "/api/v3/openOrders", "/fapi/v1/openOrders", "/dapi/v1/openOrders", "/sapi/v1/margin/openOrders":
+		// 不带 symbol 查询全部交易对
+		if req.Method == http.MethodGet && query.Get("symbol") == "" {
+			switch req.URL.Path {
+			case "/api/v3/openOrders":
+				return header, 80
+			case "/fapi/v1/openOrders", "/dapi/v1/openOrders":
+				return header, 40
+			}
+		}
+	}
+
+	if weight, ok := binanceEndpointWeights[req.Method+" "+req.URL.Path]; ok {
+		return header, weight
+	}
+	return header, 1
+}
@@ -0,0 +1,94 @@
+package binance
+
+import (
+	"sync"
+	"time"
+)
+
+// LegStats describes how one leg of a redundant feed performs against the others
+type LegStats struct {
+	Leg int
+	// Wins 由该连接最先送达的事件数
+	Wins int64
+	// Duplicates 该连接送达时已被其它连接抢先的事件数
+	Duplicates int64
+	// MeanLead/MaxLead 该连接领先时，比其它连接的同一事件早到多久
+	MeanLead time.Duration
+	MaxLead  time.Duration
+}
+
+type legCounters struct {
+	wins       int64
+	duplicates int64
+	leads      int64
+	leadSum    time.Duration
+	leadMax    time.Duration
+}
+
+// FeedArbiter merges the legs of a redundant feed: the earliest copy of every event
+// is delivered, later copies from the other legs are dropped. As long as one leg is
+// alive the merged feed has no gap.
+type FeedArbiter struct {
+	dedup *Deduper
+
+	mu   sync.Mutex
+	legs []legCounters
+}
+
+func NewFeedArbiter(legs int) *FeedArbiter {
+	return &FeedArbiter{
+		dedup: NewDeduper(),
+		legs:  make([]legCounters, legs),
+	}
+}
+
+// Accept reports whether the message of stream received on leg at receivedAt is the
+// first copy and should be delivered. stream is the subscribed stream name the message
+// was routed to, empty for unrouted messages, as in Deduper.Duplicate.
+func (a *FeedArbiter) Accept(leg int, stream string, data []byte, event string, receivedAt time.Time) bool {
+	meta := peekFrame(data, event)
+	if !meta.hasID {
+		return true
+	}
+
+	var buf [64]byte
+	first, dup := a.dedup.arrive(meta.key(buf[:0], stream), meta.id, leg, receivedAt)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !dup {
+		a.legs[leg].wins++
+		return true
+	}
+
+	a.legs[leg].duplicates++
+	if first.leg != leg {
+		lead := receivedAt.Sub(first.at)
+		winner := &a.legs[first.leg]
+		winner.leads++
+		winner.leadSum += lead
+		winner.leadMax = max(winner.leadMax, lead)
+	}
+	return false
+}
+
+// Stats returns per-leg win counts and latency leads
+func (a *FeedArbiter) Stats() []LegStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := make([]LegStats, len(a.legs))
+	for i, leg := range a.legs {
+		stats[i] = LegStats{
+			Leg:        i,
+			Wins:       leg.wins,
+			Duplicates: leg.duplicates,
+			MaxLead:    leg.leadMax,
+		}
+		if leg.leads > 0 {
+			stats[i].MeanLead = leg.leadSum / time.Duration(leg.leads)
+		}
+	}
+	return stats
+}
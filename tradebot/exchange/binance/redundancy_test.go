@@ -0,0 +1,27 @@
+package binance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedArbiterKeysOnStream(t *testing.T) {
+	arbiter := NewFeedArbiter(2)
+	now := time.Now()
+
+	// depth5 与增量深度的事件类型、symbol 与 u 都相同，只有 stream 不同
+	frame := []byte(`{"e":"depthUpdate","E":1700000000000,"s":"BTCUSDT","U":10,"u":12,"pu":9,"b":[],"a":[]}`)
+	const partial, diff = "btcusdt@depth5@100ms", "btcusdt@depth@100ms"
+
+	if !arbiter.Accept(0, partial, frame, "", now) || !arbiter.Accept(0, diff, frame, "", now) {
+		t.Fatal("events of different streams dropped as duplicates")
+	}
+	if arbiter.Accept(1, partial, frame, "", now.Add(time.Millisecond)) || arbiter.Accept(1, diff, frame, "", now.Add(time.Millisecond)) {
+		t.Fatal("copies from the second leg delivered")
+	}
+
+	stats := arbiter.Stats()
+	if stats[0].Wins != 2 || stats[1].Duplicates != 2 || stats[0].MaxLead != time.Millisecond {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -6,30 +6,34 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
 )
 
 // Trade represents a single trade from the account trade list
 type BinanceTrade struct {
-	Buyer           bool   `json:"buyer"`
-	Commission      string `json:"commission"`
-	CommissionAsset string `json:"commissionAsset"`
-	ID              int64  `json:"id"`
-	Maker           bool   `json:"maker"`
-	OrderID         int64  `json:"orderId"`
-	Price           string `json:"price"`
-	Qty             string `json:"qty"`
-	QuoteQty        string `json:"quoteQty"`
-	RealizedPnl     string `json:"realizedPnl"`
-	Side            string `json:"side"`
-	PositionSide    string `json:"positionSide"`
-	Symbol          string `json:"symbol"`
-	Time            int64  `json:"time"`
+	Buyer           bool            `json:"buyer"`
+	Commission      decimal.Decimal `json:"commission"`
+	CommissionAsset string          `json:"commissionAsset"`
+	ID              int64           `json:"id"`
+	Maker           bool            `json:"maker"`
+	OrderID         int64           `json:"orderId"`
+	Price           decimal.Decimal `json:"price"`
+	Qty             decimal.Decimal `json:"qty"`
+	QuoteQty        decimal.Decimal `json:"quoteQty"`
+	RealizedPnl     decimal.Decimal `json:"realizedPnl"`
+	Side            string          `json:"side"`
+	PositionSide    string          `json:"positionSide"`
+	Symbol          string          `json:"symbol"`
+	Time            int64           `json:"time"`
 }
 
 // TradeListParams represents the parameters for GetTradeList
@@ -43,17 +47,367 @@ type TradeListParams struct {
 	RecvWindow *int64
 }
 
+// HistoricalTrade is a public trade from the historical trades endpoint
+type HistoricalTrade struct {
+	ID           int64           `json:"id"`
+	Price        decimal.Decimal `json:"price"`
+	Qty          decimal.Decimal `json:"qty"`
+	QuoteQty     decimal.Decimal `json:"quoteQty"`
+	Time         int64           `json:"time"`
+	IsBuyerMaker bool            `json:"isBuyerMaker"`
+	IsBestMatch  bool            `json:"isBestMatch"`
+}
+
+// AggTradesParams represents the parameters for GetAggTrades, FromID takes
+// precedence over the time window
+type AggTradesParams struct {
+	Symbol    string
+	FromID    *int64
+	StartTime *int64
+	EndTime   *int64
+	Limit     *int
+}
+
+// PremiumIndex is the mark price and funding rate of a futures symbol
+type PremiumIndex struct {
+	Symbol               string          `json:"symbol"`
+	MarkPrice            decimal.Decimal `json:"markPrice"`
+	IndexPrice           decimal.Decimal `json:"indexPrice"`
+	EstimatedSettlePrice decimal.Decimal `json:"estimatedSettlePrice"`
+	LastFundingRate      decimal.Decimal `json:"lastFundingRate"`
+	InterestRate         decimal.Decimal `json:"interestRate"`
+	NextFundingTime      int64           `json:"nextFundingTime"`
+	Time                 int64           `json:"time"`
+}
+
+// FundingRate is one settled funding rate
+type FundingRate struct {
+	Symbol      string          `json:"symbol"`
+	FundingRate decimal.Decimal `json:"fundingRate"`
+	FundingTime int64           `json:"fundingTime"`
+	// MarkPrice 早期记录为空字符串，解码为 0
+	MarkPrice decimal.Decimal `json:"markPrice"`
+}
+
+func (r *FundingRate) UnmarshalJSON(data []byte) error {
+	type fundingRate FundingRate
+	var raw struct {
+		fundingRate
+		MarkPrice string `json:"markPrice"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = FundingRate(raw.fundingRate)
+	if raw.MarkPrice == "" {
+		return nil
+	}
+	markPrice, err := decimal.NewFromString(raw.MarkPrice)
+	if err != nil {
+		return fmt.Errorf("invalid funding rate mark price %q: %w", raw.MarkPrice, err)
+	}
+	r.MarkPrice = markPrice
+	return nil
+}
+
+// FundingRateParams represents the parameters for GetFundingRateHistory
+type FundingRateParams struct {
+	Symbol    string
+	StartTime *int64
+	EndTime   *int64
+	Limit     *int
+}
+
 type BinanceClient struct {
 	*base.Client
-	ExID string
+	ExID        string
+	AccountType BinanceAccountType
+	// RecvWindow 签名请求未指定 recvWindow 时使用，0 表示使用交易所默认值
+	RecvWindow time.Duration
+	// TimeSync 非空时签名请求的 timestamp 使用估计的服务器时间
+	TimeSync *TimeSync
 }
 
 func NewBinanceClient(config *base.Config, accountType BinanceAccountType) *BinanceClient {
+	return NewBinanceClientWithDriftHandler(config, accountType, nil)
+}
+
+// NewBinanceClientWithDriftHandler creates a client whose time sync calls onDrift when
+// the local clock is off by more than config.REST.MaxClockDrift. Close the client to
+// stop the time sync.
+func NewBinanceClientWithDriftHandler(config *base.Config, accountType BinanceAccountType, onDrift DriftHandler) *BinanceClient {
 	baseURL := BinanceHttpURLs[accountType]
-	baseClient := base.NewClient(config.BinanceFutureTestnet.APIKey, config.BinanceFutureTestnet.SecretKey, baseURL)
+	credentials := BinanceCredentials(config, accountType)
+	baseClient := base.NewClient(credentials.APIKey, credentials.SecretKey, baseURL)
+	baseClient.Limiter = SharedRateLimitManager(accountType)
+	client := &BinanceClient{
+		Client:      baseClient,
+		ExID:        "binance",
+		AccountType: accountType,
+		RecvWindow:  config.REST.RecvWindow,
+	}
+	if config.REST.TimeSyncInterval > 0 {
+		client.TimeSync = NewTimeSync(client, config.REST.TimeSyncInterval, config.REST.MaxClockDrift, onDrift)
+		client.TimeSync.Start()
+	}
+	return client
+}
+
+// BinanceCredentials returns the API key config.Binance holds for accountType, the U 本位
+// 合约测试网没有单独配置时使用 config.BinanceFutureTestnet
+func BinanceCredentials(config *base.Config, accountType BinanceAccountType) base.ExchangeConfig {
+	for name, credentials := range config.Binance {
+		if strings.EqualFold(name, string(accountType)) {
+			return credentials
+		}
+	}
+	if accountType == BinanceAccountTypeUsdMFuturesTestnet {
+		return config.BinanceFutureTestnet
+	}
+	return base.ExchangeConfig{}
+}
+
+// Close stops the time sync of the client, the client can still send requests with
+// the last estimated offset
+func (c *BinanceClient) Close() error {
+	if c.TimeSync != nil {
+		c.TimeSync.Stop()
+	}
+	return nil
+}
+
+// NewBinancePublicClient creates a client without API keys for the public market data endpoints
+func NewBinancePublicClient(accountType BinanceAccountType) *BinanceClient {
+	baseClient := base.NewClient("", "", BinanceHttpURLs[accountType])
+	baseClient.Limiter = SharedRateLimitManager(accountType)
 	return &BinanceClient{
-		Client: baseClient,
-		ExID:   "binance",
+		Client:      baseClient,
+		ExID:        "binance",
+		AccountType: accountType,
+	}
+}
+
+// GetDepth retrieves the order book snapshot of a symbol, limit is the number of levels per side
+func (c *BinanceClient) GetDepth(symbol string, limit int) (*DepthSnapshot, error) {
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(symbol))
+	if limit > 0 {
+		values.Add("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: BinanceDepthEndpoints[c.AccountType],
+		Payload:  &values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get depth: %w", err)
+	}
+
+	var snapshot DepthSnapshot
+	if err := json.Unmarshal(resp, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// GetHistoricalTrades retrieves up to limit trades of a symbol from fromID on, oldest
+// first. The endpoint needs an API key but no signature.
+func (c *BinanceClient) GetHistoricalTrades(symbol string, fromID int64, limit int) ([]HistoricalTrade, error) {
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(symbol))
+	values.Add("fromId", strconv.FormatInt(fromID, 10))
+	if limit > 0 {
+		values.Add("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: BinanceHistoricalTradesEndpoints[c.AccountType],
+		Payload:  &values,
+		KeyOnly:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get historical trades: %w", err)
+	}
+
+	var trades []HistoricalTrade
+	if err := json.Unmarshal(resp, &trades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return trades, nil
+}
+
+// GetAggTrades retrieves one page of aggregate trades of a symbol, oldest first
+func (c *BinanceClient) GetAggTrades(params *AggTradesParams) ([]AggTrade, error) {
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	if params.FromID != nil {
+		values.Add("fromId", strconv.FormatInt(*params.FromID, 10))
+	} else {
+		if params.StartTime != nil {
+			values.Add("startTime", strconv.FormatInt(*params.StartTime, 10))
+		}
+		if params.EndTime != nil {
+			values.Add("endTime", strconv.FormatInt(*params.EndTime, 10))
+		}
+	}
+	if params.Limit != nil {
+		values.Add("limit", strconv.Itoa(*params.Limit))
+	}
+
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: BinanceAggTradesEndpoints[c.AccountType],
+		Payload:  &values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aggTrades: %w", err)
+	}
+
+	var trades []AggTrade
+	if err := json.Unmarshal(resp, &trades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	symbol := strings.ToUpper(params.Symbol)
+	for i := range trades {
+		trades[i].EventType = "aggTrade"
+		trades[i].Symbol = symbol
+	}
+	return trades, nil
+}
+
+// GetPremiumIndex retrieves the mark price, index price and funding rate of a symbol,
+// or of every symbol if symbol is empty
+func (c *BinanceClient) GetPremiumIndex(symbol string) ([]PremiumIndex, error) {
+	endpoint, ok := BinancePremiumIndexEndpoints[c.AccountType]
+	if !ok {
+		return nil, fmt.Errorf("premium index is not supported for account type %s", c.AccountType)
+	}
+	values := url.Values{}
+	if symbol != "" {
+		values.Add("symbol", strings.ToUpper(symbol))
+	}
+
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: endpoint,
+		Payload:  &values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get premium index: %w", err)
+	}
+
+	// 指定 symbol 时返回单个对象，否则返回数组
+	var indexes []PremiumIndex
+	if base.IsArray(resp) {
+		err = json.Unmarshal(resp, &indexes)
+	} else {
+		indexes = make([]PremiumIndex, 1)
+		err = json.Unmarshal(resp, &indexes[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return indexes, nil
+}
+
+// GetFundingRateHistory retrieves the settled funding rates of a symbol, oldest first
+func (c *BinanceClient) GetFundingRateHistory(params *FundingRateParams) ([]FundingRate, error) {
+	endpoint, ok := BinanceFundingRateEndpoints[c.AccountType]
+	if !ok {
+		return nil, fmt.Errorf("funding rate is not supported for account type %s", c.AccountType)
+	}
+	values := url.Values{}
+	if params.Symbol != "" {
+		values.Add("symbol", strings.ToUpper(params.Symbol))
+	}
+	if params.StartTime != nil {
+		values.Add("startTime", strconv.FormatInt(*params.StartTime, 10))
+	}
+	if params.EndTime != nil {
+		values.Add("endTime", strconv.FormatInt(*params.EndTime, 10))
+	}
+	if params.Limit != nil {
+		values.Add("limit", strconv.Itoa(*params.Limit))
+	}
+
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: endpoint,
+		Payload:  &values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get funding rate history: %w", err)
+	}
+
+	var rates []FundingRate
+	if err := json.Unmarshal(resp, &rates); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return rates, nil
+}
+
+// aggTradesPageLimit is the largest page the aggTrades endpoint returns
+const aggTradesPageLimit = 1000
+
+// aggTradesWindow is the longest startTime-endTime window the aggTrades endpoint accepts
+const aggTradesWindow = time.Hour
+
+// PageAggTrades calls fn with every page of aggregate trades of symbol from startTime
+// (ms) on, paging by fromId, until a trade after endTime (ms, 0 for now) or the newest
+// trade is reached. It returns the ID of the last trade passed to fn, -1 if none.
+func (c *BinanceClient) PageAggTrades(symbol string, startTime, endTime int64, fn func(trades []AggTrade) error) (int64, error) {
+	limit := aggTradesPageLimit
+	params := &AggTradesParams{Symbol: symbol, Limit: &limit}
+	lastID := int64(-1)
+	if endTime <= 0 {
+		endTime = math.MaxInt64
+	}
+
+	// 时间窗口最长 1 小时，逐个窗口找到第一页，之后按 fromId 翻页
+	var trades []AggTrade
+	for start := startTime; len(trades) == 0; start += aggTradesWindow.Milliseconds() {
+		if start > endTime || start > time.Now().UnixMilli() {
+			return lastID, nil
+		}
+		end := min(start+aggTradesWindow.Milliseconds()-1, endTime)
+		params.StartTime, params.EndTime = &start, &end
+		var err error
+		if trades, err = c.GetAggTrades(params); err != nil {
+			return lastID, err
+		}
+	}
+	// 窗口内的结果可能不满一页，从第一笔成交起按 fromId 重新请求
+	from := trades[0].AggTradeID
+	params.StartTime, params.EndTime, params.FromID = nil, nil, &from
+	trades, err := c.GetAggTrades(params)
+	if err != nil {
+		return lastID, err
+	}
+
+	for {
+		done := false
+		for i, trade := range trades {
+			if trade.TradeTime > endTime {
+				trades, done = trades[:i], true
+				break
+			}
+		}
+		if len(trades) > 0 {
+			if err := fn(trades); err != nil {
+				return lastID, err
+			}
+			lastID = trades[len(trades)-1].AggTradeID
+		}
+		if done || len(trades) < limit {
+			return lastID, nil
+		}
+
+		from = lastID + 1
+		if trades, err = c.GetAggTrades(params); err != nil {
+			return lastID, err
+		}
 	}
 }
 
@@ -116,6 +470,8 @@ type FetchRequest struct {
 	Endpoint string
 	Payload  *url.Values
 	Signed   bool
+	// KeyOnly 只需要 API key、不需要签名的接口 (MARKET_DATA)
+	KeyOnly bool
 }
 
 // Fetch sends a request to the API with optional signing
@@ -124,7 +480,14 @@ func (c *BinanceClient) fetch(req FetchRequest) ([]byte, error) {
 	if req.Payload == nil {
 		req.Payload = &url.Values{}
 	}
-	req.Payload.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	now := time.Now()
+	if c.TimeSync != nil {
+		now = c.TimeSync.Now()
+	}
+	req.Payload.Set("timestamp", strconv.FormatInt(now.UnixMilli(), 10))
+	if req.Signed && c.RecvWindow > 0 && !req.Payload.Has("recvWindow") {
+		req.Payload.Set("recvWindow", strconv.FormatInt(c.RecvWindow.Milliseconds(), 10))
+	}
 
 	queryString := req.Payload.Encode()
 
@@ -133,17 +496,25 @@ func (c *BinanceClient) fetch(req FetchRequest) ([]byte, error) {
 		queryString += "&signature=" + c.generateSignature(queryString)
 	}
 
-	// Build and send request
-	httpReq, err := c.BuildRequest(req.Method, req.Endpoint, queryString)
+	// Build and send request, POST / PUT / DELETE 的参数放在 form body 中，签名覆盖整个 body
+	var httpReq *http.Request
+	var err error
+	if req.Method == http.MethodGet || req.Method == "" {
+		httpReq, err = c.BuildRequest(req.Method, req.Endpoint, queryString)
+	} else {
+		httpReq, err = c.BuildBodyRequest(req.Method, req.Endpoint, queryString)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to build request: %w", err)
 	}
 
 	// Add API key header if signed request
-	if req.Signed {
+	if req.Signed || req.KeyOnly {
 		httpReq.Header.Add("X-MBX-APIKEY", c.ApiKey)
 	}
-	httpReq.Header.Add("Content-Type", "application/json")
+	if httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Add("Content-Type", "application/json")
+	}
 	httpReq.Header.Add("User-Agent", "TradingBot/1.0")
 
 	// Send request and handle response
@@ -0,0 +1,281 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestNewFuturesOrderSigned(t *testing.T) {
+	var method, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, body = r.Method, string(data)
+		if r.URL.Path != "/fapi/v1/order" || r.Header.Get("X-MBX-APIKEY") != "key" || r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1,"msg":"bad request"}`))
+			return
+		}
+		w.Write([]byte(`{"orderId":42,"clientOrderId":"c1","symbol":"BTCUSDT","status":"PARTIALLY_FILLED",` +
+			`"type":"LIMIT","side":"BUY","positionSide":"BOTH","timeInForce":"GTX","price":"97000.10",` +
+			`"avgPrice":"97000.10","origQty":"0.030","executedQty":"0.010","cumQuote":"970.001",` +
+			`"reduceOnly":true,"updateTime":1700000000000}`))
+	}))
+	defer srv.Close()
+
+	client := &BinanceClient{Client: base.NewClient("key", "secret", srv.URL), AccountType: BinanceAccountTypeUsdMFuturesTestnet}
+	order, err := client.NewFuturesOrder(&base.Order{
+		Symbol:        "btcusdt",
+		Side:          base.OrderSideBuy,
+		Type:          base.OrderTypeLimit,
+		TimeInForce:   base.TimeInForceGTX,
+		Price:         decimal.RequireFromString("97000.10"),
+		Amount:        decimal.RequireFromString("0.030"),
+		ReduceOnly:    true,
+		ClientOrderId: "c1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 参数在 body 中，签名覆盖 signature 之前的全部参数
+	i := strings.LastIndex(body, "&signature=")
+	if method != http.MethodPost || i < 0 || body[i+len("&signature="):] != client.generateSignature(body[:i]) {
+		t.Fatalf("unexpected %s body %s", method, body)
+	}
+	for _, param := range []string{"symbol=BTCUSDT", "side=BUY", "type=LIMIT", "price=97000.1", "quantity=0.03",
+		"timeInForce=GTX", "reduceOnly=true", "newClientOrderId=c1"} {
+		if !strings.Contains(body, param) {
+			t.Fatalf("body %s lacks %s", body, param)
+		}
+	}
+
+	if order.Id != "42" || order.Status != base.OrderStatusPartiallyFilled || order.PositionSide != base.PositionSideBoth ||
+		!order.Remaining.Equal(decimal.RequireFromString("0.02")) || !order.CumCost.Equal(decimal.RequireFromString("970.001")) ||
+		!order.ReduceOnly || order.Timestamp != 1700000000000 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	if _, err := client.NewFuturesOrder(&base.Order{Symbol: "BTCUSDT", Side: base.OrderSideSell, Type: base.OrderTypeMarket,
+		Amount: decimal.NewFromInt(1), PositionSide: base.PositionSideLong, ReduceOnly: true}); err == nil {
+		t.Fatal("expected an error for reduceOnly in hedge mode")
+	}
+}
+
+func TestNewOrderIsolatedMargin(t *testing.T) {
+	var path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(data)
+		w.Write([]byte(`{"orderId":7,"clientOrderId":"m1","symbol":"ETHUSDT","status":"FILLED","type":"LIMIT_MAKER",` +
+			`"side":"SELL","price":"3000","origQty":"2","executedQty":"2","cummulativeQuoteQty":"6001",` +
+			`"isIsolated":true,"transactTime":1700000000000,"fills":[` +
+			`{"price":"3000","qty":"1","commission":"0.3","commissionAsset":"USDT","tradeId":1},` +
+			`{"price":"3001","qty":"1","commission":"0.3","commissionAsset":"USDT","tradeId":2}]}`))
+	}))
+	defer srv.Close()
+
+	client := &BinanceClient{Client: base.NewClient("key", "secret", srv.URL), AccountType: BinanceAccountTypeIsolatedMargin}
+	order, err := client.NewOrder(&base.Order{
+		Symbol:        "ethusdt",
+		Side:          base.OrderSideSell,
+		Type:          base.OrderTypeLimit,
+		TimeInForce:   base.TimeInForceGTX,
+		Price:         decimal.NewFromInt(3000),
+		Amount:        decimal.NewFromInt(2),
+		ClientOrderId: "m1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/sapi/v1/margin/order" {
+		t.Fatalf("unexpected path %s", path)
+	}
+	for _, param := range []string{"isIsolated=TRUE", "type=LIMIT_MAKER", "newOrderRespType=FULL"} {
+		if !strings.Contains(body, param) {
+			t.Fatalf("body %s lacks %s", body, param)
+		}
+	}
+	if strings.Contains(body, "timeInForce") {
+		t.Fatalf("LIMIT_MAKER body %s has timeInForce", body)
+	}
+
+	if order.Status != base.OrderStatusFilled || !order.Average.Equal(decimal.RequireFromString("3000.5")) ||
+		!order.Fee.Equal(decimal.RequireFromString("0.6")) || !order.LastFilledPrice.Equal(decimal.NewFromInt(3001)) ||
+		order.Timestamp != 1700000000000 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+}
+
+func TestRateLimitCooldown(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "2400")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"code":-1003,"msg":"Too many requests"}`))
+	}))
+	defer srv.Close()
+
+	limiter := NewRateLimitManager(BinanceAccountTypeUsdMFutures, time.Second)
+	client := &BinanceClient{Client: base.NewClient("key", "secret", srv.URL), AccountType: BinanceAccountTypeUsdMFutures}
+	client.Limiter = limiter
+	if _, err := client.GetDepth("BTCUSDT", 100); err == nil || errors.Is(err, base.ErrRateLimited) {
+		t.Fatalf("expected the 429 api error, got %v", err)
+	}
+	if until := time.Until(limiter.CooldownUntil()); until < 29*time.Second || until > 30*time.Second {
+		t.Fatalf("unexpected cool-down %s", until)
+	}
+
+	// 冷却期间不再发出请求
+	if _, err := client.GetDepth("BTCUSDT", 100); !errors.Is(err, base.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("server got %d requests", requests)
+	}
+}
+
+func TestRateLimitSharedPerHost(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"code":-1003,"msg":"Too many requests"}`))
+	}))
+	defer srv.Close()
+	saved := BinanceHttpURLs[BinanceAccountTypeUsdMFutures]
+	BinanceHttpURLs[BinanceAccountTypeUsdMFutures] = srv.URL
+	defer func() { BinanceHttpURLs[BinanceAccountTypeUsdMFutures] = saved }()
+
+	public := NewBinancePublicClient(BinanceAccountTypeUsdMFutures)
+	private := NewBinanceClient(&base.Config{}, BinanceAccountTypeUsdMFutures)
+	if public.Limiter != private.Limiter {
+		t.Fatal("clients of the same host use different rate limit managers")
+	}
+	if _, err := public.GetDepth("BTCUSDT", 100); err == nil || errors.Is(err, base.ErrRateLimited) {
+		t.Fatalf("expected the 429 api error, got %v", err)
+	}
+	// 一个客户端收到 429 后，同一主机的其他客户端也进入冷却
+	private.Limiter.(*RateLimitManager).MaxWait = 0
+	if _, err := private.GetDepth("BTCUSDT", 100); !errors.Is(err, base.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("server got %d requests", requests)
+	}
+}
+
+func TestBinanceCredentials(t *testing.T) {
+	// viper 读出的 map key 是小写的
+	config := &base.Config{
+		BinanceFutureTestnet: base.ExchangeConfig{APIKey: "futures-testnet"},
+		Binance: map[string]base.ExchangeConfig{
+			"spot":   {APIKey: "spot", SecretKey: "spot-secret"},
+			"margin": {APIKey: "margin", SecretKey: "margin-secret"},
+		},
+	}
+	for accountType, want := range map[BinanceAccountType]string{
+		BinanceAccountTypeSpot:               "spot",
+		BinanceAccountTypeMargin:             "margin",
+		BinanceAccountTypeIsolatedMargin:     "",
+		BinanceAccountTypeUsdMFutures:        "",
+		BinanceAccountTypeUsdMFuturesTestnet: "futures-testnet",
+	} {
+		if got := NewBinanceClient(config, accountType).ApiKey; got != want {
+			t.Fatalf("%s signs with %q, want %q", accountType, got, want)
+		}
+	}
+
+	config.Binance["USD_M_FUTURE_TESTNET"] = base.ExchangeConfig{APIKey: "configured"}
+	if got := BinanceCredentials(config, BinanceAccountTypeUsdMFuturesTestnet).APIKey; got != "configured" {
+		t.Fatalf("futures testnet signs with %q", got)
+	}
+}
+
+func TestTimeSyncSignedTimestamp(t *testing.T) {
+	const drift = 5 * time.Second
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/time":
+			fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().Add(drift).UnixMilli())
+		default:
+			query = r.URL.Query()
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+
+	client := &BinanceClient{Client: base.NewClient("key", "secret", srv.URL), AccountType: BinanceAccountTypeUsdMFutures,
+		RecvWindow: 3 * time.Second}
+	var events []DriftEvent
+	client.TimeSync = NewTimeSync(client, time.Minute, time.Second, func(event DriftEvent) {
+		events = append(events, event)
+	})
+	if err := client.TimeSync.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if offset := client.TimeSync.Offset(); offset < drift-50*time.Millisecond || offset > drift+50*time.Millisecond {
+		t.Fatalf("unexpected offset %v", offset)
+	}
+	if len(events) != 1 || events[0].Threshold != time.Second {
+		t.Fatalf("unexpected drift events %+v", events)
+	}
+
+	if _, err := client.GetFuturesOpenOrders("BTCUSDT"); err != nil {
+		t.Fatal(err)
+	}
+	timestamp, _ := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+	if d := time.UnixMilli(timestamp).Sub(time.Now().Add(drift)); d < -time.Second || d > 0 {
+		t.Fatalf("timestamp %d is %v off the server time", timestamp, d)
+	}
+	if query.Get("recvWindow") != "3000" {
+		t.Fatalf("unexpected recvWindow %q", query.Get("recvWindow"))
+	}
+}
+
+func TestClientDriftHandlerAndClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().Add(5*time.Second).UnixMilli())
+	}))
+	defer srv.Close()
+	restore := BinanceHttpURLs[BinanceAccountTypeUsdMFutures]
+	BinanceHttpURLs[BinanceAccountTypeUsdMFutures] = srv.URL
+	defer func() { BinanceHttpURLs[BinanceAccountTypeUsdMFutures] = restore }()
+
+	events := make(chan DriftEvent, 1)
+	config := &base.Config{REST: base.RESTConfig{TimeSyncInterval: time.Hour, MaxClockDrift: time.Second}}
+	client := NewBinanceClientWithDriftHandler(config, BinanceAccountTypeUsdMFutures, func(event DriftEvent) {
+		events <- event
+	})
+	select {
+	case event := <-events:
+		if event.Offset < 4*time.Second {
+			t.Fatalf("unexpected drift event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drift not reported")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-client.TimeSync.done:
+	default:
+		t.Fatal("time sync still running after Close")
+	}
+}
@@ -0,0 +1,308 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// 逐笔成交的序号检查：同一 symbol 的 TradeID 严格递增且连续。
+//   - 出现缺口时暂存之后的实时成交，通过 REST historicalTrades 补齐缺失的成交，
+//     按顺序发布后再发布暂存的成交
+//   - historicalTrades 需要 API key，没有带 key 的 TradeFetcher 或请求失败时退回 aggTrades，
+//     按归集成交补齐 (一条归集成交发布为一笔成交，TradeID 取其最后一笔成交 ID)
+//   - 超过 tradeMaxBackfillGap 的缺口 (长时间断线、交易所重置序号) 不补齐，从新的成交重新
+//     开始计序，缺失的成交计为 Unfilled，避免大量 REST 请求耗尽与下单共享的 IP 权重
+//   - 补齐的成交在后台 goroutine 上发布，同一 symbol 的发布由 tradeSequence.mu 串行化
+//   - 小于等于已发布 ID 的成交 (重连后的重复推送、乱序) 直接丢弃并计数
+
+const (
+	// tradeBackfillLimit 每次请求的成交数
+	tradeBackfillLimit = 1000
+	// tradeBackfillRetries 补齐失败后的重试次数，之后放弃该缺口
+	tradeBackfillRetries = 3
+	// tradeMaxBackfillGap 补齐的最大缺口，约 10 页 historicalTrades
+	tradeMaxBackfillGap = 10 * tradeBackfillLimit
+)
+
+// errStopPaging ends PageAggTrades early
+var errStopPaging = errors.New("stop paging")
+
+// TradeFetcher fetches historical trades by ID, BinanceClient implements it
+type TradeFetcher interface {
+	GetHistoricalTrades(symbol string, fromID int64, limit int) ([]HistoricalTrade, error)
+}
+
+// GapStats counts the sequence problems of one symbol's trades
+type GapStats struct {
+	// Gaps 检测到的缺口数，Missing 缺口内缺失的成交数
+	Gaps    int64
+	Missing int64
+	// Backfilled 通过 REST 补齐并发布的成交数
+	Backfilled int64
+	// Unfilled 放弃补齐的成交数
+	Unfilled int64
+	// Duplicates 与已发布 ID 相同的成交数，OutOfOrder 小于已发布 ID 的成交数
+	Duplicates int64
+	OutOfOrder int64
+}
+
+// tradeSequence is the sequencing state of one symbol
+type tradeSequence struct {
+	mu       sync.Mutex
+	lastID   int64
+	lastTime int64
+	// backfilling 为 true 时实时成交进入 pending
+	backfilling bool
+	pending     []Trade
+	stats       GapStats
+}
+
+// TradeSequencer checks the trade IDs of every symbol and backfills gaps before
+// publishing, trades are published in ID order
+type TradeSequencer struct {
+	trades  TradeFetcher
+	history AggTradeFetcher
+	publish func(trade *Trade)
+
+	mu        sync.Mutex
+	sequences map[string]*tradeSequence
+}
+
+// NewTradeSequencer creates a sequencer, trades needs an API key and may be nil to
+// backfill from aggregate trades only, history may be nil to backfill from historical
+// trades only
+func NewTradeSequencer(trades TradeFetcher, history AggTradeFetcher, publish func(trade *Trade)) *TradeSequencer {
+	return &TradeSequencer{
+		trades:    trades,
+		history:   history,
+		publish:   publish,
+		sequences: make(map[string]*tradeSequence),
+	}
+}
+
+// SetTradeFetcher replaces the historical trades fetcher, call it before the first trade
+func (s *TradeSequencer) SetTradeFetcher(trades TradeFetcher) {
+	s.trades = trades
+}
+
+// SetAggTradeFetcher replaces the aggregate trades fallback, call it before the first trade
+func (s *TradeSequencer) SetAggTradeFetcher(history AggTradeFetcher) {
+	s.history = history
+}
+
+// Handle publishes a live trade once every trade before it was published, trade may
+// be pooled, it is copied if it has to wait
+func (s *TradeSequencer) Handle(trade *Trade) {
+	seq := s.sequence(trade.Symbol)
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	s.handleLocked(seq, trade)
+}
+
+// Stats returns the gap statistics of every symbol
+func (s *TradeSequencer) Stats() map[string]GapStats {
+	s.mu.Lock()
+	sequences := make(map[string]*tradeSequence, len(s.sequences))
+	for symbol, seq := range s.sequences {
+		sequences[symbol] = seq
+	}
+	s.mu.Unlock()
+
+	stats := make(map[string]GapStats, len(sequences))
+	for symbol, seq := range sequences {
+		seq.mu.Lock()
+		stats[symbol] = seq.stats
+		seq.mu.Unlock()
+	}
+	return stats
+}
+
+func (s *TradeSequencer) sequence(symbol string) *tradeSequence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq, ok := s.sequences[symbol]
+	if !ok {
+		seq = &tradeSequence{}
+		s.sequences[symbol] = seq
+	}
+	return seq
+}
+
+// handleLocked must be called with seq.mu held
+func (s *TradeSequencer) handleLocked(seq *tradeSequence, trade *Trade) {
+	if seq.backfilling {
+		seq.pending = append(seq.pending, *trade)
+		return
+	}
+
+	switch {
+	case seq.lastID == 0 || trade.TradeID == seq.lastID+1:
+	case trade.TradeID == seq.lastID:
+		seq.stats.Duplicates++
+		return
+	case trade.TradeID < seq.lastID:
+		seq.stats.OutOfOrder++
+		return
+	default:
+		from, to := seq.lastID+1, trade.TradeID-1
+		seq.stats.Gaps++
+		seq.stats.Missing += to - from + 1
+		if to-from+1 > tradeMaxBackfillGap {
+			seq.stats.Unfilled += to - from + 1
+			log.Warnf("Trade gap on %s: missing %d-%d exceeds %d trades, restarting the sequence", trade.Symbol, from, to, tradeMaxBackfillGap)
+			break
+		}
+		log.Warnf("Trade gap on %s: missing %d-%d, backfilling", trade.Symbol, from, to)
+
+		seq.backfilling = true
+		seq.pending = append(seq.pending, *trade)
+		go s.backfill(seq, trade.Symbol, from, to, seq.lastTime, trade.TradeTime)
+		return
+	}
+
+	seq.lastID, seq.lastTime = trade.TradeID, trade.TradeTime
+	s.publish(trade)
+}
+
+// backfill fetches the trades from..to, publishes them and then the trades that
+// arrived in the meantime
+func (s *TradeSequencer) backfill(seq *tradeSequence, symbol string, from, to, fromTime, toTime int64) {
+	err := fmt.Errorf("no trade fetcher")
+	for attempt := 0; attempt <= tradeBackfillRetries && (s.trades != nil || s.history != nil); attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		if s.trades != nil {
+			if err = s.backfillTrades(seq, symbol, from, to); err == nil {
+				break
+			}
+		}
+		if s.history != nil {
+			if err = s.backfillAggTrades(seq, symbol, to, fromTime, toTime); err == nil {
+				break
+			}
+		}
+		// 已经发布的部分不再重复请求
+		seq.mu.Lock()
+		from = max(from, seq.lastID+1)
+		seq.mu.Unlock()
+	}
+
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	if err != nil {
+		seq.stats.Unfilled += max(to-seq.lastID, 0)
+		log.Errorf("Failed to backfill trades %d-%d of %s, skipping them: %v", from, to, symbol, err)
+	}
+	seq.lastID = max(seq.lastID, to)
+	seq.backfilling = false
+
+	pending := seq.pending
+	seq.pending = nil
+	for i := range pending {
+		s.handleLocked(seq, &pending[i])
+	}
+}
+
+// backfillTrades publishes the trades from..to from the historical trades endpoint
+func (s *TradeSequencer) backfillTrades(seq *tradeSequence, symbol string, from, to int64) error {
+	for from <= to {
+		trades, err := s.trades.GetHistoricalTrades(symbol, from, int(min(to-from+1, tradeBackfillLimit)))
+		if err != nil {
+			return err
+		}
+		if len(trades) == 0 {
+			return fmt.Errorf("no trades from %d", from)
+		}
+
+		seq.mu.Lock()
+		start := from
+		for _, t := range trades {
+			if t.ID < from || t.ID > to {
+				continue
+			}
+			trade := Trade{
+				EventType:  "trade",
+				EventTime:  t.Time,
+				Symbol:     symbol,
+				TradeID:    t.ID,
+				Price:      t.Price,
+				Quantity:   t.Qty,
+				TradeTime:  t.Time,
+				IsMaker:    t.IsBuyerMaker,
+				ReceivedAt: time.Now(),
+			}
+			s.publishBackfilled(seq, &trade, 1)
+			from = t.ID + 1
+		}
+		if from == start {
+			// 返回的成交都不在缺口内，交易所没有这些成交，重试也补不齐
+			seq.stats.Unfilled += to - from + 1
+			seq.mu.Unlock()
+			log.Errorf("Historical trades of %s from %d are outside the gap, skipping %d-%d", symbol, start, start, to)
+			return nil
+		}
+		seq.mu.Unlock()
+	}
+	return nil
+}
+
+// backfillAggTrades publishes the aggregate trades covering the gap up to to, fromTime
+// and toTime (ms) bound the gap. An aggregate trade reaching past to can't be split,
+// the trades of it within the gap are counted as unfilled.
+func (s *TradeSequencer) backfillAggTrades(seq *tradeSequence, symbol string, to, fromTime, toTime int64) error {
+	straddled := false
+	_, err := s.history.PageAggTrades(symbol, fromTime, toTime, func(trades []AggTrade) error {
+		seq.mu.Lock()
+		defer seq.mu.Unlock()
+		for _, t := range trades {
+			if t.LastTradeID <= seq.lastID {
+				continue
+			}
+			if t.LastTradeID > to {
+				straddled = true
+				return errStopPaging
+			}
+			trade := Trade{
+				EventType:  "trade",
+				EventTime:  t.TradeTime,
+				Symbol:     symbol,
+				TradeID:    t.LastTradeID,
+				Price:      t.Price,
+				Quantity:   t.Quantity,
+				TradeTime:  t.TradeTime,
+				IsMaker:    t.IsMaker,
+				ReceivedAt: time.Now(),
+			}
+			s.publishBackfilled(seq, &trade, t.LastTradeID-max(t.FirstTradeID, seq.lastID+1)+1)
+		}
+		return nil
+	})
+	if err != nil && err != errStopPaging {
+		return err
+	}
+
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	if seq.lastID >= to {
+		return nil
+	}
+	if !straddled {
+		return fmt.Errorf("aggTrades end at trade %d", seq.lastID)
+	}
+	seq.stats.Unfilled += to - seq.lastID
+	seq.lastID = to
+	return nil
+}
+
+// publishBackfilled publishes a backfilled trade covering n trade IDs, must be called
+// with seq.mu held
+func (s *TradeSequencer) publishBackfilled(seq *tradeSequence, trade *Trade, n int64) {
+	seq.lastID, seq.lastTime = trade.TradeID, trade.TradeTime
+	seq.stats.Backfilled += n
+	s.publish(trade)
+}
@@ -0,0 +1,121 @@
+package binance
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryFetcher serves the trades with IDs 1..n, requests wait for gate if it is set
+type memoryFetcher struct {
+	n     int64
+	gate  chan struct{}
+	calls atomic.Int32
+}
+
+func (f *memoryFetcher) GetHistoricalTrades(symbol string, fromID int64, limit int) ([]HistoricalTrade, error) {
+	f.calls.Add(1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	var trades []HistoricalTrade
+	for id := fromID; id <= f.n && len(trades) < limit; id++ {
+		trades = append(trades, HistoricalTrade{ID: id, Time: id})
+	}
+	return trades, nil
+}
+
+// outOfRangeFetcher returns trades past the requested range
+type outOfRangeFetcher struct{}
+
+func (outOfRangeFetcher) GetHistoricalTrades(symbol string, fromID int64, limit int) ([]HistoricalTrade, error) {
+	return []HistoricalTrade{{ID: fromID + 100}, {ID: fromID + 101}}, nil
+}
+
+func newTestSequencer(trades TradeFetcher) (*TradeSequencer, chan int64) {
+	published := make(chan int64, 16)
+	sequencer := NewTradeSequencer(trades, nil, func(trade *Trade) {
+		published <- trade.TradeID
+	})
+	return sequencer, published
+}
+
+func handleTrades(sequencer *TradeSequencer, ids ...int64) {
+	for _, id := range ids {
+		sequencer.Handle(&Trade{Symbol: "BTCUSDT", TradeID: id, TradeTime: id})
+	}
+}
+
+func expectPublished(t *testing.T, published chan int64, ids ...int64) {
+	t.Helper()
+	for _, want := range ids {
+		select {
+		case id := <-published:
+			if id != want {
+				t.Fatalf("got trade %d, want %d", id, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("trade %d not published", want)
+		}
+	}
+}
+
+func TestBackfillGap(t *testing.T) {
+	sequencer, published := newTestSequencer(&memoryFetcher{n: 10})
+	handleTrades(sequencer, 1, 5)
+	expectPublished(t, published, 1, 2, 3, 4, 5)
+
+	stats := sequencer.Stats()["BTCUSDT"]
+	if want := (GapStats{Gaps: 1, Missing: 3, Backfilled: 3}); stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestBackfillHoldsLiveTrades(t *testing.T) {
+	fetcher := &memoryFetcher{n: 10, gate: make(chan struct{})}
+	sequencer, published := newTestSequencer(fetcher)
+	handleTrades(sequencer, 1, 4, 5, 3)
+	expectPublished(t, published, 1)
+
+	// 补齐完成前实时成交都被暂存
+	time.Sleep(20 * time.Millisecond)
+	if len(published) != 0 {
+		t.Fatalf("published trade %d during the backfill", <-published)
+	}
+	close(fetcher.gate)
+	expectPublished(t, published, 2, 3, 4, 5)
+
+	handleTrades(sequencer, 6)
+	expectPublished(t, published, 6)
+	stats := sequencer.Stats()["BTCUSDT"]
+	if want := (GapStats{Gaps: 1, Missing: 2, Backfilled: 2, OutOfOrder: 1}); stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestBackfillOutOfRangeTrades(t *testing.T) {
+	sequencer, published := newTestSequencer(outOfRangeFetcher{})
+	handleTrades(sequencer, 1, 5)
+	expectPublished(t, published, 1, 5)
+
+	stats := sequencer.Stats()["BTCUSDT"]
+	if want := (GapStats{Gaps: 1, Missing: 3, Unfilled: 3}); stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestBackfillGapTooLarge(t *testing.T) {
+	fetcher := &memoryFetcher{n: 10}
+	sequencer, published := newTestSequencer(fetcher)
+	last := int64(tradeMaxBackfillGap + 3)
+	handleTrades(sequencer, 1, last, last+1)
+	expectPublished(t, published, 1, last, last+1)
+
+	if fetcher.calls.Load() != 0 {
+		t.Fatalf("fetched %d pages for an oversized gap", fetcher.calls.Load())
+	}
+	stats := sequencer.Stats()["BTCUSDT"]
+	if want := (GapStats{Gaps: 1, Missing: tradeMaxBackfillGap + 1, Unfilled: tradeMaxBackfillGap + 1}); stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
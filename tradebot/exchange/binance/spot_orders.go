@@ -0,0 +1,592 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tradebot_go/tradebot/base"
+
+	"github.com/shopspring/decimal"
+)
+
+// 现货与杠杆下单接口，按 client 的账户类型选择接口族：
+//   - 现货 /api/v3，全仓杠杆 /sapi/v1/margin，逐仓杠杆同一接口加 isIsolated=TRUE
+//   - U 本位合约账户转到 futures_orders.go 中的对应方法
+//   - 现货没有 reduceOnly / positionSide；限价单 TimeInForce 为 GTX 时按 LIMIT_MAKER 下单
+//   - OCO 为一对止盈限价 (LIMIT_MAKER) 与止损单，OTOCO 为一笔限价单成交后挂出的 OCO，杠杆不支持 OTOCO
+
+// SpotFill is one fill of a spot or margin order
+type SpotFill struct {
+	TradeID         int64           `json:"tradeId"`
+	Price           decimal.Decimal `json:"price"`
+	Qty             decimal.Decimal `json:"qty"`
+	Commission      decimal.Decimal `json:"commission"`
+	CommissionAsset string          `json:"commissionAsset"`
+}
+
+// SpotOrder is a spot or margin order as returned by the order endpoints
+type SpotOrder struct {
+	OrderID     int64  `json:"orderId"`
+	OrderListID int64  `json:"orderListId"`
+	Symbol      string `json:"symbol"`
+	// ClientOrderID 撤单接口返回撤单请求的 ID，原订单的 ID 在 OrigClientOrderID
+	ClientOrderID       string          `json:"clientOrderId"`
+	OrigClientOrderID   string          `json:"origClientOrderId"`
+	Status              string          `json:"status"`
+	Type                string          `json:"type"`
+	Side                string          `json:"side"`
+	TimeInForce         string          `json:"timeInForce"`
+	Price               decimal.Decimal `json:"price"`
+	StopPrice           decimal.Decimal `json:"stopPrice"`
+	OrigQty             decimal.Decimal `json:"origQty"`
+	ExecutedQty         decimal.Decimal `json:"executedQty"`
+	CummulativeQuoteQty decimal.Decimal `json:"cummulativeQuoteQty"`
+	IsIsolated          bool            `json:"isIsolated"`
+	// TransactTime 下单 / 撤单接口的时间，Time / UpdateTime 查询接口的时间
+	TransactTime int64      `json:"transactTime"`
+	Time         int64      `json:"time"`
+	UpdateTime   int64      `json:"updateTime"`
+	Fills        []SpotFill `json:"fills"`
+}
+
+// Order converts o into a base.Order, the fee is the sum of the fills' commissions
+func (o *SpotOrder) Order() base.Order {
+	status, ok := binanceOrderStatuses[o.Status]
+	if !ok {
+		status = base.OrderStatus(o.Status)
+	}
+	timestamp := o.UpdateTime
+	if timestamp == 0 {
+		timestamp = max(o.TransactTime, o.Time)
+	}
+	clientOrderID := o.OrigClientOrderID
+	if clientOrderID == "" {
+		clientOrderID = o.ClientOrderID
+	}
+	order := base.Order{
+		Exchange:      BinanceExchange,
+		Symbol:        o.Symbol,
+		Status:        status,
+		Id:            strconv.FormatInt(o.OrderID, 10),
+		ClientOrderId: clientOrderID,
+		Timestamp:     timestamp,
+		Type:          base.OrderType(o.Type),
+		Side:          base.OrderSide(o.Side),
+		TimeInForce:   base.TimeInForce(o.TimeInForce),
+		Price:         o.Price,
+		Amount:        o.OrigQty,
+		Filled:        o.ExecutedQty,
+		Remaining:     o.OrigQty.Sub(o.ExecutedQty),
+		CumCost:       o.CummulativeQuoteQty,
+		Success:       status != base.OrderStatusFailed,
+	}
+	if o.ExecutedQty.IsPositive() {
+		order.Average = o.CummulativeQuoteQty.Div(o.ExecutedQty)
+	}
+	for _, fill := range o.Fills {
+		order.Fee = order.Fee.Add(fill.Commission)
+		order.FeeCurrency = fill.CommissionAsset
+	}
+	if n := len(o.Fills); n > 0 {
+		order.LastFilledPrice = o.Fills[n-1].Price
+		order.LastFilled = o.Fills[n-1].Qty
+	}
+	return order
+}
+
+// SpotTrade is a fill from the spot or margin account trade list
+type SpotTrade struct {
+	ID              int64           `json:"id"`
+	Symbol          string          `json:"symbol"`
+	OrderID         int64           `json:"orderId"`
+	OrderListID     int64           `json:"orderListId"`
+	Price           decimal.Decimal `json:"price"`
+	Qty             decimal.Decimal `json:"qty"`
+	QuoteQty        decimal.Decimal `json:"quoteQty"`
+	Commission      decimal.Decimal `json:"commission"`
+	CommissionAsset string          `json:"commissionAsset"`
+	Time            int64           `json:"time"`
+	IsBuyer         bool            `json:"isBuyer"`
+	IsMaker         bool            `json:"isMaker"`
+	IsBestMatch     bool            `json:"isBestMatch"`
+	IsIsolated      bool            `json:"isIsolated"`
+}
+
+// Order converts the fill t into a base.Order of its order, the fill is in LastFilled,
+// LastFilledPrice, Cost and Fee
+func (t *SpotTrade) Order() base.Order {
+	return fillOrder(t.Symbol, t.OrderID, t.IsBuyer, t.Time, t.Price, t.Qty, t.QuoteQty, t.Commission, t.CommissionAsset)
+}
+
+func fillOrder(symbol string, orderID int64, buyer bool, time int64,
+	price, qty, quoteQty, commission decimal.Decimal, commissionAsset string) base.Order {
+	side := base.OrderSideSell
+	if buyer {
+		side = base.OrderSideBuy
+	}
+	return base.Order{
+		Exchange:        BinanceExchange,
+		Symbol:          symbol,
+		Id:              strconv.FormatInt(orderID, 10),
+		Timestamp:       time,
+		Side:            side,
+		LastFilledPrice: price,
+		LastFilled:      qty,
+		Cost:            quoteQty,
+		Fee:             commission,
+		FeeCurrency:     commissionAsset,
+		Success:         true,
+	}
+}
+
+// OCOParams describes a one-cancels-the-other pair: a limit maker order at Price and a
+// stop loss triggered at StopPrice, a stop loss limit at StopLimitPrice if it is set
+type OCOParams struct {
+	Symbol               string
+	Side                 base.OrderSide
+	Quantity             decimal.Decimal
+	Price                decimal.Decimal
+	StopPrice            decimal.Decimal
+	StopLimitPrice       decimal.Decimal
+	StopLimitTimeInForce base.TimeInForce
+	ListClientOrderID    string
+}
+
+// OTOCOParams describes a working limit order that places the pending OCO pair once
+// it is filled, Working needs Side, Price and Amount
+type OTOCOParams struct {
+	Symbol            string
+	Working           base.Order
+	Pending           OCOParams
+	ListClientOrderID string
+}
+
+// OrderList is an OCO or OTOCO order list
+type OrderList struct {
+	ID                int64
+	ListClientOrderID string
+	// ContingencyType OCO / OTO，ListOrderStatus EXECUTING / ALL_DONE / REJECT
+	ContingencyType string
+	ListOrderStatus string
+	Orders          []base.Order
+}
+
+type orderListResponse struct {
+	OrderListID       int64       `json:"orderListId"`
+	ContingencyType   string      `json:"contingencyType"`
+	ListOrderStatus   string      `json:"listOrderStatus"`
+	ListClientOrderID string      `json:"listClientOrderId"`
+	OrderReports      []SpotOrder `json:"orderReports"`
+}
+
+// NewOrder places order on the account type of the client, see NewFuturesOrder for the fields
+func (c *BinanceClient) NewOrder(order *base.Order) (*base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		return c.NewFuturesOrder(order)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values, err := spotOrderValues(order)
+	if err != nil {
+		return nil, err
+	}
+	values.Add("newOrderRespType", "FULL")
+	return c.spotOrder(http.MethodPost, endpoints.Order, values, "failed to place order")
+}
+
+// CancelOrder cancels an order and returns it
+func (c *BinanceClient) CancelOrder(params *OrderIDParams) (*base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		return c.CancelFuturesOrder(params)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values, err := orderIDValues(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
+	}
+	return c.spotOrder(http.MethodDelete, endpoints.Order, values, "failed to cancel order")
+}
+
+// CancelAllOrders cancels every open order and order list of symbol
+func (c *BinanceClient) CancelAllOrders(symbol string) error {
+	if c.checkUsdMFutures() == nil {
+		return c.CancelAllFuturesOrders(symbol)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(symbol))
+	if _, err := c.fetch(c.orderRequest(http.MethodDelete, endpoints.OpenOrders, values)); err != nil {
+		return fmt.Errorf("failed to cancel all orders: %w", err)
+	}
+	return nil
+}
+
+// GetOrder queries an order
+func (c *BinanceClient) GetOrder(params *OrderIDParams) (*base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		return c.GetFuturesOrder(params)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values, err := orderIDValues(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return c.spotOrder(http.MethodGet, endpoints.Order, values, "failed to get order")
+}
+
+// GetOpenOrders retrieves the open orders of symbol, or of every symbol if symbol is
+// empty (isolated margin needs a symbol)
+func (c *BinanceClient) GetOpenOrders(symbol string) ([]base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		return c.GetFuturesOpenOrders(symbol)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	if symbol != "" {
+		values.Add("symbol", strings.ToUpper(symbol))
+	}
+	return c.spotOrders(endpoints.OpenOrders, values, "failed to get open orders")
+}
+
+// GetAllOrders retrieves the open, filled and canceled orders of a symbol
+func (c *BinanceClient) GetAllOrders(params *AllOrdersParams) ([]base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		return c.GetFuturesAllOrders(params)
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	if params.OrderID != nil {
+		values.Add("orderId", strconv.FormatInt(*params.OrderID, 10))
+	}
+	if params.StartTime != nil {
+		values.Add("startTime", strconv.FormatInt(*params.StartTime, 10))
+	}
+	if params.EndTime != nil {
+		values.Add("endTime", strconv.FormatInt(*params.EndTime, 10))
+	}
+	if params.Limit != nil {
+		values.Add("limit", strconv.Itoa(*params.Limit))
+	}
+	if params.RecvWindow != nil {
+		values.Add("recvWindow", strconv.FormatInt(*params.RecvWindow, 10))
+	}
+	return c.spotOrders(endpoints.AllOrders, values, "failed to get orders")
+}
+
+// GetMyTrades retrieves the account's fills of a symbol, each as a base.Order of its
+// order carrying the fill (see SpotTrade.Order)
+func (c *BinanceClient) GetMyTrades(params *TradeListParams) ([]base.Order, error) {
+	if c.checkUsdMFutures() == nil {
+		trades, err := c.GetFApiTradeList(params)
+		if err != nil {
+			return nil, err
+		}
+		orders := make([]base.Order, len(trades))
+		for i, t := range trades {
+			orders[i] = fillOrder(t.Symbol, t.OrderID, t.Buyer, t.Time, t.Price, t.Qty, t.QuoteQty, t.Commission, t.CommissionAsset)
+			orders[i].PositionSide = base.PositionSide(t.PositionSide)
+		}
+		return orders, nil
+	}
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	if params.OrderID != nil {
+		values.Add("orderId", strconv.FormatInt(*params.OrderID, 10))
+	}
+	if params.StartTime != nil {
+		values.Add("startTime", strconv.FormatInt(*params.StartTime, 10))
+	}
+	if params.EndTime != nil {
+		values.Add("endTime", strconv.FormatInt(*params.EndTime, 10))
+	}
+	if params.FromID != nil {
+		values.Add("fromId", strconv.FormatInt(*params.FromID, 10))
+	}
+	if params.Limit != nil {
+		values.Add("limit", strconv.Itoa(*params.Limit))
+	}
+	if params.RecvWindow != nil {
+		values.Add("recvWindow", strconv.FormatInt(*params.RecvWindow, 10))
+	}
+
+	resp, err := c.fetch(c.orderRequest(http.MethodGet, endpoints.MyTrades, values))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade list: %w", err)
+	}
+	var trades []SpotTrade
+	if err := json.Unmarshal(resp, &trades); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	orders := make([]base.Order, len(trades))
+	for i := range trades {
+		orders[i] = trades[i].Order()
+	}
+	return orders, nil
+}
+
+// NewOCO places an OCO order list
+func (c *BinanceClient) NewOCO(params *OCOParams) (*OrderList, error) {
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("invalid OCO: %w", err)
+	}
+
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	values.Add("side", string(params.Side))
+	values.Add("quantity", params.Quantity.String())
+	if endpoints == marginOrderEndpoints {
+		// 杠杆仍是旧版 OCO 参数
+		values.Add("price", params.Price.String())
+		values.Add("stopPrice", params.StopPrice.String())
+		if params.StopLimitPrice.IsPositive() {
+			values.Add("stopLimitPrice", params.StopLimitPrice.String())
+			values.Add("stopLimitTimeInForce", string(stopLimitTimeInForce(params)))
+		}
+	} else {
+		addOCOLegs(values, "", params)
+	}
+	if params.ListClientOrderID != "" {
+		values.Add("listClientOrderId", params.ListClientOrderID)
+	}
+	values.Add("newOrderRespType", "FULL")
+	return c.orderList(http.MethodPost, endpoints.OCO, values, "failed to place OCO")
+}
+
+// NewOTOCO places an OTOCO order list, spot only
+func (c *BinanceClient) NewOTOCO(params *OTOCOParams) (*OrderList, error) {
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	if endpoints.OTOCO == "" {
+		return nil, fmt.Errorf("OTOCO is not supported for account type %s", c.AccountType)
+	}
+	working := &params.Working
+	if working.Side == "" || !working.Amount.IsPositive() || !working.Price.IsPositive() {
+		return nil, fmt.Errorf("invalid OTOCO: working side, amount and price are required")
+	}
+	if err := params.Pending.validate(); err != nil {
+		return nil, fmt.Errorf("invalid OTOCO: %w", err)
+	}
+
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(params.Symbol))
+	values.Add("workingSide", string(working.Side))
+	values.Add("workingQuantity", working.Amount.String())
+	values.Add("workingPrice", working.Price.String())
+	if working.TimeInForce == base.TimeInForceGTX {
+		values.Add("workingType", "LIMIT_MAKER")
+	} else {
+		values.Add("workingType", string(base.OrderTypeLimit))
+		values.Add("workingTimeInForce", string(timeInForceOrGTC(working.TimeInForce)))
+	}
+	if working.ClientOrderId != "" {
+		values.Add("workingClientOrderId", working.ClientOrderId)
+	}
+	values.Add("pendingSide", string(params.Pending.Side))
+	values.Add("pendingQuantity", params.Pending.Quantity.String())
+	addOCOLegs(values, "pending", &params.Pending)
+	if params.ListClientOrderID != "" {
+		values.Add("listClientOrderId", params.ListClientOrderID)
+	}
+	values.Add("newOrderRespType", "FULL")
+	return c.orderList(http.MethodPost, endpoints.OTOCO, values, "failed to place OTOCO")
+}
+
+// CancelOrderList cancels every order of an order list
+func (c *BinanceClient) CancelOrderList(symbol string, orderListID int64) (*OrderList, error) {
+	endpoints, err := c.spotOrderEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(symbol))
+	values.Add("orderListId", strconv.FormatInt(orderListID, 10))
+	return c.orderList(http.MethodDelete, endpoints.OrderList, values, "failed to cancel order list")
+}
+
+func (c *BinanceClient) spotOrderEndpoints() (BinanceOrderEndpoints, error) {
+	endpoints, ok := BinanceSpotOrderEndpoints[c.AccountType]
+	if !ok {
+		return endpoints, fmt.Errorf("spot orders are not supported for account type %s", c.AccountType)
+	}
+	return endpoints, nil
+}
+
+// orderRequest builds a signed request, isolated margin requests are marked as such
+func (c *BinanceClient) orderRequest(method string, endpoint string, values url.Values) FetchRequest {
+	if c.AccountType == BinanceAccountTypeIsolatedMargin {
+		values.Set("isIsolated", "TRUE")
+	}
+	return FetchRequest{
+		Method:   method,
+		Endpoint: endpoint,
+		Payload:  &values,
+		Signed:   true,
+	}
+}
+
+func (c *BinanceClient) spotOrder(method string, endpoint string, values url.Values, errMsg string) (*base.Order, error) {
+	resp, err := c.fetch(c.orderRequest(method, endpoint, values))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	var result SpotOrder
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	order := result.Order()
+	return &order, nil
+}
+
+func (c *BinanceClient) spotOrders(endpoint string, values url.Values, errMsg string) ([]base.Order, error) {
+	resp, err := c.fetch(c.orderRequest(http.MethodGet, endpoint, values))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	var results []SpotOrder
+	if err := json.Unmarshal(resp, &results); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	orders := make([]base.Order, len(results))
+	for i := range results {
+		orders[i] = results[i].Order()
+	}
+	return orders, nil
+}
+
+func (c *BinanceClient) orderList(method string, endpoint string, values url.Values, errMsg string) (*OrderList, error) {
+	resp, err := c.fetch(c.orderRequest(method, endpoint, values))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	var result orderListResponse
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	list := &OrderList{
+		ID:                result.OrderListID,
+		ListClientOrderID: result.ListClientOrderID,
+		ContingencyType:   result.ContingencyType,
+		ListOrderStatus:   result.ListOrderStatus,
+		Orders:            make([]base.Order, len(result.OrderReports)),
+	}
+	for i := range result.OrderReports {
+		list.Orders[i] = result.OrderReports[i].Order()
+	}
+	return list, nil
+}
+
+// spotOrderValues builds the new order parameters of order
+func spotOrderValues(order *base.Order) (url.Values, error) {
+	if order.Symbol == "" || order.Side == "" || order.Type == "" {
+		return nil, fmt.Errorf("invalid order: symbol, side and type are required")
+	}
+	if !order.Amount.IsPositive() {
+		return nil, fmt.Errorf("invalid order: amount %s must be positive", order.Amount)
+	}
+	if order.ReduceOnly || order.PositionSide != "" {
+		return nil, fmt.Errorf("invalid order: reduceOnly and positionSide are futures only")
+	}
+
+	values := url.Values{}
+	values.Add("symbol", strings.ToUpper(order.Symbol))
+	values.Add("side", string(order.Side))
+	values.Add("quantity", order.Amount.String())
+	switch order.Type {
+	case base.OrderTypeLimit:
+		if !order.Price.IsPositive() {
+			return nil, fmt.Errorf("invalid order: limit price %s must be positive", order.Price)
+		}
+		values.Add("price", order.Price.String())
+		if order.TimeInForce == base.TimeInForceGTX {
+			values.Add("type", "LIMIT_MAKER")
+		} else {
+			values.Add("type", string(base.OrderTypeLimit))
+			values.Add("timeInForce", string(timeInForceOrGTC(order.TimeInForce)))
+		}
+	case base.OrderTypeMarket:
+		values.Add("type", string(base.OrderTypeMarket))
+	default:
+		return nil, fmt.Errorf("invalid order: unsupported type %s", order.Type)
+	}
+	if order.ClientOrderId != "" {
+		values.Add("newClientOrderId", order.ClientOrderId)
+	}
+	return values, nil
+}
+
+func (p *OCOParams) validate() error {
+	if p.Side == "" || !p.Quantity.IsPositive() || !p.Price.IsPositive() || !p.StopPrice.IsPositive() {
+		return fmt.Errorf("side, quantity, price and stop price are required")
+	}
+	return nil
+}
+
+// addOCOLegs adds the limit maker and stop legs of params in the above / below form,
+// prefix is "pending" for the legs of an OTOCO. A sell OCO takes profit above and stops
+// below the market, a buy OCO the other way round.
+func addOCOLegs(values url.Values, prefix string, params *OCOParams) {
+	key := func(name string) string {
+		if prefix == "" {
+			return strings.ToLower(name[:1]) + name[1:]
+		}
+		return prefix + name
+	}
+	limit, stop := "Above", "Below"
+	if params.Side == base.OrderSideBuy {
+		limit, stop = stop, limit
+	}
+
+	values.Add(key(limit+"Type"), "LIMIT_MAKER")
+	values.Add(key(limit+"Price"), params.Price.String())
+	values.Add(key(stop+"StopPrice"), params.StopPrice.String())
+	if params.StopLimitPrice.IsPositive() {
+		values.Add(key(stop+"Type"), "STOP_LOSS_LIMIT")
+		values.Add(key(stop+"Price"), params.StopLimitPrice.String())
+		values.Add(key(stop+"TimeInForce"), string(stopLimitTimeInForce(params)))
+	} else {
+		values.Add(key(stop+"Type"), "STOP_LOSS")
+	}
+}
+
+func stopLimitTimeInForce(params *OCOParams) base.TimeInForce {
+	return timeInForceOrGTC(params.StopLimitTimeInForce)
+}
+
+func timeInForceOrGTC(timeInForce base.TimeInForce) base.TimeInForce {
+	if timeInForce == "" {
+		return base.TimeInForceGTC
+	}
+	return timeInForce
+}
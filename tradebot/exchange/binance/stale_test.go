@@ -0,0 +1,25 @@
+package binance
+
+import "testing"
+
+func TestDecideStale(t *testing.T) {
+	cases := []struct {
+		count, stale, total int
+		want                staleAction
+	}{
+		{1, 3, 3, staleResubscribe},
+		// 连接上只有这一个 stream 静默，不回收连接
+		{2, 1, 100, staleResubscribe},
+		{2, 60, 100, staleRecycle},
+		{3, 60, 100, staleIgnore},
+		{4, 1, 1, staleRecycle},
+		{8, 1, 2, staleResubscribe},
+		{staleEscalateAfter, 100, 100, staleEscalate},
+		{staleEscalateAfter * 2, 100, 100, staleIgnore},
+	}
+	for _, c := range cases {
+		if got := decideStale(c.count, c.stale, c.total); got != c.want {
+			t.Errorf("decideStale(%d, %d, %d) = %d, want %d", c.count, c.stale, c.total, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+)
+
+// DefaultMaxClockDrift is the drift threshold of a TimeSync created with threshold 0
+const DefaultMaxClockDrift = time.Second
+
+// timeSyncSamples 每次对时的采样次数，取往返时间最短的一次
+const timeSyncSamples = 3
+
+// DriftEvent is raised when the local clock is off the server clock by more than the threshold
+type DriftEvent struct {
+	Offset    time.Duration
+	RTT       time.Duration
+	Threshold time.Duration
+	Time      time.Time
+}
+
+// DriftHandler receives clock drift alerts
+type DriftHandler func(event DriftEvent)
+
+// TimeSync estimates the offset of the server clock from the local clock so that signed
+// requests carry the server's time. 偏差按 serverTime - (发送时间 + RTT/2) 估计，
+// 超过阈值时仍然会修正，但同时告警，说明本机时钟需要校准
+type TimeSync struct {
+	client    *BinanceClient
+	interval  time.Duration
+	threshold time.Duration
+	onDrift   DriftHandler
+
+	offset atomic.Int64 // 服务器时间 - 本地时间，纳秒
+	rtt    atomic.Int64 // 纳秒
+
+	running   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTimeSync creates a time sync that queries the server time of client every interval
+func NewTimeSync(client *BinanceClient, interval time.Duration, threshold time.Duration, onDrift DriftHandler) *TimeSync {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if threshold <= 0 {
+		threshold = DefaultMaxClockDrift
+	}
+	return &TimeSync{
+		client:    client,
+		interval:  interval,
+		threshold: threshold,
+		onDrift:   onDrift,
+		done:      make(chan struct{}),
+	}
+}
+
+// Now returns the estimated server time
+func (s *TimeSync) Now() time.Time {
+	return time.Now().Add(s.Offset())
+}
+
+// Offset returns the estimated server time minus the local time
+func (s *TimeSync) Offset() time.Duration {
+	return time.Duration(s.offset.Load())
+}
+
+// RTT returns the round-trip time of the sample the offset was estimated from
+func (s *TimeSync) RTT() time.Duration {
+	return time.Duration(s.rtt.Load())
+}
+
+// Sync queries the server time and updates the offset
+func (s *TimeSync) Sync() error {
+	var offset, rtt time.Duration
+	for i := 0; i < timeSyncSamples; i++ {
+		sent := time.Now()
+		serverTime, err := s.client.GetServerTime()
+		if err != nil {
+			return err
+		}
+		sampleRTT := time.Since(sent)
+		if i == 0 || sampleRTT < rtt {
+			rtt = sampleRTT
+			offset = time.UnixMilli(serverTime).Sub(sent.Add(sampleRTT / 2))
+		}
+	}
+	s.offset.Store(int64(offset))
+	s.rtt.Store(int64(rtt))
+
+	if offset > s.threshold || offset < -s.threshold {
+		log.Warnf("Binance %s clock drift %v exceeds %v (rtt %v)", s.client.AccountType, offset, s.threshold, rtt)
+		if s.onDrift != nil {
+			s.onDrift(DriftEvent{Offset: offset, RTT: rtt, Threshold: s.threshold, Time: time.Now()})
+		}
+	}
+	return nil
+}
+
+// Start syncs right away and then every interval until Stop is called
+func (s *TimeSync) Start() {
+	if !s.running.CompareAndSwap(false, true) {
+		return
+	}
+	go s.loop()
+}
+
+// Stop ends the sync loop, the last offset stays in use
+func (s *TimeSync) Stop() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *TimeSync) loop() {
+	s.syncOrLog()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.syncOrLog()
+		}
+	}
+}
+
+// syncOrLog keeps the last offset if the server can't be reached
+func (s *TimeSync) syncOrLog() {
+	if err := s.Sync(); err != nil {
+		log.Errorf("Failed to sync Binance %s time, keeping offset %v: %v", s.client.AccountType, s.Offset(), err)
+	}
+}
+
+// GetServerTime retrieves the server time in milliseconds
+func (c *BinanceClient) GetServerTime() (int64, error) {
+	resp, err := c.fetch(FetchRequest{
+		Method:   http.MethodGet,
+		Endpoint: BinanceTimeEndpoints[c.AccountType],
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get server time: %w", err)
+	}
+
+	var result struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return result.ServerTime, nil
+}
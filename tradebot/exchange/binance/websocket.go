@@ -3,6 +3,8 @@ package binance
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 	"tradebot_go/tradebot/base"
 	"tradebot_go/tradebot/core/messagebus"
@@ -10,41 +12,600 @@ import (
 	log "github.com/BitofferHub/pkg/middlewares/log"
 )
 
-// WSCliBinanceWSClientent represents a Binance WebSocket client
+// WSCliBinanceWSClientent represents a Binance WebSocket client.
+// Subscriptions are spread over a pool of connections (shards), a new shard is
+// opened whenever the existing ones reach the per-connection stream limit.
 type BinanceWSClient struct {
-	*base.WSClient
-	msgBus *messagebus.MessageBus
+	url        string
+	name       string
+	maxStreams int
+	msgRate    int
+	policy     base.ReconnectPolicy
+	rotate     time.Duration
+	overlap    time.Duration
+	ackTimeout time.Duration
+	msgBus     *messagebus.MessageBus
+	// market 本账户类型下 instrument 的市场类型
+	market base.MarketType
+
+	// dedup 丢弃连接轮换期间两条连接重复推送的消息
+	dedup *Deduper
+
+	// recorder 录制所有连接收到的原始帧，为 nil 时不录制
+	recorder *base.FrameRecorder
+
+	// depths 按 symbol 维护的本地订单簿，snapshotter 获取 REST 深度快照，
+	// rest 是默认的 snapshotter，Close 时关闭
+	snapshotter DepthSnapshotter
+	rest        *BinanceClient
+	depthMu     sync.Mutex
+	depths      map[string]*depthSync
+
+	// watchdog 检测单个 stream 的静默
+	watchdog        *base.StalenessWatchdog
+	staleThresholds map[string]time.Duration
+
+	// combined 为 true 时连接组合流端点，按 stream 名称路由消息
+	combined bool
+	handler  base.MessageHandler
+
+	// streams 按 stream 名称索引订阅，rawStreams 在非组合流模式下按连接、再按 "symbol@e" 索引。
+	// 单条流的帧不带 stream 名称，合约的 partial depth 与增量深度无法从内容区分，
+	// 所以 "symbol@e" 相同的 stream 放在不同的连接上
+	streamsMu  sync.RWMutex
+	streams    map[string]*streamEntry
+	rawStreams []map[string]*streamEntry
+
+	mu     sync.Mutex
+	ctx    context.Context
+	shards []*base.WSClient
+}
+
+// streamEntry is a subscribed stream and the shard carrying it
+type streamEntry struct {
+	name       string
+	rawKey     string
+	handler    base.MessageHandler
+	shard      *base.WSClient
+	shardIndex int
 }
 
 // NewBinanceWSClient creates a new BinanceWSClient
 func NewBinanceWSClient(accountType BinanceAccountType,
 	handler base.MessageHandler, msgBus *messagebus.MessageBus) (*BinanceWSClient, error) {
+	return NewBinanceWSClientWithConfig(accountType, nil, handler, msgBus)
+}
+
+// NewBinanceWSClientWithConfig creates a new BinanceWSClient, config picks the stream mode
+// and the per-connection limits
+func NewBinanceWSClientWithConfig(accountType BinanceAccountType, config *base.WSConfig,
+	handler base.MessageHandler, msgBus *messagebus.MessageBus) (*BinanceWSClient, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("message handler cannot be nil")
+	}
+	if config == nil {
+		config = &base.WSConfig{}
+	}
+
 	url := BinanceWebSocketURLs[accountType]
+	if config.CombinedStream {
+		url = BinanceCombinedStreamURLs[accountType]
+	}
+	if config.URL != "" {
+		url = config.URL
+	}
+	if url == "" {
+		return nil, fmt.Errorf("no websocket url for account type %s", accountType)
+	}
+
+	maxStreams := config.MaxStreamsPerConn
+	if maxStreams <= 0 {
+		maxStreams = BinanceMaxStreamsPerConn[accountType]
+	}
+	msgRate := config.MaxMessagesPerSecond
+	if msgRate <= 0 {
+		msgRate = BinanceMaxMessagesPerSecond[accountType]
+	}
+
+	policy := &base.ExponentialJitterPolicy{
+		BaseDelay:  config.ReconnectBaseDelay,
+		MaxDelay:   config.ReconnectMaxDelay,
+		MaxRetries: config.ReconnectMaxRetries,
+		Jitter:     0.2,
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = time.Second
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = time.Minute
+	}
 
-	wsClient, err := base.NewWSClient(url, handler)
+	rotate := config.RotateAfter
+	if rotate == 0 {
+		rotate = binanceRotateAfter
+	}
+
+	thresholds := make(map[string]time.Duration, len(defaultStaleThresholds))
+	for streamType, threshold := range defaultStaleThresholds {
+		thresholds[streamType] = threshold
+	}
+	for streamType, threshold := range config.StaleThresholds {
+		thresholds[streamType] = threshold
+	}
+
+	client := &BinanceWSClient{
+		url:             url,
+		name:            url,
+		maxStreams:      maxStreams,
+		msgRate:         msgRate,
+		policy:          policy,
+		rotate:          rotate,
+		overlap:         config.RotationOverlap,
+		ackTimeout:      config.AckTimeout,
+		msgBus:          msgBus,
+		market:          BinanceMarketTypes[accountType],
+		dedup:           NewDeduper(),
+		staleThresholds: thresholds,
+		combined:        config.CombinedStream,
+		handler:         handler,
+		ctx:             context.Background(),
+		streams:         make(map[string]*streamEntry),
+		rest:            NewBinancePublicClient(accountType),
+		depths:          make(map[string]*depthSync),
+	}
+	client.snapshotter = client.rest
+	client.watchdog = base.NewStalenessWatchdog(time.Second, client.handleStale)
+	return client, nil
+}
+
+// newShard opens another connection in the pool, must be called with c.mu held
+func (c *BinanceWSClient) newShard() (*base.WSClient, error) {
+	index := len(c.shards)
+	shard, err := base.NewWSClient(c.url, func(data []byte, event string, receivedAt time.Time) error {
+		return c.handleMessage(index, data, event, receivedAt)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create websocket client: %w", err)
 	}
+	shard.SetMessageRate(c.msgRate)
+	shard.SetReconnectPolicy(c.policy)
+	shard.SetMaxConnAge(c.rotate)
+	shard.SetRotationOverlap(c.overlap)
+	shard.SetAckTimeout(c.ackTimeout)
+	shard.SetName(fmt.Sprintf("%s#%d", c.name, len(c.shards)))
+	shard.SetStateHandler(c.handleState)
+	shard.SetRecorder(c.recorder)
+	c.shards = append(c.shards, shard)
+	c.streamsMu.Lock()
+	c.rawStreams = append(c.rawStreams, make(map[string]*streamEntry))
+	c.streamsMu.Unlock()
+	log.Infof("Opened websocket shard %d for %s", len(c.shards), c.url)
+	return shard, nil
+}
 
-	return &BinanceWSClient{
-		WSClient: wsClient,
-		msgBus:   msgBus,
-	}, nil
+// handleState publishes connection state transitions on the message bus, so that
+// strategies can e.g. pause quoting while a feed is down
+func (c *BinanceWSClient) handleState(event base.ConnectionStateEvent) {
+	if event.Err != nil {
+		log.Infof("Websocket %s is %s (attempt %d): %v", event.Conn, event.State, event.Attempt, event.Err)
+	} else {
+		log.Infof("Websocket %s is %s (attempt %d)", event.Conn, event.State, event.Attempt)
+	}
+	if c.msgBus != nil {
+		c.msgBus.Send("wsState", event)
+	}
+}
+
+// staleEscalateAfter 连续告警达到该次数后不再恢复，只发布 "staleEscalation" 等待人工处理
+const staleEscalateAfter = 16
+
+// staleAction is what handleStale does about one stale alert
+type staleAction int
+
+const (
+	staleIgnore staleAction = iota
+	staleResubscribe
+	staleRecycle
+	staleEscalate
+)
+
+// decideStale picks the action for the count-th consecutive alert of a stream whose
+// connection carries total watched streams, stale of them silent. 恢复只在第 1、2、4、8
+// 次告警时尝试 (按告警次数指数退避)；只有连接上多数 stream 都静默、即连接本身有问题时才
+// 回收连接，单个不活跃的 symbol 只会被重新订阅。
+func decideStale(count int, stale int, total int) staleAction {
+	switch {
+	case count == staleEscalateAfter:
+		return staleEscalate
+	case count > staleEscalateAfter || count&(count-1) != 0:
+		return staleIgnore
+	case count > 1 && stale*2 > total:
+		return staleRecycle
+	}
+	return staleResubscribe
+}
+
+// handleStale re-subscribes a silent stream, and recycles its connection if most
+// streams on it are silent too. Recovery backs off with the alert count and gives up
+// with a "staleEscalation" alert. Every alert is published so strategies can stop
+// trading on stale data.
+func (c *BinanceWSClient) handleStale(event base.StaleEvent) {
+	if c.msgBus != nil {
+		c.msgBus.Send("staleAlert", event)
+	}
+
+	c.streamsMu.RLock()
+	entry, ok := c.streams[event.Stream]
+	var total, stale int
+	if ok {
+		for name, other := range c.streams {
+			if other.shard != entry.shard {
+				continue
+			}
+			total++
+			if c.watchdog.Silent(name) {
+				stale++
+			}
+		}
+	}
+	c.streamsMu.RUnlock()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	ctx := c.ctx
+	c.mu.Unlock()
+	shard := entry.shard
+
+	switch decideStale(event.Count, stale, total) {
+	case staleResubscribe:
+		go func() {
+			log.Infof("Re-subscribing silent stream %s", event.Stream)
+			if err := shard.Unsubscribe(ctx, event.Stream); err != nil {
+				log.Errorf("Failed to unsubscribe silent stream %s: %v", event.Stream, err)
+			}
+			if err := shard.Subscribe(ctx, event.Stream); err != nil {
+				log.Errorf("Failed to re-subscribe silent stream %s: %v", event.Stream, err)
+			}
+		}()
+	case staleRecycle:
+		// 多数 stream 都静默，回收整个连接，读循环会触发重连并重新订阅
+		log.Errorf("Stream %s and %d of %d streams on its connection silent, recycling it", event.Stream, stale, total)
+		if err := shard.CloseConnection(); err != nil {
+			log.Errorf("Failed to recycle connection: %v", err)
+		}
+	case staleEscalate:
+		log.Errorf("Stream %s still silent after %d alerts, giving up recovery", event.Stream, event.Count)
+		if c.msgBus != nil {
+			c.msgBus.Send("staleEscalation", event)
+		}
+	}
+}
+
+// staleThreshold looks up the threshold of a stream by its type, "btcusdt@depth@100ms" → "depth@100ms", then "depth"
+func (c *BinanceWSClient) staleThreshold(stream string) time.Duration {
+	streamType := stream[strings.IndexByte(stream, '@')+1:]
+	if threshold, ok := c.staleThresholds[streamType]; ok {
+		return threshold
+	}
+	if i := strings.IndexAny(streamType, "@_"); i > 0 {
+		if threshold, ok := c.staleThresholds[streamType[:i]]; ok {
+			return threshold
+		}
+	}
+	return c.staleThresholds["default"]
+}
+
+// lookupStream finds a subscribed stream by name
+func (c *BinanceWSClient) lookupStream(name []byte) *streamEntry {
+	c.streamsMu.RLock()
+	defer c.streamsMu.RUnlock()
+	return c.streams[string(name)]
+}
+
+// lookupRawStream finds the stream of a raw mode message received on shard through its
+// symbol and event type, shard < 0 searches every shard
+func (c *BinanceWSClient) lookupRawStream(shard int, meta *frameMeta) *streamEntry {
+	var buf [64]byte
+	key := meta.rawKey(buf[:0])
+
+	c.streamsMu.RLock()
+	defer c.streamsMu.RUnlock()
+	if shard >= 0 {
+		if shard >= len(c.rawStreams) {
+			return nil
+		}
+		return c.rawStreams[shard][string(key)]
+	}
+	for _, streams := range c.rawStreams {
+		if entry, ok := streams[string(key)]; ok {
+			return entry
+		}
+	}
+	return nil
+}
+
+// SetReconnectPolicy replaces the reconnect policy of every current and future shard
+func (c *BinanceWSClient) SetReconnectPolicy(policy base.ReconnectPolicy) {
+	if policy == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.policy = policy
+	for _, shard := range c.shards {
+		shard.SetReconnectPolicy(policy)
+	}
+}
+
+// SetName names the client in logs, state events and recorded frames, defaults to the url
+func (c *BinanceWSClient) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// SetRecorder records the raw frames of every connection, call it before Connect
+func (c *BinanceWSClient) SetRecorder(recorder *base.FrameRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recorder = recorder
+	for _, shard := range c.shards {
+		shard.SetRecorder(recorder)
+	}
+}
+
+// Replay feeds recorded frames through the same handling as frames read from the
+// connections. The client must use the stream mode (raw or combined) of the recording;
+// raw mode frames are routed to the first shard's stream with their "symbol@e".
+func (c *BinanceWSClient) Replay(ctx context.Context, reader *base.FrameReader, replayer *base.Replayer) (int, error) {
+	client, err := base.NewWSClient(c.url, func(data []byte, event string, receivedAt time.Time) error {
+		return c.handleMessage(-1, data, event, receivedAt)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create replay client: %w", err)
+	}
+	client.SetName(c.name)
+	return replayer.Replay(ctx, reader, client)
+}
+
+// pickShard returns the first shard with room for another stream, in raw mode also
+// without another stream of the same rawKey. Must be called with c.mu held.
+func (c *BinanceWSClient) pickShard(rawKey string) (*base.WSClient, int, error) {
+	c.streamsMu.RLock()
+	for i, shard := range c.shards {
+		if c.maxStreams > 0 && shard.StreamCount() >= c.maxStreams {
+			continue
+		}
+		if _, taken := c.rawStreams[i][rawKey]; !c.combined && taken {
+			continue
+		}
+		c.streamsMu.RUnlock()
+		return shard, i, nil
+	}
+	c.streamsMu.RUnlock()
+	shard, err := c.newShard()
+	return shard, len(c.shards) - 1, err
+}
+
+// Connect connects every shard of the pool, opening the first one if needed
+func (c *BinanceWSClient) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ctx = ctx
+	c.watchdog.Start()
+	if len(c.shards) == 0 {
+		if _, err := c.newShard(); err != nil {
+			return err
+		}
+	}
+	for i, shard := range c.shards {
+		if err := shard.Connect(ctx); err != nil {
+			return fmt.Errorf("failed to connect shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// IsConnected reports whether every shard is connected
+func (c *BinanceWSClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.shards) == 0 {
+		return false
+	}
+	for _, shard := range c.shards {
+		if !shard.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes every shard of the pool
+func (c *BinanceWSClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.watchdog.Stop()
+	c.depthMu.Lock()
+	for _, depth := range c.depths {
+		depth.close()
+	}
+	c.depthMu.Unlock()
+
+	var firstErr error
+	for _, shard := range c.shards {
+		if err := shard.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := c.rest.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// ShardCount returns the number of connections in the pool
+func (c *BinanceWSClient) ShardCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.shards)
+}
+
+// handleMessage unwraps combined stream envelopes and routes them by stream name, raw
+// mode messages by the shard they arrived on and their "symbol@e". Unknown streams
+// go to the default handler.
+func (c *BinanceWSClient) handleMessage(shard int, data []byte, event string, receivedAt time.Time) error {
+	if c.combined && event == "" {
+		var stream, payload []byte
+		base.ObjectEach(data, func(key, value []byte) bool {
+			switch string(key) {
+			case "stream":
+				stream = value
+			case "data":
+				payload = value
+			}
+			return true
+		})
+		if stream != nil && payload != nil {
+			meta := peekFrame(payload, "")
+			return c.dispatch(c.lookupStream(stream), payload, &meta, receivedAt)
+		}
+	}
+
+	meta := peekFrame(data, event)
+	return c.dispatch(c.lookupRawStream(shard, &meta), data, &meta, receivedAt)
+}
+
+// dispatch delivers a message to its stream's handler, or the default handler
+func (c *BinanceWSClient) dispatch(entry *streamEntry, data []byte, meta *frameMeta, receivedAt time.Time) error {
+	name := ""
+	handler := c.handler
+	if entry != nil {
+		name = entry.name
+		c.watchdog.Touch(name)
+		if entry.handler != nil {
+			handler = entry.handler
+		}
+	}
+	if c.dedup.Duplicate(name, meta) {
+		return nil
+	}
+	return handler(data, meta.event, receivedAt)
 }
 
 // Subscribe subscribes to a market data stream
 func (c *BinanceWSClient) Subscribe(symbol string, streams string) error {
-	c.Connect(context.Background())
-	subId := fmt.Sprintf("%s@%s", symbol, streams)
-	c.SubscribedStreams = append(c.SubscribedStreams, subId)
-	msg := base.SubscribeMsg{
-		Method: "SUBSCRIBE",
-		Params: []string{subId},
-		ID:     time.Now().UnixNano(),
+	return c.SubscribeWithHandler(symbol, streams, nil)
+}
+
+// SubscribeWithHandler subscribes to a market data stream, in combined mode the
+// stream's messages are delivered to handler instead of the default handler
+func (c *BinanceWSClient) SubscribeWithHandler(symbol string, streams string, handler base.MessageHandler) error {
+	subId := streamName(symbol, streams)
+	entry, shard, ctx, err := c.reserveStream(subId, rawStreamKey(symbol, streams), handler)
+	if err != nil || entry == nil {
+		return err
 	}
 
-	log.Infof("Subscribing to %s@%s", symbol, streams)
-	return c.WriteJSON(msg)
+	// 等待确认时不持有 c.mu，handleStale 与其它订阅不会被阻塞到确认超时
+	log.Infof("Subscribing to %s", subId)
+	if _, err := shard.Request(ctx, "SUBSCRIBE", []string{subId}); err != nil {
+		c.releaseStream(entry)
+		return fmt.Errorf("failed to subscribe to %s: %w", subId, err)
+	}
+	c.watchdog.Track(subId, c.staleThreshold(subId))
+	return nil
+}
+
+// reserveStream registers the stream on a connected shard before it is subscribed, so
+// that concurrent subscriptions see the shard's capacity taken. It returns a nil entry
+// if the stream is already subscribed, only its handler is replaced then.
+func (c *BinanceWSClient) reserveStream(subId string, rawKey string, handler base.MessageHandler) (*streamEntry, *base.WSClient, context.Context, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.streamsMu.Lock()
+	entry, ok := c.streams[subId]
+	if ok {
+		entry.handler = handler
+	}
+	c.streamsMu.Unlock()
+	if ok {
+		return nil, nil, nil, nil
+	}
+
+	shard, index, err := c.pickShard(rawKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := shard.Connect(c.ctx); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect shard: %w", err)
+	}
+
+	entry = &streamEntry{
+		name:       subId,
+		rawKey:     rawKey,
+		handler:    handler,
+		shard:      shard,
+		shardIndex: index,
+	}
+	c.streamsMu.Lock()
+	c.streams[subId] = entry
+	c.rawStreams[index][rawKey] = entry
+	c.streamsMu.Unlock()
+	// 确认前就加入重订阅集合，确认期间重连也会订阅它
+	shard.AddStream(subId)
+	return entry, shard, c.ctx, nil
+}
+
+// releaseStream rolls back a reservation whose subscription failed, unless the
+// stream was unsubscribed in the meantime
+func (c *BinanceWSClient) releaseStream(entry *streamEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if c.streams[entry.name] != entry {
+		return
+	}
+	delete(c.streams, entry.name)
+	if c.rawStreams[entry.shardIndex][entry.rawKey] == entry {
+		delete(c.rawStreams[entry.shardIndex], entry.rawKey)
+	}
+	entry.shard.RemoveStream(entry.name)
+}
+
+// Unsubscribe unsubscribes from a market data stream
+func (c *BinanceWSClient) Unsubscribe(symbol string, streams string) error {
+	subId := streamName(symbol, streams)
+	c.mu.Lock()
+	c.streamsMu.Lock()
+	entry, ok := c.streams[subId]
+	if ok {
+		delete(c.streams, subId)
+		delete(c.rawStreams[entry.shardIndex], entry.rawKey)
+	}
+	c.streamsMu.Unlock()
+	ctx := c.ctx
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	c.watchdog.Untrack(subId)
+
+	log.Infof("Unsubscribing from %s", subId)
+	if err := entry.shard.Unsubscribe(ctx, subId); err != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %w", subId, err)
+	}
+	return nil
 }
 
 func (c *BinanceWSClient) SubscribeTrade(symbol string) error {
@@ -54,3 +615,209 @@ func (c *BinanceWSClient) SubscribeTrade(symbol string) error {
 func (c *BinanceWSClient) SubscribeBookL1(symbol string) error {
 	return c.Subscribe(symbol, "bookTicker")
 }
+
+func (c *BinanceWSClient) SubscribeAggTrade(symbol string) error {
+	return c.Subscribe(symbol, "aggTrade")
+}
+
+// SubscribeMarkPrice subscribes to the futures mark price stream of symbol, speed is
+// "1s" or empty for the 3s default
+func (c *BinanceWSClient) SubscribeMarkPrice(symbol string, speed string) error {
+	return c.Subscribe(symbol, markPriceStream(speed))
+}
+
+// SubscribeLiquidation subscribes to the liquidation orders of symbol
+func (c *BinanceWSClient) SubscribeLiquidation(symbol string) error {
+	return c.Subscribe(symbol, "forceOrder")
+}
+
+// SubscribeAllLiquidations subscribes to the liquidation orders of every symbol
+func (c *BinanceWSClient) SubscribeAllLiquidations() error {
+	return c.Subscribe("", allLiquidationsStream)
+}
+
+// SubscribeTicker subscribes to the 24h ticker of symbol, or of every symbol if symbol is empty
+func (c *BinanceWSClient) SubscribeTicker(symbol string) error {
+	return c.Subscribe(symbol, tickerStream(symbol, "ticker"))
+}
+
+// SubscribeMiniTicker subscribes to the 24h mini ticker of symbol, or of every symbol
+// if symbol is empty
+func (c *BinanceWSClient) SubscribeMiniTicker(symbol string) error {
+	return c.Subscribe(symbol, tickerStream(symbol, "miniTicker"))
+}
+
+// SubscribeKline subscribes to the kline stream of symbol, interval is one of Binance's
+// kline intervals ("1m", "5m", "1h", ...)
+func (c *BinanceWSClient) SubscribeKline(symbol string, interval string) error {
+	return c.Subscribe(symbol, klineStream(interval))
+}
+
+// UnsubscribeKline unsubscribes from the kline stream of symbol
+func (c *BinanceWSClient) UnsubscribeKline(symbol string, interval string) error {
+	return c.Unsubscribe(symbol, klineStream(interval))
+}
+
+// SetDepthSnapshotter replaces the REST client order book snapshots are fetched with
+func (c *BinanceWSClient) SetDepthSnapshotter(snapshotter DepthSnapshotter) {
+	c.depthMu.Lock()
+	defer c.depthMu.Unlock()
+	c.snapshotter = snapshotter
+}
+
+// SubscribeDepth subscribes to the diff depth stream of symbol and maintains a local
+// order book from it. Every change is published as a base.OrderBookDelta on
+// "orderBookDelta", then the best levels as "orderBook".
+// speed is the update interval ("100ms", "500ms", ...), empty for the exchange default.
+func (c *BinanceWSClient) SubscribeDepth(symbol string, speed string) error {
+	stream := depthStream(speed)
+	key := streamName(symbol, stream)
+
+	c.mu.Lock()
+	ctx := c.ctx
+	c.mu.Unlock()
+
+	c.depthMu.Lock()
+	depth, ok := c.depths[key]
+	if !ok {
+		depth = newDepthSync(ctx, strings.ToUpper(symbol), c.market, c.snapshotter, c.publishBook, c.publishDelta)
+		c.depths[key] = depth
+	}
+	c.depthMu.Unlock()
+
+	handler := func(data []byte, event string, receivedAt time.Time) error {
+		// 等待快照期间事件会被缓存，每个事件单独分配
+		update := new(DepthUpdate)
+		if err := DecodeDepthUpdate(data, update); err != nil {
+			return err
+		}
+		update.ReceivedAt = receivedAt
+		depth.handle(update)
+		return nil
+	}
+	if err := c.SubscribeWithHandler(symbol, stream, handler); err != nil {
+		c.depthMu.Lock()
+		depth.close()
+		delete(c.depths, key)
+		c.depthMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// UnsubscribeDepth unsubscribes from the diff depth stream and drops the local order book
+func (c *BinanceWSClient) UnsubscribeDepth(symbol string, speed string) error {
+	stream := depthStream(speed)
+	key := streamName(symbol, stream)
+
+	c.depthMu.Lock()
+	if depth, ok := c.depths[key]; ok {
+		depth.close()
+		delete(c.depths, key)
+	}
+	c.depthMu.Unlock()
+	return c.Unsubscribe(symbol, stream)
+}
+
+// OrderBook returns the local order book of symbol, nil if its depth is not subscribed
+func (c *BinanceWSClient) OrderBook(symbol string, speed string) *base.OrderBook {
+	c.depthMu.Lock()
+	defer c.depthMu.Unlock()
+	if depth, ok := c.depths[streamName(symbol, depthStream(speed))]; ok {
+		return depth.book
+	}
+	return nil
+}
+
+func (c *BinanceWSClient) publishBook(view *base.OrderBookView) {
+	if c.msgBus != nil {
+		c.msgBus.Send("orderBook", view)
+	}
+}
+
+func (c *BinanceWSClient) publishDelta(delta *base.OrderBookDelta) {
+	if c.msgBus != nil {
+		c.msgBus.Send("orderBookDelta", delta)
+	}
+}
+
+// allLiquidationsStream is the all-market liquidation stream, it has no symbol
+const allLiquidationsStream = "!forceOrder@arr"
+
+// tickerStream returns the per-symbol ticker stream, or the all-market one ("!ticker@arr")
+// if symbol is empty
+func tickerStream(symbol string, stream string) string {
+	if symbol == "" {
+		return "!" + stream + "@arr"
+	}
+	return stream
+}
+
+func markPriceStream(speed string) string {
+	if speed == "" {
+		return "markPrice"
+	}
+	return "markPrice@" + speed
+}
+
+func klineStream(interval string) string {
+	return "kline_" + interval
+}
+
+func depthStream(speed string) string {
+	if speed == "" {
+		return "depth"
+	}
+	return "depth@" + speed
+}
+
+// binanceRotateAfter replaces connections well before Binance drops them at 24 hours
+const binanceRotateAfter = 23 * time.Hour
+
+// defaultStaleThresholds only watches the streams that are expected to tick continuously
+var defaultStaleThresholds = map[string]time.Duration{
+	"bookTicker": time.Minute,
+	"depth":      time.Minute,
+	"markPrice":  time.Minute,
+}
+
+// streamEvents maps stream types to the "e" field of their messages
+var streamEvents = map[string]string{
+	"trade":       "trade",
+	"bookTicker":  "bookTicker",
+	"depth":       "depthUpdate",
+	"depth5":      "depthUpdate",
+	"depth10":     "depthUpdate",
+	"depth20":     "depthUpdate",
+	"markPrice":   "markPriceUpdate",
+	"ticker":      "24hrTicker",
+	"!ticker":     "24hrTicker",
+	"miniTicker":  "24hrMiniTicker",
+	"!miniTicker": "24hrMiniTicker",
+}
+
+// rawStreamKey is the "symbol@e" key raw mode messages of a stream are recognised by,
+// klines keep their interval ("symbol@kline_1m") as frameMeta.rawKey does
+func rawStreamKey(symbol string, stream string) string {
+	streamType := stream
+	if i := strings.IndexAny(stream, "@_"); i > 0 {
+		streamType = stream[:i]
+	}
+	event, ok := streamEvents[streamType]
+	if !ok {
+		event = streamType
+	}
+	if streamType == "kline" {
+		event, _, _ = strings.Cut(stream, "@")
+	}
+	return strings.ToLower(symbol) + "@" + event
+}
+
+// streamName builds the stream name, Binance only accepts lowercase symbols. All-market
+// streams ("!forceOrder@arr", ...) have no symbol.
+func streamName(symbol string, stream string) string {
+	if symbol == "" {
+		return stream
+	}
+	return fmt.Sprintf("%s@%s", strings.ToLower(symbol), stream)
+}
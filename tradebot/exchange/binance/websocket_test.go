@@ -0,0 +1,895 @@
+package binance_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"tradebot_go/tradebot/base"
+	"tradebot_go/tradebot/core/messagebus"
+	"tradebot_go/tradebot/exchange/binance"
+	"tradebot_go/tradebot/exchange/binance/binancetest"
+
+	log "github.com/BitofferHub/pkg/middlewares/log"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestMain(m *testing.M) {
+	logPath, err := os.MkdirTemp("", "binance-test-log")
+	if err != nil {
+		panic(err)
+	}
+	log.Init(log.WithLogPath(logPath), log.WithConsole(false))
+	code := m.Run()
+	os.RemoveAll(logPath)
+	os.Exit(code)
+}
+
+// collector receives decoded trades from a BinanceWSClient
+type collector struct {
+	trades chan binance.Trade
+}
+
+func newCollector() *collector {
+	return &collector{trades: make(chan binance.Trade, 16)}
+}
+
+func (c *collector) handle(data []byte, event string, receivedAt time.Time) error {
+	if event != "trade" {
+		return nil
+	}
+	var trade binance.Trade
+	if err := binance.DecodeTrade(data, &trade); err != nil {
+		return err
+	}
+	c.trades <- trade
+	return nil
+}
+
+func (c *collector) expect(t *testing.T, tradeID int64) {
+	t.Helper()
+	select {
+	case trade := <-c.trades:
+		if trade.TradeID != tradeID {
+			t.Fatalf("got trade %d, want %d", trade.TradeID, tradeID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("trade %d not received", tradeID)
+	}
+}
+
+func newClient(t *testing.T, config *base.WSConfig, c *collector) *binance.BinanceWSClient {
+	t.Helper()
+	client, err := binance.NewBinanceWSClientWithConfig(binance.BinanceAccountTypeUsdMFuturesTestnet, config, c.handle, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeTrade(t *testing.T) {
+	for _, combined := range []bool{false, true} {
+		server := binancetest.NewServer(0)
+		c := newCollector()
+		client := newClient(t, server.Config(combined), c)
+
+		if err := client.SubscribeTrade("BTCUSDT"); err != nil {
+			t.Fatalf("combined=%v: %v", combined, err)
+		}
+		if got := server.Subscriptions(); len(got) != 1 || got[0] != "btcusdt@trade" {
+			t.Fatalf("combined=%v: subscriptions = %v", combined, got)
+		}
+		if n := server.SendTrade("BTCUSDT", 1, "97000.10", "0.5"); n != 1 {
+			t.Fatalf("combined=%v: trade sent to %d connections", combined, n)
+		}
+		c.expect(t, 1)
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestReconnectResubscribes(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	c := newCollector()
+	client := newClient(t, server.Config(true), c)
+
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+	server.DropConnections()
+
+	waitFor(t, "reconnect", func() bool {
+		return server.ConnectCount() == 2 && len(server.Subscriptions()) == 1
+	})
+	server.SendTrade("btcusdt", 2, "97000.10", "0.5")
+	c.expect(t, 2)
+}
+
+func TestSubscribeRejected(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	client := newClient(t, server.Config(false), newCollector())
+
+	server.RejectRequests(&base.WSError{Code: 2, Msg: "Invalid request"})
+	var wsErr *base.WSError
+	if err := client.SubscribeTrade("btcusdt"); !errors.As(err, &wsErr) || wsErr.Code != 2 {
+		t.Fatalf("expected the rejection, got %v", err)
+	}
+
+	// 被拒绝的订阅不会记录，重试时重新发送
+	server.RejectRequests(nil)
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelayedAckTimesOut(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	config := server.Config(false)
+	config.AckTimeout = 50 * time.Millisecond
+	client := newClient(t, config, newCollector())
+
+	server.SetAckDelay(200 * time.Millisecond)
+	if err := client.SubscribeTrade("btcusdt"); err == nil {
+		t.Fatal("expected ack timeout")
+	}
+
+	server.SetAckDelay(20 * time.Millisecond)
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMalformedFrameIgnored(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	c := newCollector()
+	client := newClient(t, server.Config(true), c)
+
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+	server.SendRaw([]byte(`{"stream":"btcusdt@trade","data":{"e":"trade",`))
+	server.SendTrade("btcusdt", 3, "97000.10", "0.5")
+	c.expect(t, 3)
+	if server.ConnectCount() != 1 {
+		t.Fatalf("malformed frame caused a reconnect")
+	}
+}
+
+func TestServerPing(t *testing.T) {
+	server := binancetest.NewServer(20 * time.Millisecond)
+	defer server.Close()
+	newClient(t, server.Config(false), newCollector())
+
+	waitFor(t, "pong", func() bool { return server.PongCount() > 0 })
+}
+
+func TestStalledStreamAlerts(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+
+	alerts := make(chan base.StaleEvent, 4)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("staleAlert", func(msg interface{}) {
+		alerts <- msg.(base.StaleEvent)
+	})
+
+	config := server.Config(false)
+	config.StaleThresholds = map[string]time.Duration{"trade": 100 * time.Millisecond}
+	client, err := binance.NewBinanceWSClientWithConfig(binance.BinanceAccountTypeUsdMFuturesTestnet, config, newCollector().handle, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Stall()
+	defer server.Resume()
+	select {
+	case event := <-alerts:
+		if event.Stream != "btcusdt@trade" {
+			t.Fatalf("alert for %s", event.Stream)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no stale alert")
+	}
+}
+
+func TestConnectorOverrideURLs(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	trades := make(chan base.TradeTick, 1)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("trade", func(msg interface{}) {
+		trades <- *msg.(*base.TradeTick)
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SendTrade("btcusdt", 4, "97000.10", "0.5")
+	select {
+	case tick := <-trades:
+		want := base.InstrumentID{Exchange: "binance", Symbol: "BTCUSDT", Market: base.MarketTypeLinear}
+		if tick.Instrument != want || tick.TradeID != "4" || tick.Price.String() != "97000.1" || tick.LocalTime.IsZero() {
+			t.Fatalf("unexpected trade %+v", tick)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("trade not published")
+	}
+}
+
+func TestDepthSync(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	client := newClient(t, server.Config(true), newCollector())
+	client.SetDepthSnapshotter(&binance.BinanceClient{
+		Client:      base.NewClient("", "", server.HTTPURL()),
+		AccountType: binance.BinanceAccountTypeUsdMFuturesTestnet,
+	})
+
+	server.SetDepthSnapshot("btcusdt", 100, [][2]string{{"100", "1"}, {"99", "2"}}, [][2]string{{"101", "1"}})
+	if err := client.SubscribeDepth("btcusdt", "100ms"); err != nil {
+		t.Fatal(err)
+	}
+	book := client.OrderBook("btcusdt", "100ms")
+
+	// 早于快照的事件被丢弃，跨过快照的事件作为第一个事件应用
+	server.SendDepthUpdate("btcusdt", "100ms", 90, 95, 89, [][2]string{{"98", "5"}}, nil)
+	server.SendDepthUpdate("btcusdt", "100ms", 96, 101, 95, nil, [][2]string{{"102", "3"}})
+	waitFor(t, "snapshot sync", func() bool { return book.UpdateID() == 101 })
+
+	server.SendDepthUpdate("btcusdt", "100ms", 102, 103, 101, [][2]string{{"100", "0"}}, nil)
+	waitFor(t, "update", func() bool { return book.UpdateID() == 103 })
+	depth := book.Depth(0)
+	if len(depth.Bids) != 1 || depth.Bids[0].Price.String() != "99" || len(depth.Asks) != 2 {
+		t.Fatalf("unexpected book %+v", depth)
+	}
+
+	// pu 不连续时重新获取快照
+	server.SetDepthSnapshot("btcusdt", 300, [][2]string{{"97", "4"}}, [][2]string{{"103", "2"}})
+	server.SendDepthUpdate("btcusdt", "100ms", 290, 305, 280, nil, nil)
+	waitFor(t, "resync", func() bool { return book.UpdateID() == 305 })
+	if bid, ok := book.BestBid(); !ok || bid.Price.String() != "97" {
+		t.Fatalf("best bid after resync = %v", bid)
+	}
+}
+
+func TestConnectorBookDepth(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	depths := make(chan base.OrderBookDelta, 1)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("bookDepth", func(msg interface{}) {
+		depths <- *msg.(*base.OrderBookDelta)
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeBookDepth("btcusdt", 7, ""); err == nil {
+		t.Fatal("expected an error for 7 levels")
+	}
+	if err := connector.SubscribeBookDepth("btcusdt", 5, "100ms"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SendEvent("btcusdt@depth5@100ms", map[string]interface{}{
+		"e": "depthUpdate", "E": time.Now().UnixMilli(), "s": "BTCUSDT",
+		"U": 10, "u": 12, "pu": 9,
+		"b": [][2]string{{"97000.1", "1.5"}},
+		"a": [][2]string{{"97000.2", "0.3"}},
+	})
+	select {
+	case depth := <-depths:
+		if depth.Instrument.Symbol != "BTCUSDT" || !depth.Snapshot || depth.FinalUpdateID != 12 || len(depth.Bids) != 1 || depth.Bids[0].Quantity.String() != "1.5" {
+			t.Fatalf("unexpected depth %+v", depth)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("book depth not published")
+	}
+}
+
+func TestConnectorBars(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	bars := make(chan base.Bar, 4)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("bar", func(msg interface{}) {
+		bars <- *msg.(*base.Bar)
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeBars("btcusdt", base.VolumeBars(decimal.NewFromInt(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SendTrade("btcusdt", 1, "100", "0.4")
+	server.SendTrade("btcusdt", 2, "102", "0.4")
+	server.SendTrade("btcusdt", 3, "99", "0.5")
+
+	// 成交量 bar 在第三笔成交时收盘
+	select {
+	case bar := <-bars:
+		if bar.Trades != 3 || !bar.Open.Equal(decimal.NewFromInt(100)) || !bar.High.Equal(decimal.NewFromInt(102)) ||
+			!bar.Low.Equal(decimal.NewFromInt(99)) || !bar.Volume.Equal(decimal.RequireFromString("1.3")) {
+			t.Fatalf("unexpected bar %+v", bar)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bar not published")
+	}
+}
+
+func TestConnectorAggTradeBackfill(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	// 历史成交从第二个时间窗口开始，跨越多页
+	start := time.Now().Add(-3 * time.Hour)
+	first := start.Add(90 * time.Minute).UnixMilli()
+	history := make([]binance.AggTrade, 2500)
+	for i := range history {
+		id := int64(i + 1)
+		history[i] = binance.AggTrade{AggTradeID: id, Price: decimal.RequireFromString("97000.1"), Quantity: decimal.RequireFromString("0.1"), FirstTradeID: id, LastTradeID: id, TradeTime: first + id}
+	}
+	server.SetAggTrades("btcusdt", history)
+
+	ids := make(chan string, 4096)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("aggTrade", func(msg interface{}) {
+		ids <- msg.(*base.TradeTick).TradeID
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeAggTradeFrom("btcusdt", start); err != nil {
+		t.Fatal(err)
+	}
+
+	// 最后一笔历史成交在实时流上重复出现时被丢弃
+	server.SendAggTrade("btcusdt", 2500, "97000.1", "0.1")
+	server.SendAggTrade("btcusdt", 2501, "97000.2", "0.1")
+	for want := int64(1); want <= 2501; want++ {
+		select {
+		case id := <-ids:
+			if id != strconv.FormatInt(want, 10) {
+				t.Fatalf("got aggTrade %s, want %d", id, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("aggTrade %d not published", want)
+		}
+	}
+}
+
+func TestConnectorAllLiquidations(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	symbols := make(chan string, 4)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("liquidation", func(msg interface{}) {
+		symbols <- msg.(*base.Liquidation).Instrument.Symbol
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeAllLiquidations(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Subscriptions(); len(got) != 1 || got[0] != "!forceOrder@arr" {
+		t.Fatalf("subscriptions = %v", got)
+	}
+
+	// 同一时刻不同 symbol 的强平都要送达
+	now := time.Now().UnixMilli()
+	for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+		server.SendEvent("!forceOrder@arr", map[string]interface{}{
+			"e": "forceOrder",
+			"E": now,
+			"o": map[string]interface{}{
+				"s": symbol, "S": "BUY", "o": "LIMIT", "f": "IOC", "q": "1", "p": "100",
+				"ap": "100", "X": "FILLED", "l": "1", "z": "1", "T": now,
+			},
+		})
+	}
+	for _, want := range []string{"BTCUSDT", "ETHUSDT"} {
+		select {
+		case symbol := <-symbols:
+			if symbol != want {
+				t.Fatalf("got liquidation of %s, want %s", symbol, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("liquidation of %s not published", want)
+		}
+	}
+}
+
+func TestConnectorAllMiniTickers(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	batches := make(chan []string, 1)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("miniTicker", func(msg interface{}) {
+		var symbols []string
+		for _, ticker := range msg.(*base.TickerBatch).Tickers {
+			symbols = append(symbols, ticker.Instrument.Symbol)
+		}
+		batches <- symbols
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeMiniTicker(""); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixMilli()
+	var tickers []map[string]interface{}
+	for _, symbol := range []string{"BTCUSDT", "ETHUSDT", "BNBUSDT"} {
+		tickers = append(tickers, map[string]interface{}{
+			"e": "24hrMiniTicker", "E": now, "s": symbol,
+			"c": "100", "o": "99", "h": "101", "l": "98", "v": "10", "q": "1000",
+		})
+	}
+	server.SendEvent("!miniTicker@arr", tickers)
+	select {
+	case symbols := <-batches:
+		if len(symbols) != 3 || symbols[2] != "BNBUSDT" {
+			t.Fatalf("got batch %v", symbols)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mini ticker batch not published")
+	}
+}
+
+func TestConnectorTradeGapBackfill(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	history := make([]binance.HistoricalTrade, 10)
+	for i := range history {
+		history[i] = binance.HistoricalTrade{ID: int64(i + 1), Price: decimal.RequireFromString("97000.1"), Qty: decimal.RequireFromString("0.1"), Time: time.Now().UnixMilli()}
+	}
+	server.SetHistoricalTrades("btcusdt", history)
+
+	ids := make(chan string, 16)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("trade", func(msg interface{}) {
+		ids <- msg.(*base.TradeTick).TradeID
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// historicalTrades 需要 API key
+	keyed := binance.NewBinanceClient(&base.Config{BinanceFutureTestnet: base.ExchangeConfig{APIKey: "key", SecretKey: "secret"}}, binance.BinanceAccountTypeUsdMFuturesTestnet)
+	defer keyed.Close()
+	connector.SetTradeFetcher(keyed)
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3-5 缺失，由 REST 补齐后才发布 6；之后迟到的 4 被丢弃
+	for _, id := range []int64{1, 2, 6, 4, 7} {
+		server.SendTrade("btcusdt", id, "97000.1", "0.1")
+	}
+	for want := int64(1); want <= 7; want++ {
+		select {
+		case id := <-ids:
+			if id != strconv.FormatInt(want, 10) {
+				t.Fatalf("got trade %s, want %d", id, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("trade %d not published", want)
+		}
+	}
+
+	stats := connector.TradeGapStats()["BTCUSDT"]
+	want := binance.GapStats{Gaps: 1, Missing: 3, Backfilled: 3, OutOfOrder: 1}
+	if stats != want {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestRawKlineIntervals(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	client := newClient(t, server.Config(false), newCollector())
+
+	klines := make(chan string, 4)
+	handler := func(stream string) base.MessageHandler {
+		return func(data []byte, event string, receivedAt time.Time) error {
+			var kline binance.Kline
+			if err := binance.DecodeKline(data, &kline); err != nil {
+				return err
+			}
+			klines <- stream + " " + kline.Interval
+			return nil
+		}
+	}
+	for _, interval := range []string{"1m", "5m"} {
+		if err := client.SubscribeWithHandler("btcusdt", "kline_"+interval, handler(interval)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 两个周期的事件时间相同，都必须送达各自的 handler
+	eventTime := time.Now().UnixMilli()
+	sendKline := func(interval string, trades int) {
+		server.SendEvent("btcusdt@kline_"+interval, map[string]interface{}{
+			"e": "kline", "E": eventTime, "s": "BTCUSDT",
+			"k": map[string]interface{}{
+				"t": 1700000000000, "T": 1700000059999, "s": "BTCUSDT", "i": interval,
+				"o": "100", "c": "101", "h": "102", "l": "99", "v": "1", "n": trades, "x": false,
+			},
+		})
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-klines:
+			if got != want {
+				t.Fatalf("got kline %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("kline %q not received", want)
+		}
+	}
+	sendKline("1m", 3)
+	expect("1m 1m")
+	sendKline("5m", 3)
+	expect("5m 5m")
+
+	// 取消一个周期不影响另一个的路由
+	if err := client.UnsubscribeKline("btcusdt", "1m"); err != nil {
+		t.Fatal(err)
+	}
+	eventTime++
+	sendKline("5m", 4)
+	expect("5m 5m")
+}
+
+func TestRawPartialAndDiffDepth(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	client := newClient(t, server.Config(false), newCollector())
+
+	got := make(chan string, 4)
+	handler := func(name string) base.MessageHandler {
+		return func(data []byte, event string, receivedAt time.Time) error {
+			got <- name
+			return nil
+		}
+	}
+	if err := client.SubscribeWithHandler("btcusdt", "depth5@100ms", handler("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubscribeWithHandler("btcusdt", "depth@100ms", handler("diff")); err != nil {
+		t.Fatal(err)
+	}
+	// 两者的帧内容无法区分，分在两条连接上
+	if n := client.ShardCount(); n != 2 {
+		t.Fatalf("shards = %d", n)
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case name := <-got:
+			if name != want {
+				t.Fatalf("got %s, want %s", name, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not received", want)
+		}
+	}
+	server.SendEvent("btcusdt@depth5@100ms", map[string]interface{}{
+		"e": "depthUpdate", "E": time.Now().UnixMilli(), "s": "BTCUSDT", "U": 10, "u": 12, "pu": 9,
+		"b": [][2]string{{"97000.1", "1.5"}}, "a": [][2]string{{"97000.2", "0.3"}},
+	})
+	expect("partial")
+	server.SendDepthUpdate("btcusdt", "100ms", 10, 12, 9, [][2]string{{"97000.1", "1.5"}}, nil)
+	expect("diff")
+}
+
+func TestConnectorHandlerLatency(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	restore := server.OverrideURLs()
+	defer restore()
+
+	const slow = 20 * time.Millisecond
+	handled := make(chan struct{}, 1)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("quote", func(msg interface{}) {
+		time.Sleep(slow)
+		handled <- struct{}{}
+	})
+
+	connector, err := binance.NewBinancePublicConnector(msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+	if err := connector.SubscribeBookL1("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SendEvent("btcusdt@bookTicker", map[string]interface{}{
+		"e": "bookTicker", "u": 1, "E": time.Now().UnixMilli(), "T": time.Now().UnixMilli(), "s": "BTCUSDT",
+		"b": "100", "B": "1", "a": "101", "A": "1",
+	})
+	select {
+	case <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("quote not published")
+	}
+
+	// handler 的耗时计入 dispatch->handler，不计入解码与转换
+	waitFor(t, "latency", func() bool { return connector.Latency()["btcusdt@bookTicker"].DispatchToHandler.Count == 1 })
+	latency := connector.Latency()["btcusdt@bookTicker"]
+	if latency.DispatchToHandler.Max < slow || latency.DecodeToDispatch.Max >= slow {
+		t.Fatalf("got latency %+v", latency)
+	}
+}
+
+func TestReconnectStateEvents(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var states []base.ConnectionState
+	client, err := base.NewWSClient(server.URL(), func(message []byte, event string, receivedAt time.Time) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetReconnectPolicy(&base.ExponentialJitterPolicy{BaseDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond, MaxRetries: 2})
+	client.SetStateHandler(func(event base.ConnectionStateEvent) {
+		mu.Lock()
+		states = append(states, event.State)
+		mu.Unlock()
+	})
+	expect := func(want ...base.ConnectionState) {
+		t.Helper()
+		waitFor(t, fmt.Sprintf("states %v", want), func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return reflect.DeepEqual(states, want)
+		})
+	}
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe(context.Background(), "btcusdt@trade"); err != nil {
+		t.Fatal(err)
+	}
+	expect(base.ConnectionStateConnecting, base.ConnectionStateConnected)
+
+	server.DropConnections()
+	expect(base.ConnectionStateConnecting, base.ConnectionStateConnected,
+		base.ConnectionStateDisconnected, base.ConnectionStateConnecting, base.ConnectionStateConnected,
+		base.ConnectionStateResubscribed)
+
+	// 服务端关闭后每次重连都失败，用完 MaxRetries 后放弃
+	mu.Lock()
+	states = nil
+	mu.Unlock()
+	server.Close()
+	expect(base.ConnectionStateDisconnected,
+		base.ConnectionStateConnecting, base.ConnectionStateDisconnected,
+		base.ConnectionStateConnecting, base.ConnectionStateDisconnected,
+		base.ConnectionStateGaveUp)
+}
+
+func TestRotationOverlap(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+
+	type rotation struct {
+		at        time.Time
+		delivered int
+	}
+	rotated := make(chan rotation, 4)
+	msgBus := messagebus.NewMessageBus("test", uuid.New(), "test", nil)
+	msgBus.Register("wsState", func(msg interface{}) {
+		if event := msg.(base.ConnectionStateEvent); event.State == base.ConnectionStateRotated {
+			// 切换时新连接已经订阅、旧连接还没关闭，两条连接都收到这笔成交
+			rotated <- rotation{time.Now(), server.SendTrade("btcusdt", 1, "97000.10", "0.5")}
+		}
+	})
+
+	config := server.Config(false)
+	config.RotateAfter = 800 * time.Millisecond
+	config.RotationOverlap = 200 * time.Millisecond
+	c := newCollector()
+	client, err := binance.NewBinanceWSClientWithConfig(binance.BinanceAccountTypeUsdMFuturesTestnet, config, c.handle, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.SubscribeTrade("btcusdt"); err != nil {
+		t.Fatal(err)
+	}
+
+	var r rotation
+	select {
+	case r = <-rotated:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection not rotated")
+	}
+	if r.delivered != 2 {
+		t.Fatalf("trade sent to %d connections during the overlap", r.delivered)
+	}
+	// 重叠期间的重复帧被丢弃
+	c.expect(t, 1)
+	select {
+	case trade := <-c.trades:
+		t.Fatalf("duplicate trade %d delivered", trade.TradeID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	waitFor(t, "old connection closed", func() bool { return server.Connections() == 1 })
+	if elapsed := time.Since(r.at); elapsed < config.RotationOverlap {
+		t.Fatalf("old connection closed %s after the swap", elapsed)
+	}
+	if n := server.SendTrade("btcusdt", 2, "97000.20", "0.5"); n != 1 {
+		t.Fatalf("trade sent to %d connections after the overlap", n)
+	}
+	c.expect(t, 2)
+}
+
+func TestShardsSpreadStreams(t *testing.T) {
+	server := binancetest.NewServer(0)
+	defer server.Close()
+	config := server.Config(true)
+	config.MaxStreamsPerConn = 2
+	c := newCollector()
+	client := newClient(t, config, c)
+
+	for _, symbol := range []string{"btcusdt", "ethusdt"} {
+		if err := client.SubscribeTrade(symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := client.ShardCount(); n != 1 || server.ConnectCount() != 1 {
+		t.Fatalf("%d shards, %d connections for 2 streams", n, server.ConnectCount())
+	}
+
+	// 第一条连接满了，按需新建并连接第二条
+	for _, symbol := range []string{"solusdt", "bnbusdt"} {
+		if err := client.SubscribeTrade(symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := client.ShardCount(); n != 2 || server.ConnectCount() != 2 {
+		t.Fatalf("%d shards, %d connections for 4 streams", n, server.ConnectCount())
+	}
+	if counts := server.StreamCounts(); !reflect.DeepEqual(counts, []int{2, 2}) {
+		t.Fatalf("streams per connection %v", counts)
+	}
+
+	// 两条连接都满了，退订释放的位置被下一个订阅复用，不再新建连接
+	if err := client.Unsubscribe("btcusdt", "trade"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubscribeTrade("xrpusdt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.ShardCount(); n != 2 || server.ConnectCount() != 2 {
+		t.Fatalf("%d shards, %d connections after reusing a slot", n, server.ConnectCount())
+	}
+	if counts := server.StreamCounts(); !reflect.DeepEqual(counts, []int{2, 2}) {
+		t.Fatalf("streams per connection %v", counts)
+	}
+	if got := server.Subscriptions(); !reflect.DeepEqual(got, []string{"bnbusdt@trade", "ethusdt@trade", "solusdt@trade", "xrpusdt@trade"}) {
+		t.Fatalf("subscriptions = %v", got)
+	}
+
+	server.SendTrade("solusdt", 1, "150.10", "2")
+	c.expect(t, 1)
+	server.SendTrade("xrpusdt", 2, "0.52", "100")
+	c.expect(t, 2)
+}